@@ -0,0 +1,101 @@
+package drm
+
+import (
+	"runtime"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+type AtomicFlags uint32
+
+const (
+	AtomicPageFlipEvent AtomicFlags = 0x0001
+	AtomicPageFlipAsync AtomicFlags = 0x0002
+	AtomicTestOnly      AtomicFlags = 0x0100
+	AtomicNonblock      AtomicFlags = 0x0200
+	AtomicAllowModeset  AtomicFlags = 0x0400
+)
+
+// AtomicRequest contains a set of property changes, applied all at once by
+// ModeAtomicCommit.
+type AtomicRequest struct {
+	objIndex map[ObjectID]int
+	objs     []uint32
+	props    [][]uint32
+	values   [][]uint64
+	fences   []*int32
+}
+
+// Add sets an object's property. If the property has already been set in the
+// request, its value is replaced.
+func (req *AtomicRequest) Add(obj AnyID, prop PropertyID, value uint64) {
+	if req.objIndex == nil {
+		req.objIndex = make(map[ObjectID]int)
+	}
+
+	i, ok := req.objIndex[obj.Object()]
+	if !ok {
+		i = len(req.objs)
+		req.objIndex[obj.Object()] = i
+		req.objs = append(req.objs, uint32(obj.Object()))
+		req.props = append(req.props, nil)
+		req.values = append(req.values, nil)
+	}
+
+	for j, p := range req.props[i] {
+		if p == uint32(prop) {
+			req.values[i][j] = value
+			return
+		}
+	}
+	req.props[i] = append(req.props[i], uint32(prop))
+	req.values[i] = append(req.values[i], value)
+}
+
+// AddOutFence requests an out-fence through an OUT_FENCE_PTR or
+// WRITEBACK_OUT_FENCE_PTR property. The kernel writes the fence file
+// descriptor to the returned pointer on commit, it's left to -1 if no fence is
+// created. The caller is responsible for closing the fence.
+func (req *AtomicRequest) AddOutFence(obj AnyID, prop PropertyID) *int32 {
+	// The fence is kept on the heap by the request, so that its address stays
+	// valid and writes by the kernel aren't optimized away
+	fd := new(int32)
+	*fd = -1
+	req.fences = append(req.fences, fd)
+	req.Add(obj, prop, uint64(uintptr(unsafe.Pointer(fd))))
+	return fd
+}
+
+// ModeAtomicCommit applies an atomic request. ClientCapAtomic must be
+// enabled. userData is passed back in page-flip events.
+func (n *Node) ModeAtomicCommit(req *AtomicRequest, flags AtomicFlags, userData uint64) error {
+	var counts, props []uint32
+	var values []uint64
+	for i := range req.objs {
+		counts = append(counts, uint32(len(req.props[i])))
+		props = append(props, req.props[i]...)
+		values = append(values, req.values[i]...)
+	}
+
+	r := uapi.ModeAtomicArg{
+		Flags:     uint32(flags),
+		CountObjs: uint32(len(req.objs)),
+		UserData:  userData,
+	}
+	if len(req.objs) > 0 {
+		r.Objs = uapi.NewPtr(unsafe.Pointer(&req.objs[0]))
+		r.CountProps = uapi.NewPtr(unsafe.Pointer(&counts[0]))
+	}
+	if len(props) > 0 {
+		r.Props = uapi.NewPtr(unsafe.Pointer(&props[0]))
+		r.PropValues = uapi.NewPtr(unsafe.Pointer(&values[0]))
+	}
+	err := modeAtomic(n.backend, &r)
+	// The kernel writes out-fences through pointers held by the request
+	runtime.KeepAlive(counts)
+	runtime.KeepAlive(props)
+	runtime.KeepAlive(values)
+	runtime.KeepAlive(req)
+	return err
+}
@@ -2,9 +2,10 @@ package drm
 
 import (
 	"fmt"
-	"reflect"
-	"runtime"
-	"unsafe"
+	"math/bits"
+	"sort"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
 )
 
 const formatModifierCurrentVersion = 1
@@ -32,47 +33,83 @@ type FormatModifierSet struct {
 	modifiers []formatModifier
 }
 
+// BlobError is returned when a blob is malformed.
+type BlobError struct {
+	Blob   string // kind of blob, e.g. "IN_FORMATS"
+	Field  string // malformed field
+	Reason string
+}
+
+func (err *BlobError) Error() string {
+	return fmt.Sprintf("drm: malformed %v blob: %v: %v", err.Blob, err.Field, err.Reason)
+}
+
+const (
+	formatModifierHeaderSize = 24
+	formatModifierSize       = 24
+)
+
+// checkArray checks that an array of n items of the provided size at offset
+// fits in a blob of length l.
+func checkArray(l int, offset, n uint32, size uint64) bool {
+	// Use 64-bit arithmetic to avoid overflows
+	return uint64(offset)+uint64(n)*size <= uint64(l)
+}
+
 func ParseFormatModifierSet(b []byte) (*FormatModifierSet, error) {
-	if len(b) < int(unsafe.Sizeof(formatModifierHeader{})) {
-		return nil, fmt.Errorf("drm: format modifier blob too short")
+	const blobName = "IN_FORMATS"
+	if len(b) < formatModifierHeaderSize {
+		return nil, &BlobError{blobName, "header", "blob too short"}
 	}
 
-	hPtr := (*formatModifierHeader)(unsafe.Pointer(&b[0]))
-	h := *hPtr
-	runtime.KeepAlive(&b)
+	h := formatModifierHeader{
+		version:         nativeEndian.Uint32(b[0:4]),
+		flags:           nativeEndian.Uint32(b[4:8]),
+		formatsLen:      nativeEndian.Uint32(b[8:12]),
+		formatsOffset:   nativeEndian.Uint32(b[12:16]),
+		modifiersLen:    nativeEndian.Uint32(b[16:20]),
+		modifiersOffset: nativeEndian.Uint32(b[20:24]),
+	}
 
 	if h.version != formatModifierCurrentVersion {
-		return nil, fmt.Errorf("drm: unsupported format modifier blob version")
+		return nil, &BlobError{blobName, "version", fmt.Sprintf("unsupported version %v", h.version)}
 	}
 
+	if !checkArray(len(b), h.formatsOffset, h.formatsLen, 4) {
+		return nil, &BlobError{blobName, "formats", "array out of bounds"}
+	}
 	var formats []uint32
 	if h.formatsLen > 0 {
 		formats = make([]uint32, h.formatsLen)
-		size := len(formats) * int(unsafe.Sizeof(formats[0]))
-		if len(b) < int(h.formatsOffset)+size {
-			return nil, fmt.Errorf("drm: format modifier blob too short")
-		}
-		sh := reflect.SliceHeader{
-			Data: uintptr(unsafe.Pointer(&formats[0])),
-			Len:  size,
-			Cap:  size,
+		for i := range formats {
+			off := int(h.formatsOffset) + 4*i
+			formats[i] = nativeEndian.Uint32(b[off : off+4])
 		}
-		copy(*(*[]byte)(unsafe.Pointer(&sh)), b[h.formatsOffset:])
 	}
 
+	if !checkArray(len(b), h.modifiersOffset, h.modifiersLen, formatModifierSize) {
+		return nil, &BlobError{blobName, "modifiers", "array out of bounds"}
+	}
 	var modifiers []formatModifier
 	if h.modifiersLen > 0 {
 		modifiers = make([]formatModifier, h.modifiersLen)
-		size := len(modifiers) * int(unsafe.Sizeof(modifiers[0]))
-		if len(b) < int(h.modifiersOffset)+size {
-			return nil, fmt.Errorf("drm: format modifier blob too short")
-		}
-		sh := reflect.SliceHeader{
-			Data: uintptr(unsafe.Pointer(&modifiers[0])),
-			Len:  size,
-			Cap:  size,
+		for i := range modifiers {
+			off := int(h.modifiersOffset) + formatModifierSize*i
+			mod := formatModifier{
+				formats:  nativeEndian.Uint64(b[off : off+8]),
+				offset:   nativeEndian.Uint32(b[off+8 : off+12]),
+				modifier: nativeEndian.Uint64(b[off+16 : off+24]),
+			}
+			// Make sure all formats referenced by the modifier exist
+			if mod.formats != 0 {
+				last := uint64(mod.offset) + 63 - uint64(bits.LeadingZeros64(mod.formats))
+				if last >= uint64(h.formatsLen) {
+					field := fmt.Sprintf("modifiers[%v]", i)
+					return nil, &BlobError{blobName, field, "format index out of bounds"}
+				}
+			}
+			modifiers[i] = mod
 		}
-		copy(*(*[]byte)(unsafe.Pointer(&sh)), b[h.modifiersOffset:])
 	}
 
 	return &FormatModifierSet{
@@ -82,48 +119,221 @@ func ParseFormatModifierSet(b []byte) (*FormatModifierSet, error) {
 	}, nil
 }
 
-func (set *FormatModifierSet) Map() map[Modifier][]Format {
-	m := make(map[Modifier][]Format, len(set.modifiers))
+// NewFormatModifierSet creates a format modifier set from a map of modifiers
+// to formats. ModifierInvalid can be used to describe formats supported with
+// an implicit modifier, it is never treated as ModifierLinear.
+func NewFormatModifierSet(m map[Modifier][]Format) *FormatModifierSet {
+	formatIndex := make(map[Format]int)
+	var formats []uint32
+	var mods []Modifier
+	for mod, l := range m {
+		mods = append(mods, mod)
+		for _, f := range l {
+			if _, ok := formatIndex[f]; !ok {
+				formatIndex[f] = 0
+				formats = append(formats, uint32(f))
+			}
+		}
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+	sort.Slice(mods, func(i, j int) bool { return mods[i] < mods[j] })
+	for i, f := range formats {
+		formatIndex[Format(f)] = i
+	}
+
+	var modifiers []formatModifier
+	for _, mod := range mods {
+		// Each entry can only describe a window of 64 formats
+		windows := make(map[uint32]uint64)
+		var offsets []uint32
+		for _, f := range m[mod] {
+			i := formatIndex[f]
+			offset := uint32(i - i%64)
+			if _, ok := windows[offset]; !ok {
+				offsets = append(offsets, offset)
+			}
+			windows[offset] |= 1 << uint(i%64)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		for _, offset := range offsets {
+			modifiers = append(modifiers, formatModifier{
+				formats:  windows[offset],
+				offset:   offset,
+				modifier: uint64(mod),
+			})
+		}
+	}
+
+	return &FormatModifierSet{
+		h:         formatModifierHeader{version: formatModifierCurrentVersion},
+		formats:   formats,
+		modifiers: modifiers,
+	}
+}
+
+func (set *FormatModifierSet) forEach(f func(fmt Format, mod Modifier)) {
 	for _, mod := range set.modifiers {
-		var formats []Format
 		for i := 0; i < 64; i++ {
-			if mod.formats&(1<<uint(i)) != 0 {
-				fmt := set.formats[int(mod.offset)+i]
-				formats = append(formats, Format(fmt))
+			if mod.formats&(1<<uint(i)) == 0 {
+				continue
 			}
+			j := int(mod.offset) + i
+			if j >= len(set.formats) {
+				break
+			}
+			f(Format(set.formats[j]), Modifier(mod.modifier))
 		}
-		m[Modifier(mod.modifier)] = formats
 	}
+}
+
+func (set *FormatModifierSet) Map() map[Modifier][]Format {
+	m := make(map[Modifier][]Format, len(set.modifiers))
+	set.forEach(func(fmt Format, mod Modifier) {
+		m[mod] = append(m[mod], fmt)
+	})
 	return m
 }
 
+// Has checks whether the set contains the format and modifier pair.
+func (set *FormatModifierSet) Has(fmt Format, mod Modifier) bool {
+	for i, f := range set.formats {
+		if Format(f) != fmt {
+			continue
+		}
+		for _, m := range set.modifiers {
+			if Modifier(m.modifier) != mod || uint32(i) < m.offset || uint32(i)-m.offset >= 64 {
+				continue
+			}
+			if m.formats&(1<<(uint32(i)-m.offset)) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Formats returns the list of formats supported with at least one modifier.
+func (set *FormatModifierSet) Formats() []Format {
+	seen := make(map[Format]bool)
+	set.forEach(func(fmt Format, mod Modifier) {
+		seen[fmt] = true
+	})
+
+	var l []Format
+	for _, f := range set.formats {
+		if seen[Format(f)] {
+			l = append(l, Format(f))
+			delete(seen, Format(f))
+		}
+	}
+	return l
+}
+
+// Modifiers returns the list of modifiers supported for a format.
+func (set *FormatModifierSet) Modifiers(fmt Format) []Modifier {
+	seen := make(map[Modifier]bool)
+	var l []Modifier
+	set.forEach(func(f Format, mod Modifier) {
+		if f == fmt && !seen[mod] {
+			seen[mod] = true
+			l = append(l, mod)
+		}
+	})
+	return l
+}
+
+// Intersect returns a new set containing the format and modifier pairs present
+// in both sets.
+func (set *FormatModifierSet) Intersect(other *FormatModifierSet) *FormatModifierSet {
+	m := make(map[Modifier][]Format)
+	set.forEach(func(fmt Format, mod Modifier) {
+		if other.Has(fmt, mod) {
+			m[mod] = append(m[mod], fmt)
+		}
+	})
+	return NewFormatModifierSet(m)
+}
+
+// Bytes encodes the set into a blob, using the same layout as the kernel's
+// IN_FORMATS property.
+func (set *FormatModifierSet) Bytes() []byte {
+	formatsSize := len(set.formats) * 4
+	modifiersOffset := (formatModifierHeaderSize + formatsSize + 7) &^ 7
+
+	b := make([]byte, modifiersOffset+len(set.modifiers)*formatModifierSize)
+	nativeEndian.PutUint32(b[0:4], formatModifierCurrentVersion)
+	nativeEndian.PutUint32(b[4:8], set.h.flags)
+	nativeEndian.PutUint32(b[8:12], uint32(len(set.formats)))
+	nativeEndian.PutUint32(b[12:16], formatModifierHeaderSize)
+	nativeEndian.PutUint32(b[16:20], uint32(len(set.modifiers)))
+	nativeEndian.PutUint32(b[20:24], uint32(modifiersOffset))
+	for i, f := range set.formats {
+		off := formatModifierHeaderSize + 4*i
+		nativeEndian.PutUint32(b[off:off+4], f)
+	}
+	for i, mod := range set.modifiers {
+		off := modifiersOffset + i*formatModifierSize
+		nativeEndian.PutUint64(b[off:off+8], mod.formats)
+		nativeEndian.PutUint32(b[off+8:off+12], mod.offset)
+		nativeEndian.PutUint64(b[off+16:off+24], mod.modifier)
+	}
+	return b
+}
+
+const modeModeInfoSize = 68
+
 func ParseModeModeInfo(b []byte) (*ModeModeInfo, error) {
-	if len(b) < int(unsafe.Sizeof(modeModeInfo{})) {
-		return nil, fmt.Errorf("drm: mode info blob too short")
+	if len(b) != modeModeInfoSize {
+		return nil, &BlobError{"MODE_ID", "size", fmt.Sprintf("got %v bytes, want %v", len(b), modeModeInfoSize)}
+	}
+
+	var info uapi.ModeModeInfo
+	info.Clock = nativeEndian.Uint32(b[0:4])
+	u16 := []*uint16{
+		&info.HDisplay, &info.HSyncStart, &info.HSyncEnd, &info.HTotal, &info.HSkew,
+		&info.VDisplay, &info.VSyncStart, &info.VSyncEnd, &info.VTotal, &info.VScan,
+	}
+	for i, ptr := range u16 {
+		*ptr = nativeEndian.Uint16(b[4+2*i : 6+2*i])
 	}
+	info.VRefresh = nativeEndian.Uint32(b[24:28])
+	info.Flags = nativeEndian.Uint32(b[28:32])
+	info.Type = nativeEndian.Uint32(b[32:36])
+	copy(info.Name[:], b[36:68])
 
-	infoPtr := (*modeModeInfo)(unsafe.Pointer(&b[0]))
-	info := newModeModeInfo(infoPtr)
-	runtime.KeepAlive(&b)
-	return info, nil
+	return newModeModeInfo(&info), nil
+}
+
+// Bytes encodes the mode into a blob suitable for the MODE_ID property.
+func (mode *ModeModeInfo) Bytes() []byte {
+	info := mode.uapi()
+	b := make([]byte, modeModeInfoSize)
+	nativeEndian.PutUint32(b[0:4], info.Clock)
+	u16 := []uint16{
+		info.HDisplay, info.HSyncStart, info.HSyncEnd, info.HTotal, info.HSkew,
+		info.VDisplay, info.VSyncStart, info.VSyncEnd, info.VTotal, info.VScan,
+	}
+	for i, v := range u16 {
+		nativeEndian.PutUint16(b[4+2*i:6+2*i], v)
+	}
+	nativeEndian.PutUint32(b[24:28], info.VRefresh)
+	nativeEndian.PutUint32(b[28:32], info.Flags)
+	nativeEndian.PutUint32(b[32:36], info.Type)
+	copy(b[36:68], info.Name[:])
+	return b
 }
 
 func ParseFormats(b []byte) ([]Format, error) {
-	formatSize := int(unsafe.Sizeof(uint32(0)))
-	if len(b)%formatSize != 0 {
-		return nil, fmt.Errorf("drm: malformed writeback pixel formats blob")
+	if len(b)%4 != 0 {
+		return nil, &BlobError{"WRITEBACK_PIXEL_FORMATS", "size", "not a multiple of the format size"}
 	}
-	formatsLen := len(b) / formatSize
 
 	var formats []Format
-	if formatsLen > 0 {
-		formats = make([]Format, formatsLen)
-		sh := reflect.SliceHeader{
-			Data: uintptr(unsafe.Pointer(&formats[0])),
-			Len:  len(b),
-			Cap:  len(b),
+	if len(b) > 0 {
+		formats = make([]Format, len(b)/4)
+		for i := range formats {
+			formats[i] = Format(nativeEndian.Uint32(b[4*i : 4*i+4]))
 		}
-		copy(*(*[]byte)(unsafe.Pointer(&sh)), b)
 	}
 
 	return formats, nil
@@ -0,0 +1,114 @@
+package drm_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func TestFormatModifierSet(t *testing.T) {
+	set := drm.NewFormatModifierSet(map[drm.Modifier][]drm.Format{
+		drm.ModifierLinear:       {drm.FormatXRGB8888, drm.FormatNV12},
+		drm.ModifierI915_X_TILED: {drm.FormatXRGB8888},
+		drm.ModifierInvalid:      {drm.FormatARGB8888},
+	})
+
+	parsed, err := drm.ParseFormatModifierSet(set.Bytes())
+	if err != nil {
+		t.Fatalf("ParseFormatModifierSet() = %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Bytes(), set.Bytes()) {
+		t.Errorf("re-encoded blob differs")
+	}
+
+	if !parsed.Has(drm.FormatNV12, drm.ModifierLinear) {
+		t.Errorf("Has(NV12, LINEAR) = false, want true")
+	}
+	if parsed.Has(drm.FormatNV12, drm.ModifierI915_X_TILED) {
+		t.Errorf("Has(NV12, X_TILED) = true, want false")
+	}
+	if parsed.Has(drm.FormatARGB8888, drm.ModifierLinear) {
+		t.Errorf("Has(ARGB8888, LINEAR) = true, want false")
+	}
+
+	wantMods := []drm.Modifier{drm.ModifierLinear, drm.ModifierI915_X_TILED}
+	if mods := parsed.Modifiers(drm.FormatXRGB8888); !reflect.DeepEqual(mods, wantMods) {
+		t.Errorf("Modifiers(XRGB8888) = %v, want %v", mods, wantMods)
+	}
+
+	other := drm.NewFormatModifierSet(map[drm.Modifier][]drm.Format{
+		drm.ModifierLinear:  {drm.FormatXRGB8888, drm.FormatARGB8888},
+		drm.ModifierInvalid: {drm.FormatARGB8888},
+	})
+	want := map[drm.Modifier][]drm.Format{
+		drm.ModifierLinear:  {drm.FormatXRGB8888},
+		drm.ModifierInvalid: {drm.FormatARGB8888},
+	}
+	if m := set.Intersect(other).Map(); !reflect.DeepEqual(m, want) {
+		t.Errorf("Intersect() = %v, want %v", m, want)
+	}
+}
+
+func TestFormatModifierSet_window(t *testing.T) {
+	var formats []drm.Format
+	for i := 0; i < 100; i++ {
+		formats = append(formats, drm.Format(i+1))
+	}
+	set := drm.NewFormatModifierSet(map[drm.Modifier][]drm.Format{
+		drm.ModifierLinear: formats,
+	})
+
+	parsed, err := drm.ParseFormatModifierSet(set.Bytes())
+	if err != nil {
+		t.Fatalf("ParseFormatModifierSet() = %v", err)
+	}
+	if l := parsed.Formats(); !reflect.DeepEqual(l, formats) {
+		t.Errorf("Formats() = %v, want %v", l, formats)
+	}
+	if !parsed.Has(drm.Format(100), drm.ModifierLinear) {
+		t.Errorf("Has(100, LINEAR) = false, want true")
+	}
+}
+
+// nativeEndian is the byte order of blobs, i.e. the host's.
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	v := uint16(1)
+	if *(*byte)(unsafe.Pointer(&v)) != 1 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+func TestParseFormatModifierSet_malformed(t *testing.T) {
+	valid := drm.NewFormatModifierSet(map[drm.Modifier][]drm.Format{
+		drm.ModifierLinear: {drm.FormatXRGB8888},
+	}).Bytes()
+
+	tests := []struct {
+		name  string
+		field string
+		edit  func(b []byte)
+	}{
+		{"version", "version", func(b []byte) { nativeEndian.PutUint32(b[0:4], 2) }},
+		{"formatsOffset overflow", "formats", func(b []byte) { nativeEndian.PutUint32(b[12:16], 0xFFFFFFFF) }},
+		{"modifiersLen", "modifiers", func(b []byte) { nativeEndian.PutUint32(b[16:20], 0xFF) }},
+		{"format index", "modifiers[0]", func(b []byte) { nativeEndian.PutUint64(b[len(b)-24:], 0x02) }},
+	}
+	for _, tc := range tests {
+		b := append([]byte(nil), valid...)
+		tc.edit(b)
+		_, err := drm.ParseFormatModifierSet(b)
+		blobErr, ok := err.(*drm.BlobError)
+		if !ok || blobErr.Field != tc.field {
+			t.Errorf("%v: ParseFormatModifierSet() = %v, want error on field %q", tc.name, err, tc.field)
+		}
+	}
+
+	if _, err := drm.ParseFormatModifierSet(valid[:10]); err == nil {
+		t.Errorf("ParseFormatModifierSet() = nil for truncated blob, want error")
+	}
+}
@@ -0,0 +1,87 @@
+package drm
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Caps contains the device capabilities. Capabilities unknown to the kernel
+// are left to their zero value.
+type Caps struct {
+	DumbBuffer          bool
+	VblankHighCRTC      bool
+	DumbPreferredDepth  int
+	DumbPreferShadow    bool
+	Prime               PrimeCaps
+	TimestampMonotonic  bool
+	AsyncPageFlip       bool
+	CursorWidth         int
+	CursorHeight        int
+	AddFB2Modifiers     bool
+	PageFlipTarget      bool
+	CRTCInVBlankEvent   bool
+	SyncObj             bool
+	SyncObjTimeline     bool
+	AtomicAsyncPageFlip bool
+}
+
+// Caps queries all known capabilities.
+func (n *Node) Caps() (*Caps, error) {
+	var caps Caps
+	bools := []struct {
+		cap Cap
+		dst *bool
+	}{
+		{CapDumbBuffer, &caps.DumbBuffer},
+		{CapVblankHighCRTC, &caps.VblankHighCRTC},
+		{CapDumbPreferredShadow, &caps.DumbPreferShadow},
+		{CapTimestampMonotonic, &caps.TimestampMonotonic},
+		{CapAsyncPageFlip, &caps.AsyncPageFlip},
+		{CapAddFB2Modifiers, &caps.AddFB2Modifiers},
+		{CapPageFlipTarget, &caps.PageFlipTarget},
+		{CapCRTCInVBlankEvent, &caps.CRTCInVBlankEvent},
+		{CapSyncObj, &caps.SyncObj},
+		{CapSyncObjTimeline, &caps.SyncObjTimeline},
+		{CapAtomicAsyncPageFlip, &caps.AtomicAsyncPageFlip},
+	}
+	for _, c := range bools {
+		v, err := n.getCapOptional(c.cap)
+		if err != nil {
+			return nil, err
+		}
+		*c.dst = v != 0
+	}
+
+	ints := []struct {
+		cap Cap
+		dst *int
+	}{
+		{CapDumbPreferredDepth, &caps.DumbPreferredDepth},
+		{CapCursorWidth, &caps.CursorWidth},
+		{CapCursorHeight, &caps.CursorHeight},
+	}
+	for _, c := range ints {
+		v, err := n.getCapOptional(c.cap)
+		if err != nil {
+			return nil, err
+		}
+		*c.dst = int(v)
+	}
+
+	prime, err := n.getCapOptional(CapPrime)
+	if err != nil {
+		return nil, err
+	}
+	caps.Prime = PrimeCaps(prime)
+
+	return &caps, nil
+}
+
+// getCapOptional returns zero for capabilities the kernel doesn't know about.
+func (n *Node) getCapOptional(cap Cap) (uint64, error) {
+	v, err := n.GetCap(cap)
+	if errors.Is(err, syscall.EINVAL) {
+		return 0, nil
+	}
+	return v, err
+}
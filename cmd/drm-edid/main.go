@@ -0,0 +1,456 @@
+// drm-edid decodes EDID blobs, similar to edid-decode.
+//
+// Usage:
+//
+//	drm-edid [-x] [-check] [file]
+//	drm-edid [-x] [-check] -c connector [device]
+//
+// The EDID is read from a file (e.g. /sys/class/drm/card0-HDMI-A-1/edid),
+// from stdin if no file or "-" is given, or from the EDID property of a
+// connector with -c. Connectors are IDs or names such as HDMI-A-1, and are
+// looked up on all primary nodes unless a device is specified. Hex dumps, as
+// printed by xrandr --verbose, are accepted as well.
+//
+// Conformance issues are printed after the decoded blocks. With -check, the
+// exit status is non-zero if there are any.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func main() {
+	connector := flag.String("c", "", "read the EDID of a connector")
+	dump := flag.Bool("x", false, "print a hex dump of the EDID")
+	check := flag.Bool("check", false, "exit with a non-zero status if the EDID has conformance issues")
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var b []byte
+	var err error
+	if *connector != "" {
+		b, err = readConnectorEDID(*connector, flag.Arg(0))
+	} else {
+		b, err = readFile(flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(b) == 0 {
+		log.Fatal("empty EDID")
+	}
+
+	edid, err := drm.ParseEDID(b)
+	if err != nil {
+		log.Fatalf("failed to decode EDID: %v", err)
+	}
+
+	if *dump {
+		fmt.Print(hex.Dump(b))
+		fmt.Println()
+	}
+
+	p := &printer{b: b}
+	p.printBase(edid)
+	for i := range edid.ExtensionBlocks {
+		p.printExtension(i+1, &edid.ExtensionBlocks[i])
+	}
+
+	if len(edid.Warnings) > 0 {
+		fmt.Println()
+		fmt.Println("Warnings:")
+		for _, w := range edid.Warnings {
+			fmt.Printf("  %v\n", w)
+		}
+		if *check {
+			os.Exit(1)
+		}
+	}
+}
+
+func readFile(name string) ([]byte, error) {
+	var b []byte
+	var err error
+	if name == "" || name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Binary EDIDs start with a null byte, anything else is expected to be a
+	// hex dump
+	if len(b) > 0 && b[0] != 0 {
+		s := strings.Join(strings.Fields(string(b)), "")
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		if b, err = hex.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("invalid EDID hex dump: %v", err)
+		}
+	}
+	return b, nil
+}
+
+func readConnectorEDID(name, path string) ([]byte, error) {
+	paths := []string{path}
+	if path == "" {
+		var err error
+		paths, err = filepath.Glob(drm.NodePatternPrimary)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range paths {
+		b, found, err := readNodeEDID(path, name)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		if found {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("connector %q not found", name)
+}
+
+func readNodeEDID(path, name string) (b []byte, found bool, err error) {
+	n, err := drm.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer n.Close()
+	return connectorEDID(n, name)
+}
+
+// connectorEDID looks up a connector by ID or name on a node, and returns the
+// contents of its EDID property.
+func connectorEDID(n *drm.Node, name string) (b []byte, found bool, err error) {
+	card, err := n.ModeGetResources()
+	if err != nil {
+		return nil, false, err
+	}
+	var conn *drm.ModeConnector
+	for _, id := range card.Connectors {
+		c, err := n.ModeGetConnector(id)
+		if err != nil {
+			return nil, false, err
+		}
+		if c.Name() == name || strconv.FormatUint(uint64(id), 10) == name {
+			conn = c
+			break
+		}
+	}
+	if conn == nil {
+		return nil, false, nil
+	}
+
+	props, err := n.ModeObjectGetProperties(conn.ID)
+	if err != nil {
+		return nil, true, err
+	}
+	for id, value := range props {
+		prop, err := n.ModeGetProperty(id)
+		if err != nil {
+			return nil, true, err
+		}
+		if prop.Name != "EDID" {
+			continue
+		}
+		if value == 0 {
+			return nil, true, fmt.Errorf("connector %v has no EDID", conn.Name())
+		}
+		b, err := n.ModeGetBlob(drm.BlobID(value))
+		return b, true, err
+	}
+	return nil, true, fmt.Errorf("connector %v has no EDID property", conn.Name())
+}
+
+type printer struct {
+	b []byte
+}
+
+func (p *printer) checksum(block int) string {
+	off := block * 128
+	if off+128 > len(p.b) {
+		return ""
+	}
+	var sum byte
+	for _, v := range p.b[off : off+128] {
+		sum += v
+	}
+	s := fmt.Sprintf("0x%02X", p.b[off+127])
+	if sum != 0 {
+		s += fmt.Sprintf(" (invalid, should be 0x%02X)", p.b[off+127]-sum)
+	}
+	return s
+}
+
+func (p *printer) printBase(edid *drm.EDID) {
+	fmt.Println("Block 0, Base EDID:")
+	fmt.Printf("  EDID Structure Version & Revision: %v.%v\n", edid.Version, edid.Revision)
+
+	fmt.Println("  Vendor & Product Identification:")
+	fmt.Printf("    Manufacturer: %v\n", edid.Manufacturer)
+	fmt.Printf("    Model: %v\n", edid.ProductCode)
+	if edid.SerialNumber != 0 {
+		fmt.Printf("    Serial Number: %v\n", edid.SerialNumber)
+	}
+	switch {
+	case edid.ModelYear:
+		fmt.Printf("    Model year: %v\n", edid.ManufactureYear)
+	case edid.ManufactureWeek != 0:
+		fmt.Printf("    Made in: week %v of %v\n", edid.ManufactureWeek, edid.ManufactureYear)
+	default:
+		fmt.Printf("    Made in: %v\n", edid.ManufactureYear)
+	}
+
+	fmt.Println("  Basic Display Parameters & Features:")
+	if edid.Digital {
+		fmt.Println("    Digital display")
+		if edid.BitDepth != 0 {
+			fmt.Printf("    Bits per primary color channel: %v\n", edid.BitDepth)
+		}
+		if edid.VideoInterface != drm.EDIDVideoInterfaceUndefined {
+			fmt.Printf("    %v interface\n", edid.VideoInterface)
+		}
+	} else {
+		fmt.Println("    Analog display")
+	}
+	switch {
+	case edid.WidthCm != 0 && edid.HeightCm != 0:
+		fmt.Printf("    Maximum image size: %v cm x %v cm\n", edid.WidthCm, edid.HeightCm)
+	case edid.WidthCm != 0 || edid.HeightCm != 0:
+		fmt.Println("    Aspect ratio only, or variable size")
+	default:
+		fmt.Println("    Image size is variable")
+	}
+	if edid.Gamma != 0 {
+		fmt.Printf("    Gamma: %.2f\n", edid.Gamma)
+	}
+	if edid.Features != 0 {
+		fmt.Printf("    Features: %v\n", edid.Features)
+	}
+
+	c := edid.Chromaticity
+	fmt.Println("  Color Characteristics:")
+	fmt.Printf("    Red  : %.4f, %.4f\n", c.Red.X, c.Red.Y)
+	fmt.Printf("    Green: %.4f, %.4f\n", c.Green.X, c.Green.Y)
+	fmt.Printf("    Blue : %.4f, %.4f\n", c.Blue.X, c.Blue.Y)
+	fmt.Printf("    White: %.4f, %.4f\n", c.White.X, c.White.Y)
+
+	fmt.Println("  Established Timings I & II:")
+	if len(edid.EstablishedTimings) == 0 {
+		fmt.Println("    none")
+	}
+	for _, t := range edid.EstablishedTimings {
+		fmt.Printf("    %v\n", t)
+	}
+	fmt.Println("  Standard Timings:")
+	if len(edid.StandardTimings) == 0 {
+		fmt.Println("    none")
+	}
+	for _, t := range edid.StandardTimings {
+		fmt.Printf("    %v\n", t)
+	}
+
+	fmt.Println("  Detailed Timing Descriptors:")
+	for i := range edid.DetailedTimings {
+		printDetailedTiming(i+1, &edid.DetailedTimings[i])
+	}
+	if edid.Name != "" {
+		fmt.Printf("  Display Product Name: %q\n", edid.Name)
+	}
+	if edid.Serial != "" {
+		fmt.Printf("  Display Product Serial Number: %q\n", edid.Serial)
+	}
+	for _, s := range edid.Strings {
+		fmt.Printf("  Alphanumeric Data String: %q\n", s)
+	}
+	if limits := edid.RangeLimits; limits != nil {
+		fmt.Println("  Display Range Limits:")
+		fmt.Printf("    Vertical: %v-%v Hz\n", limits.MinVRate, limits.MaxVRate)
+		fmt.Printf("    Horizontal: %v-%v kHz\n", limits.MinHRate, limits.MaxHRate)
+		if limits.MaxPixelClock != 0 {
+			fmt.Printf("    Maximum pixel clock: %v MHz\n", limits.MaxPixelClock)
+		}
+	}
+
+	fmt.Printf("  Extension blocks: %v\n", edid.Extensions)
+	fmt.Printf("  Checksum: %v\n", p.checksum(0))
+}
+
+func printDetailedTiming(i int, mode *drm.ModeModeInfo) {
+	var flags []string
+	if mode.Type&drm.ModeTypePreferred != 0 {
+		flags = append(flags, "preferred")
+	}
+	if mode.Flags&drm.ModeFlagInterlace != 0 {
+		flags = append(flags, "interlaced")
+	}
+	s := fmt.Sprintf("    DTD %v: %vx%v %.3f Hz %.3f MHz", i, mode.HDisplay, mode.VDisplay,
+		mode.RefreshRate(), float64(mode.Clock)/1000)
+	if len(flags) > 0 {
+		s += " (" + strings.Join(flags, ", ") + ")"
+	}
+	fmt.Println(s)
+
+	hpol, vpol := "N", "N"
+	if mode.Flags&drm.ModeFlagPHSync != 0 {
+		hpol = "P"
+	}
+	if mode.Flags&drm.ModeFlagPVSync != 0 {
+		vpol = "P"
+	}
+	fmt.Printf("           Hfront %v Hsync %v Hback %v Hpol %v\n",
+		mode.HSyncStart-mode.HDisplay, mode.HSyncEnd-mode.HSyncStart, mode.HTotal-mode.HSyncEnd, hpol)
+	fmt.Printf("           Vfront %v Vsync %v Vback %v Vpol %v\n",
+		mode.VSyncStart-mode.VDisplay, mode.VSyncEnd-mode.VSyncStart, mode.VTotal-mode.VSyncEnd, vpol)
+}
+
+func (p *printer) printExtension(i int, ext *drm.EDIDExtension) {
+	fmt.Println()
+	fmt.Printf("Block %v, %v Extension Block:\n", i, ext.Name())
+	if cta := ext.CTA; cta != nil {
+		printCTA(cta)
+	} else if off := i * 128; off+128 <= len(p.b) {
+		fmt.Printf("  Data: %v\n", hex.EncodeToString(p.b[off+1:off+127]))
+	}
+	fmt.Printf("  Checksum: %v\n", p.checksum(i))
+}
+
+func printCTA(cta *drm.EDIDCTAExtension) {
+	fmt.Printf("  Revision: %v\n", cta.Revision)
+	var caps []string
+	if cta.Underscan {
+		caps = append(caps, "underscans IT video formats by default")
+	}
+	if cta.BasicAudio {
+		caps = append(caps, "basic audio support")
+	}
+	if cta.YCbCr444 {
+		caps = append(caps, "supports YCbCr 4:4:4")
+	}
+	if cta.YCbCr422 {
+		caps = append(caps, "supports YCbCr 4:2:2")
+	}
+	for _, c := range caps {
+		fmt.Printf("  %v\n", c)
+	}
+	fmt.Printf("  Native detailed modes: %v\n", cta.NativeTimings)
+
+	for i := range cta.DataBlocks {
+		printDataBlock(&cta.DataBlocks[i])
+	}
+
+	if len(cta.DetailedTimings) > 0 {
+		fmt.Println("  Detailed Timing Descriptors:")
+		for i := range cta.DetailedTimings {
+			printDetailedTiming(i+1, &cta.DetailedTimings[i])
+		}
+	}
+}
+
+func printDataBlock(db *drm.EDIDDataBlock) {
+	name := db.Name()
+	if db.OUI != 0 {
+		name += fmt.Sprintf(", OUI %02X-%02X-%02X", byte(db.OUI>>16), byte(db.OUI>>8), byte(db.OUI))
+	}
+	fmt.Printf("  %v:\n", name)
+
+	switch {
+	case db.VideoCodes != nil:
+		for _, vc := range db.VideoCodes {
+			s := fmt.Sprintf("    VIC %3v", vc.VIC)
+			if t := vc.Timing(); t != nil {
+				s += fmt.Sprintf(": %v", t)
+			}
+			if vc.Native {
+				s += " (native)"
+			}
+			fmt.Println(s)
+		}
+	case db.AudioFormats != nil:
+		for _, af := range db.AudioFormats {
+			fmt.Printf("    %v, max channels %v\n", af.Coding, af.Channels)
+			rates := make([]string, len(af.SampleRates))
+			for i, rate := range af.SampleRates {
+				rates[i] = strconv.FormatFloat(float64(rate)/1000, 'f', -1, 64)
+			}
+			fmt.Printf("      Supported sample rates (kHz): %v\n", strings.Join(rates, " "))
+			if af.BitDepths != nil {
+				fmt.Printf("      Supported sample sizes (bits): %v\n", joinInts(af.BitDepths))
+			}
+		}
+	case db.Speakers != nil:
+		fmt.Printf("    %v\n", strings.Join(db.Speakers, " "))
+	case db.HDMI != nil:
+		a := db.HDMI.PhysicalAddress
+		fmt.Printf("    Source physical address: %v.%v.%v.%v\n", a[0], a[1], a[2], a[3])
+		if db.HDMI.DeepColor != nil {
+			fmt.Printf("    Deep color (bits per pixel): %v\n", joinInts(db.HDMI.DeepColor))
+		}
+		if db.HDMI.MaxTMDSClock != 0 {
+			fmt.Printf("    Maximum TMDS clock: %v MHz\n", db.HDMI.MaxTMDSClock)
+		}
+	case db.HDMIForum != nil:
+		fmt.Printf("    Version: %v\n", db.HDMIForum.Version)
+		if db.HDMIForum.MaxTMDSCharRate != 0 {
+			fmt.Printf("    Maximum TMDS character rate: %v MHz\n", db.HDMIForum.MaxTMDSCharRate)
+		}
+		if db.HDMIForum.SCDC {
+			fmt.Println("    SCDC present")
+		}
+	case db.Colorimetry != nil:
+		fmt.Printf("    %v\n", strings.Join(db.Colorimetry, " "))
+	case db.HDRStaticMetadata != nil:
+		md := db.HDRStaticMetadata
+		eotfs := make([]string, len(md.EOTFs))
+		for i, eotf := range md.EOTFs {
+			eotfs[i] = eotf.String()
+		}
+		fmt.Printf("    Electro-optical transfer functions: %v\n", strings.Join(eotfs, " "))
+		if md.StaticMetadataType1 {
+			fmt.Println("    Supports static metadata type 1")
+		}
+		if md.MaxLuminance != 0 {
+			fmt.Printf("    Desired content max luminance: %.3f cd/m²\n", md.MaxLuminance)
+		}
+		if md.MaxFrameAvgLuminance != 0 {
+			fmt.Printf("    Desired content max frame-average luminance: %.3f cd/m²\n", md.MaxFrameAvgLuminance)
+		}
+		if md.MaxLuminance != 0 {
+			fmt.Printf("    Desired content min luminance: %.3f cd/m²\n", md.MinLuminance)
+		}
+	default:
+		if len(db.Data) > 0 {
+			fmt.Printf("    Data: %v\n", hex.EncodeToString(db.Data))
+		}
+	}
+}
+
+func joinInts(l []int) string {
+	var buf bytes.Buffer
+	for i, v := range l {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strconv.Itoa(v))
+	}
+	return buf.String()
+}
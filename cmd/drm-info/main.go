@@ -0,0 +1,588 @@
+// drm-info dumps the KMS state of DRM devices.
+//
+// Usage:
+//
+//	drm-info [-json] [device...]
+//	drm-info [-json] -i snapshot.json
+//
+// By default, all primary nodes are inspected. With -json, the state is
+// printed as a JSON object mapping node paths to snapshots, which can be read
+// back later with -i (use "-" for stdin), e.g. to inspect a bug reporter's
+// setup.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the state as JSON")
+	input := flag.String("i", "", "read a JSON snapshot instead of devices (\"-\" for stdin)")
+	flag.Parse()
+
+	var snapshots map[string]*drm.Snapshot
+	var err error
+	if *input != "" {
+		if flag.NArg() > 0 {
+			log.Fatal("devices can't be specified with -i")
+		}
+		snapshots, err = readSnapshots(*input)
+	} else {
+		snapshots, err = snapshotDevices(flag.Args())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(snapshots); err != nil {
+			log.Fatalf("failed to write JSON: %v", err)
+		}
+		return
+	}
+
+	paths := make([]string, 0, len(snapshots))
+	for path := range snapshots {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Println()
+		}
+		p := &printer{w: os.Stdout, indices: make(map[drm.ObjectID]int)}
+		p.printSnapshot(path, snapshots[path])
+	}
+}
+
+func snapshotDevices(paths []string) (map[string]*drm.Snapshot, error) {
+	if len(paths) == 0 {
+		var err error
+		paths, err = filepath.Glob(drm.NodePatternPrimary)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no DRM device found")
+		}
+	}
+
+	snapshots := make(map[string]*drm.Snapshot)
+	for _, path := range paths {
+		s, err := snapshotDevice(path)
+		if err != nil {
+			log.Printf("skipping %v: %v", path, err)
+			continue
+		}
+		snapshots[path] = s
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("failed to inspect any device")
+	}
+	return snapshots, nil
+}
+
+func snapshotDevice(path string) (*drm.Snapshot, error) {
+	n, err := drm.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer n.Close()
+
+	// Snapshot only enables the universal planes client cap: enable the
+	// others beforehand, so that all objects, properties and modes are
+	// listed. Atomic must be enabled before the caps depending on it.
+	clientCaps := make(map[string]bool)
+	for _, c := range []drm.ClientCap{drm.ClientCapAtomic, drm.ClientCapStereo3D, drm.ClientCapAspectRatio, drm.ClientCapWritebackConnectors, drm.ClientCapCursorPlaneHotspot} {
+		clientCaps[c.String()] = n.SetClientCap(c, 1) == nil
+	}
+
+	s, err := n.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	for name, ok := range clientCaps {
+		s.ClientCaps[name] = ok
+	}
+	// Only available to the DRM master
+	if s.Device != nil {
+		s.Device.BusID, _ = n.BusID()
+	}
+	return s, nil
+}
+
+// readSnapshots reads the output of drm-info -json. A single snapshot, as
+// marshaled by other tools, is accepted as well.
+func readSnapshots(name string) (map[string]*drm.Snapshot, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	if _, ok := raw["crtcs"]; ok {
+		var s drm.Snapshot
+		if err := unmarshalRaw(raw, &s); err != nil {
+			return nil, err
+		}
+		return map[string]*drm.Snapshot{name: &s}, nil
+	}
+
+	snapshots := make(map[string]*drm.Snapshot, len(raw))
+	for path, b := range raw {
+		var s drm.Snapshot
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot for %v: %v", path, err)
+		}
+		snapshots[path] = &s
+	}
+	return snapshots, nil
+}
+
+func unmarshalRaw(raw map[string]json.RawMessage, v interface{}) error {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	return nil
+}
+
+type printer struct {
+	w     io.Writer
+	depth int
+	// Index of each CRTC and encoder, as used in possible_crtcs bitmasks
+	indices map[drm.ObjectID]int
+}
+
+func (p *printer) printf(format string, v ...interface{}) {
+	fmt.Fprintf(p.w, "%v%v\n", strings.Repeat("  ", p.depth), fmt.Sprintf(format, v...))
+}
+
+// index formats the index of an object, falling back to its ID if unknown.
+func (p *printer) index(id drm.AnyID) string {
+	if i, ok := p.indices[id.Object()]; ok {
+		return fmt.Sprint(i)
+	}
+	return fmt.Sprintf("(ID %v)", id.Object())
+}
+
+// section prints a heading and runs f with an increased indentation.
+func (p *printer) section(f func(), format string, v ...interface{}) {
+	p.printf(format, v...)
+	p.depth++
+	f()
+	p.depth--
+}
+
+func (p *printer) printSnapshot(path string, s *drm.Snapshot) {
+	p.section(func() {
+		if v := s.Version; v != nil {
+			p.printf("Driver: %v (%v) version %v.%v.%v (%v)", v.Name, v.Desc, v.Major, v.Minor, v.Patch, v.Date)
+		}
+		if dev := s.Device; dev != nil {
+			if pci := dev.PCI; pci != nil {
+				p.printf("Device: PCI %04x:%04x (subsystem %04x:%04x)", pci.Vendor, pci.Device, pci.SubVendor, pci.SubDevice)
+			} else {
+				p.printf("Device: %v", dev.BusType)
+			}
+			if dev.BusID != "" {
+				p.printf("Bus ID: %v", dev.BusID)
+			}
+		}
+
+		p.section(func() {
+			names := make([]string, 0, len(s.ClientCaps))
+			for name := range s.ClientCaps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				status := "supported"
+				if !s.ClientCaps[name] {
+					status = "unsupported"
+				}
+				p.printf("%v: %v", name, status)
+			}
+		}, "Client caps:")
+		p.section(func() {
+			names := make([]string, 0, len(s.Caps))
+			for name := range s.Caps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				p.printf("%v: %v", name, s.Caps[name])
+			}
+		}, "Caps:")
+
+		p.printf("Framebuffer size: %vx%v to %vx%v", s.MinWidth, s.MinHeight, s.MaxWidth, s.MaxHeight)
+		if len(s.FBs) > 0 {
+			p.printf("Framebuffers: %v", joinIDs(s.FBs))
+		}
+
+		for i, crtc := range s.CRTCs {
+			p.indices[crtc.ID.Object()] = i
+		}
+		for i, enc := range s.Encoders {
+			p.indices[enc.ID.Object()] = i
+		}
+
+		p.section(func() {
+			for i, conn := range s.Connectors {
+				p.printConnector(i, &conn)
+			}
+		}, "Connectors:")
+		p.section(func() {
+			for i, enc := range s.Encoders {
+				p.section(func() {
+					p.printf("Type: %v", enc.Type)
+					if enc.CRTC != 0 {
+						p.printf("CRTC: %v", p.index(enc.CRTC))
+					}
+					p.printf("Possible CRTCs: %v", bitmaskIndices(enc.PossibleCRTCs))
+					p.printf("Possible clones: %v", bitmaskIndices(enc.PossibleClones))
+				}, "Encoder %v (ID %v)", i, enc.ID)
+			}
+		}, "Encoders:")
+		p.section(func() {
+			for i, crtc := range s.CRTCs {
+				p.section(func() {
+					if crtc.Mode != nil {
+						p.printf("Mode: %v", formatMode(crtc.Mode))
+					}
+					if crtc.FB != 0 {
+						p.printf("FB: %v at %v,%v", crtc.FB, crtc.X, crtc.Y)
+					}
+					p.printf("Gamma size: %v", crtc.GammaSize)
+					p.printProperties(crtc.Properties)
+				}, "CRTC %v (ID %v)", i, crtc.ID)
+			}
+		}, "CRTCs:")
+		p.section(func() {
+			for i, plane := range s.Planes {
+				p.section(func() {
+					p.printf("Possible CRTCs: %v", bitmaskIndices(plane.PossibleCRTCs))
+					if plane.CRTC != 0 {
+						p.printf("CRTC: %v", p.index(plane.CRTC))
+					}
+					if plane.FB != 0 {
+						p.printf("FB: %v", plane.FB)
+					}
+					p.printf("Formats: %v", joinFormats(plane.Formats))
+					p.printProperties(plane.Properties)
+				}, "Plane %v (ID %v)", i, plane.ID)
+			}
+		}, "Planes:")
+	}, "Node: %v", path)
+}
+
+func (p *printer) printConnector(i int, conn *drm.SnapshotConnector) {
+	p.section(func() {
+		p.printf("Status: %v", conn.Status)
+		if conn.PhyWidth != 0 || conn.PhyHeight != 0 {
+			p.printf("Physical size: %vx%v mm", conn.PhyWidth, conn.PhyHeight)
+		}
+		p.printf("Subpixel: %v", conn.Subpixel)
+		var encs []string
+		for _, id := range conn.Encoders {
+			encs = append(encs, p.index(id))
+		}
+		p.printf("Encoders: {%v}", strings.Join(encs, ", "))
+		if conn.Encoder != 0 {
+			p.printf("Encoder: %v", p.index(conn.Encoder))
+		}
+		if len(conn.Modes) > 0 {
+			p.section(func() {
+				for _, mode := range conn.Modes {
+					p.printf("%v", formatMode(&mode))
+				}
+			}, "Modes:")
+		}
+		p.printProperties(conn.Properties)
+	}, "Connector %v (ID %v): %v", i, conn.ID, conn.Name)
+}
+
+func (p *printer) printProperties(props map[string]drm.SnapshotProperty) {
+	if len(props) == 0 {
+		return
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return props[names[i]].ID < props[names[j]].ID
+	})
+
+	p.section(func() {
+		for _, name := range names {
+			p.printProperty(name, props[name])
+		}
+	}, "Properties:")
+}
+
+func (p *printer) printProperty(name string, prop drm.SnapshotProperty) {
+	var flags []string
+	if prop.Immutable {
+		flags = append(flags, "immutable")
+	}
+	if prop.Atomic {
+		flags = append(flags, "atomic")
+	}
+	header := fmt.Sprintf("%q", name)
+	if len(flags) > 0 {
+		header += " (" + strings.Join(flags, ", ") + ")"
+	}
+
+	var spec, value string
+	switch prop.Type {
+	case "range", "signed range":
+		if prop.Min != nil && prop.Max != nil {
+			spec = fmt.Sprintf(" [%v, %v]", *prop.Min, *prop.Max)
+		}
+		value = fmt.Sprint(prop.RawValue)
+		if prop.Type == "signed range" {
+			value = fmt.Sprint(int64(prop.RawValue))
+		}
+	case "enum", "bitmask":
+		var enums []string
+		for _, e := range prop.Enums {
+			enums = append(enums, e.Name)
+		}
+		spec = " {" + strings.Join(enums, ", ") + "}"
+		if prop.Type == "enum" {
+			value = prop.Enum
+		} else {
+			value = "(" + strings.Join(prop.Bitmask, " | ") + ")"
+		}
+	case "object":
+		spec = " " + prop.ObjectType.String()
+		value = fmt.Sprint(prop.RawValue)
+	default:
+		value = fmt.Sprint(prop.RawValue)
+	}
+
+	if prop.Blob == nil {
+		p.printf("%v: %v%v = %v", header, prop.Type, spec, value)
+		return
+	}
+	p.section(func() {
+		p.printBlob(prop.Blob)
+	}, "%v: %v%v = %v", header, prop.Type, spec, value)
+}
+
+func (p *printer) printBlob(blob *drm.SnapshotBlob) {
+	switch {
+	case blob.EDID != nil:
+		p.printEDID(blob.EDID)
+	case blob.Mode != nil:
+		p.printf("%v", formatMode(blob.Mode))
+	case blob.InFormats != nil:
+		p.printInFormats(blob.InFormats)
+	case blob.Formats != nil:
+		p.printf("%v", joinFormats(blob.Formats))
+	case blob.Path != "":
+		p.printf("%v", blob.Path)
+	case blob.LUT != nil:
+		p.printf("%v entries", len(blob.LUT))
+	case blob.CTM != nil:
+		for i := 0; i < 3; i++ {
+			p.printf("%8.4f %8.4f %8.4f", blob.CTM[3*i], blob.CTM[3*i+1], blob.CTM[3*i+2])
+		}
+	case blob.HDR != nil:
+		md := blob.HDR
+		p.printf("EOTF: %v", md.EOTF)
+		p.printf("Mastering luminance: %v to %v cd/m²", float64(md.MinDisplayMasteringLuminance)/10000, md.MaxDisplayMasteringLuminance)
+		p.printf("MaxCLL: %v cd/m², MaxFALL: %v cd/m²", md.MaxCLL, md.MaxFALL)
+	default:
+		p.printf("%v bytes", len(blob.Data))
+	}
+}
+
+func (p *printer) printEDID(edid *drm.EDID) {
+	p.printf("Version: %v.%v", edid.Version, edid.Revision)
+	p.printf("Manufacturer: %v, product code: %v, serial number: %v", edid.Manufacturer, edid.ProductCode, edid.SerialNumber)
+	if edid.Name != "" {
+		p.printf("Name: %v", edid.Name)
+	}
+	if edid.Serial != "" {
+		p.printf("Serial: %v", edid.Serial)
+	}
+	p.printf("Manufactured: week %v of %v", edid.ManufactureWeek, edid.ManufactureYear)
+	if edid.Digital {
+		p.printf("Input: digital")
+	} else {
+		p.printf("Input: analog")
+	}
+	if edid.WidthCm != 0 || edid.HeightCm != 0 {
+		p.printf("Size: %vx%v cm", edid.WidthCm, edid.HeightCm)
+	}
+	c := edid.Chromaticity
+	p.printf("Chromaticity: red (%.3f, %.3f), green (%.3f, %.3f), blue (%.3f, %.3f), white (%.3f, %.3f)",
+		c.Red.X, c.Red.Y, c.Green.X, c.Green.Y, c.Blue.X, c.Blue.Y, c.White.X, c.White.Y)
+	if md := edid.HDRStaticMetadata; md != nil {
+		var eotfs []string
+		for _, eotf := range md.EOTFs {
+			eotfs = append(eotfs, eotf.String())
+		}
+		p.printf("HDR EOTFs: %v", strings.Join(eotfs, ", "))
+		p.printf("HDR luminance: min %.4f, max %.1f, max frame-average %.1f cd/m²", md.MinLuminance, md.MaxLuminance, md.MaxFrameAvgLuminance)
+	}
+}
+
+// printInFormats prints a matrix with formats as rows and modifiers as
+// columns.
+func (p *printer) printInFormats(l []drm.SnapshotFormatModifiers) {
+	var formats []drm.Format
+	has := make(map[drm.Format]map[int]bool)
+	for i, fm := range l {
+		p.printf("[%v] %v (0x%016x)", i, formatModifier(fm.Modifier), uint64(fm.Modifier))
+		for _, f := range fm.Formats {
+			if has[f] == nil {
+				has[f] = make(map[int]bool)
+				formats = append(formats, f)
+			}
+			has[f][i] = true
+		}
+	}
+
+	width := 8
+	for _, f := range formats {
+		if l := len(formatName(f)); l > width {
+			width = l
+		}
+	}
+
+	var sb strings.Builder
+	for i := range l {
+		fmt.Fprintf(&sb, " %2v", i)
+	}
+	p.printf("%-*v%v", width, "", sb.String())
+	for _, f := range formats {
+		sb.Reset()
+		for i := range l {
+			mark := "."
+			if has[f][i] {
+				mark = "x"
+			}
+			fmt.Fprintf(&sb, " %2v", mark)
+		}
+		p.printf("%-*v%v", width, formatName(f), sb.String())
+	}
+}
+
+func formatMode(mode *drm.ModeModeInfo) string {
+	var flags []string
+	typeNames := []struct {
+		bit  uint32
+		name string
+	}{
+		{drm.ModeTypePreferred, "preferred"},
+		{drm.ModeTypeDriver, "driver"},
+		{drm.ModeTypeUserDef, "userdef"},
+	}
+	for _, t := range typeNames {
+		if mode.Type&t.bit != 0 {
+			flags = append(flags, t.name)
+		}
+	}
+	flagNames := []struct {
+		bit  uint32
+		name string
+	}{
+		{drm.ModeFlagPHSync, "phsync"},
+		{drm.ModeFlagNHSync, "nhsync"},
+		{drm.ModeFlagPVSync, "pvsync"},
+		{drm.ModeFlagNVSync, "nvsync"},
+		{drm.ModeFlagInterlace, "interlace"},
+		{drm.ModeFlagDblScan, "dblscan"},
+		{drm.ModeFlagCSync, "csync"},
+		{drm.ModeFlagPCSync, "pcsync"},
+		{drm.ModeFlagNCSync, "ncsync"},
+		{drm.ModeFlagHSkew, "hskew"},
+		{drm.ModeFlagDblClk, "dblclk"},
+		{drm.ModeFlagClkDiv2, "clkdiv2"},
+	}
+	for _, f := range flagNames {
+		if mode.Flags&f.bit != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+
+	s := fmt.Sprintf("%vx%v@%.2f %v kHz %v %v %v %v %v %v %v %v",
+		mode.HDisplay, mode.VDisplay, mode.RefreshRate(), mode.Clock,
+		mode.HDisplay, mode.HSyncStart, mode.HSyncEnd, mode.HTotal,
+		mode.VDisplay, mode.VSyncStart, mode.VSyncEnd, mode.VTotal)
+	if len(flags) > 0 {
+		s += " " + strings.Join(flags, " ")
+	}
+	return s
+}
+
+func formatName(f drm.Format) string {
+	if name := f.String(); name != "unknown" {
+		return name
+	}
+	// Print the fourcc code, e.g. for formats unknown to go-drm
+	b := []byte{byte(f), byte(f >> 8), byte(f >> 16), byte(f >> 24)}
+	return fmt.Sprintf("%q", b)
+}
+
+func joinFormats(formats []drm.Format) string {
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = formatName(f)
+	}
+	return strings.Join(names, " ")
+}
+
+func formatModifier(mod drm.Modifier) string {
+	if name := mod.String(); name != "unknown" {
+		return name
+	}
+	return fmt.Sprintf("%v unknown", mod.Vendor())
+}
+
+func joinIDs(ids []drm.FBID) string {
+	l := make([]string, len(ids))
+	for i, id := range ids {
+		l[i] = fmt.Sprint(id)
+	}
+	return strings.Join(l, ", ")
+}
+
+// bitmaskIndices formats a bitmask of object indices, as found in
+// possible_crtcs.
+func bitmaskIndices(mask uint32) string {
+	var l []string
+	for i := 0; i < 32; i++ {
+		if mask&(1<<uint(i)) != 0 {
+			l = append(l, fmt.Sprint(i))
+		}
+	}
+	return "{" + strings.Join(l, ", ") + "}"
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+const (
+	statsInterval = 5 * time.Second
+	// flipTimeout bounds the wait for pending flips before exiting
+	flipTimeout = time.Second
+)
+
+// flipStats accumulates page-flip timings from flip-complete events.
+type flipStats struct {
+	frames int
+	missed int
+
+	first, last time.Duration
+	lastSeq     uint32
+
+	// Interval statistics, in seconds
+	min, max, sum, sumSq float64
+}
+
+func (s *flipStats) add(ev *drm.VBlankEvent) {
+	if s.frames > 0 {
+		if gap := int(ev.Sequence - s.lastSeq); gap > 1 {
+			s.missed += gap - 1
+		}
+		d := (ev.Time - s.last).Seconds()
+		if s.frames == 1 || d < s.min {
+			s.min = d
+		}
+		if d > s.max {
+			s.max = d
+		}
+		s.sum += d
+		s.sumSq += d * d
+	} else {
+		s.first = ev.Time
+	}
+	s.frames++
+	s.last = ev.Time
+	s.lastSeq = ev.Sequence
+}
+
+func (s *flipStats) String() string {
+	if s.frames < 2 {
+		return fmt.Sprintf("%v frames", s.frames)
+	}
+	n := float64(s.frames - 1)
+	mean := s.sum / n
+	jitter := math.Sqrt(math.Max(s.sumSq/n-mean*mean, 0))
+	return fmt.Sprintf("%v frames, %.2f Hz, interval min %.3f ms max %.3f ms, jitter %.3f ms, %v missed vblanks",
+		s.frames, n/(s.last-s.first).Seconds(), s.min*1000, s.max*1000, jitter*1000, s.missed)
+}
+
+// flipLoop flips each pipe between its test pattern and a checkerboard with
+// a moving marker, and prints statistics until maxFrames flips completed on
+// all pipes (if non-zero) or until interrupted.
+func (st *state) flipLoop(maxFrames int, interrupt <-chan os.Signal) error {
+	for i, p := range st.pipes {
+		fb, err := st.createFB(p.format, int(p.mode.HDisplay), int(p.mode.VDisplay), drm.Checkerboard{})
+		if err != nil {
+			return err
+		}
+		p.fbs[1] = fb
+		if err := st.flip(i, p); err != nil {
+			return err
+		}
+	}
+
+	results := make(chan readResult)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			events, err := st.n.ReadEvents()
+			select {
+			case results <- readResult{events, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	defer st.printStats()
+	// The framebuffers are released afterwards, they must not be in use by
+	// a pending flip
+	defer st.waitFlips(results)
+
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+			st.printStats()
+		case res := <-results:
+			if res.err != nil {
+				return fmt.Errorf("failed to read events: %v", res.err)
+			}
+			for _, ev := range res.events {
+				i, vblank := st.flipComplete(ev)
+				if vblank == nil {
+					continue
+				}
+				p := st.pipes[i]
+				p.stats.add(vblank)
+				if maxFrames > 0 && p.stats.frames >= maxFrames {
+					continue
+				}
+				if err := st.flip(i, p); err != nil {
+					return err
+				}
+			}
+			if maxFrames > 0 && st.framesDone(maxFrames) {
+				return nil
+			}
+		}
+	}
+}
+
+// readResult is the outcome of a Node.ReadEvents call.
+type readResult struct {
+	events []drm.Event
+	err    error
+}
+
+// flipComplete returns the pipe index and event if ev completes a flip
+// scheduled by flip, and marks the flip as done.
+func (st *state) flipComplete(ev drm.Event) (int, *drm.VBlankEvent) {
+	vblank, ok := ev.(*drm.VBlankEvent)
+	if !ok || vblank.Type != drm.EventFlipComplete || vblank.UserData >= uint64(len(st.pipes)) {
+		return 0, nil
+	}
+	i := int(vblank.UserData)
+	st.pipes[i].pending = false
+	return i, vblank
+}
+
+// waitFlips waits for the pending flips to complete, without scheduling new
+// ones. It gives up after flipTimeout or if reading events fails.
+func (st *state) waitFlips(results <-chan readResult) {
+	timeout := time.After(flipTimeout)
+	for st.flipsPending() {
+		select {
+		case res := <-results:
+			if res.err != nil {
+				return
+			}
+			for _, ev := range res.events {
+				st.flipComplete(ev)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func (st *state) flipsPending() bool {
+	for _, p := range st.pipes {
+		if p.pending {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *state) framesDone(maxFrames int) bool {
+	for _, p := range st.pipes {
+		if p.stats.frames < maxFrames {
+			return false
+		}
+	}
+	return true
+}
+
+// flip schedules a flip to the pipe's back buffer, redrawing the checkerboard
+// first.
+func (st *state) flip(i int, p *pipe) error {
+	back := 1 - p.front
+	if back == 1 {
+		err := drm.FillPattern(p.fbs[1].Pixels, drm.Checkerboard{Frame: p.stats.frames})
+		if err != nil {
+			return err
+		}
+	}
+
+	fb := p.fbs[back]
+	var err error
+	if st.atomic {
+		var req atomicRequest
+		plane := st.plane(p.plane)
+		req.set(plane.ID, plane.Properties, "FB_ID", uint64(fb.ID))
+		if req.err != nil {
+			return req.err
+		}
+		err = st.n.ModeAtomicCommit(&req.AtomicRequest, drm.AtomicPageFlipEvent|drm.AtomicNonblock, uint64(i))
+	} else {
+		err = st.n.ModePageFlip(p.crtc, fb.ID, drm.PageFlipEvent, 0, uint64(i))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to flip CRTC %v: %v", p.crtc, err)
+	}
+	p.front = back
+	p.pending = true
+	return nil
+}
+
+func (st *state) printStats() {
+	for _, p := range st.pipes {
+		fmt.Printf("CRTC %v: %v\n", p.crtc, &p.stats)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+type lister struct {
+	s *drm.Snapshot
+}
+
+func (l lister) encoders() {
+	fmt.Println("Encoders:")
+	fmt.Println("id\tcrtc\ttype\tpossible crtcs\tpossible clones")
+	for _, enc := range l.s.Encoders {
+		fmt.Printf("%v\t%v\t%v\t0x%08x\t0x%08x\n", enc.ID, enc.CRTC, enc.Type, enc.PossibleCRTCs, enc.PossibleClones)
+	}
+	fmt.Println()
+}
+
+func (l lister) connectors() {
+	fmt.Println("Connectors:")
+	fmt.Println("id\tencoder\tstatus\t\tname\t\tsize (mm)\tmodes\tencoders")
+	for _, conn := range l.s.Connectors {
+		encs := make([]string, len(conn.Encoders))
+		for i, id := range conn.Encoders {
+			encs[i] = fmt.Sprint(id)
+		}
+		fmt.Printf("%v\t%v\t%v\t%-15v\t%vx%v\t\t%v\t%v\n", conn.ID, conn.Encoder, conn.Status, conn.Name,
+			conn.PhyWidth, conn.PhyHeight, len(conn.Modes), strings.Join(encs, ", "))
+		if len(conn.Modes) > 0 {
+			fmt.Println("  modes:")
+			fmt.Println("\tindex name refresh (Hz) hdisp hss hse htot vdisp vss vse vtot")
+			for i := range conn.Modes {
+				printMode(i, &conn.Modes[i])
+			}
+		}
+		printProperties(conn.Properties)
+	}
+	fmt.Println()
+}
+
+func (l lister) crtcs() {
+	fmt.Println("CRTCs:")
+	fmt.Println("id\tfb\tpos\tsize")
+	for _, crtc := range l.s.CRTCs {
+		var w, h uint16
+		if crtc.Mode != nil {
+			w, h = crtc.Mode.HDisplay, crtc.Mode.VDisplay
+		}
+		fmt.Printf("%v\t%v\t(%v,%v)\t(%vx%v)\n", crtc.ID, crtc.FB, crtc.X, crtc.Y, w, h)
+		if crtc.Mode != nil {
+			printMode(-1, crtc.Mode)
+		}
+		printProperties(crtc.Properties)
+	}
+	fmt.Println()
+}
+
+func (l lister) planes() {
+	fmt.Println("Planes:")
+	fmt.Println("id\tcrtc\tfb\tpossible crtcs\tgamma size")
+	for _, plane := range l.s.Planes {
+		fmt.Printf("%v\t%v\t%v\t0x%08x\t%v\n", plane.ID, plane.CRTC, plane.FB, plane.PossibleCRTCs, plane.GammaSize)
+		formats := make([]string, len(plane.Formats))
+		for i, f := range plane.Formats {
+			formats[i] = formatName(f)
+		}
+		fmt.Printf("  formats: %v\n", strings.Join(formats, " "))
+		printProperties(plane.Properties)
+	}
+	fmt.Println()
+}
+
+func (l lister) fbs() {
+	fmt.Println("Frame buffers:")
+	fmt.Println("id")
+	for _, fb := range l.s.FBs {
+		fmt.Println(fb)
+	}
+	fmt.Println()
+}
+
+func printMode(i int, mode *drm.ModeModeInfo) {
+	index := "  "
+	if i >= 0 {
+		index = fmt.Sprintf("#%v", i)
+	}
+	var flags []string
+	if mode.Type&drm.ModeTypePreferred != 0 {
+		flags = append(flags, "preferred")
+	}
+	if mode.Type&drm.ModeTypeDriver != 0 {
+		flags = append(flags, "driver")
+	}
+	if mode.Flags&drm.ModeFlagInterlace != 0 {
+		flags = append(flags, "interlace")
+	}
+	fmt.Printf("  %v %v %.2f %v %v %v %v %v %v %v %v %v\n", index, mode.Name, mode.RefreshRate(),
+		mode.HDisplay, mode.HSyncStart, mode.HSyncEnd, mode.HTotal,
+		mode.VDisplay, mode.VSyncStart, mode.VSyncEnd, mode.VTotal,
+		strings.Join(flags, ", "))
+}
+
+func printProperties(props map[string]drm.SnapshotProperty) {
+	if len(props) == 0 {
+		return
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return props[names[i]].ID < props[names[j]].ID
+	})
+
+	fmt.Println("  props:")
+	for _, name := range names {
+		prop := props[name]
+		var flags string
+		if prop.Immutable {
+			flags = " immutable"
+		}
+		var value string
+		switch {
+		case prop.Enum != "":
+			value = prop.Enum
+		case prop.Bitmask != nil:
+			value = strings.Join(prop.Bitmask, "|")
+		case prop.Blob != nil:
+			value = fmt.Sprintf("blob %v", prop.Blob.ID)
+		default:
+			value = fmt.Sprint(int64(prop.RawValue))
+		}
+		fmt.Printf("\t%v %v (%v%v): %v\n", prop.ID, name, prop.Type, flags, value)
+		if len(prop.Enums) > 0 {
+			enums := make([]string, len(prop.Enums))
+			for i, e := range prop.Enums {
+				enums[i] = fmt.Sprintf("%v=%v", e.Name, e.Value)
+			}
+			fmt.Printf("\t\tenums: %v\n", strings.Join(enums, " "))
+		}
+	}
+}
+
+func formatName(f drm.Format) string {
+	if name := f.String(); name != "unknown" {
+		return name
+	}
+	b := []byte{byte(f), byte(f >> 8), byte(f >> 16), byte(f >> 24)}
+	return fmt.Sprintf("%q", b)
+}
@@ -0,0 +1,171 @@
+// drm-modetest sets modes and planes on a DRM device, for bring-up and
+// testing. It's modeled after libdrm's modetest.
+//
+// Usage:
+//
+//	drm-modetest [options] [device]
+//
+// Without -s, -P or -w, the resources of the device are listed (restricted
+// with -c, -e, -p and -f). Otherwise:
+//
+//	-s <connector>[,<connector>][@<crtc>][:<mode>][@<format>]
+//		set a mode, connectors are IDs or names such as HDMI-A-1 and the
+//		mode is #<index> or <name>[-<vrefresh>], the preferred one by default
+//	-P <plane>@<crtc>:<w>x<h>[+<x>+<y>][*<scale>][@<format>]
+//		enable an overlay plane
+//	-w <object>:<property>:<value>
+//		set a property, the value can be an enum name
+//
+// Formats are fourcc codes (e.g. XR24, NV12) or names (e.g. XRGB8888). The
+// device defaults to the first primary node supporting KMS.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var patterns = map[string]drm.Pattern{
+	"smpte":        drm.SMPTEBars{},
+	"gradient":     drm.Gradient{},
+	"checkerboard": drm.Checkerboard{},
+}
+
+func main() {
+	var pipeArgs, planeArgs, propArgs stringList
+	flag.Var(&pipeArgs, "s", "set a mode (repeatable)")
+	flag.Var(&planeArgs, "P", "enable an overlay plane (repeatable)")
+	flag.Var(&propArgs, "w", "set a property (repeatable)")
+	listConnectors := flag.Bool("c", false, "list connectors")
+	listEncoders := flag.Bool("e", false, "list encoders")
+	listPlanes := flag.Bool("p", false, "list CRTCs and planes")
+	listFBs := flag.Bool("f", false, "list framebuffers")
+	atomic := flag.Bool("a", false, "use the atomic API")
+	vsync := flag.Bool("v", false, "run a page-flip loop and print vsync statistics")
+	frames := flag.Int("frames", 0, "stop the page-flip loop after this many frames, 0 for no limit")
+	patternName := flag.String("F", "smpte", "test pattern: smpte, gradient or checkerboard")
+	flag.Parse()
+
+	pattern, ok := patterns[*patternName]
+	if !ok {
+		log.Fatalf("unknown pattern %q", *patternName)
+	}
+
+	var n *drm.Node
+	var err error
+	switch flag.NArg() {
+	case 0:
+		n, err = drm.OpenPrimary()
+	case 1:
+		n, err = drm.Open(flag.Arg(0))
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("failed to open device: %v", err)
+	}
+	defer n.Close()
+
+	// Snapshot only enables the universal planes client cap: atomic must be
+	// enabled beforehand for the atomic-only properties to be listed
+	atomicOK := *atomic && n.SetClientCap(drm.ClientCapAtomic, 1) == nil
+	s, err := n.Snapshot()
+	if err != nil {
+		log.Fatalf("failed to read KMS state: %v", err)
+	}
+
+	if len(pipeArgs) == 0 && len(planeArgs) == 0 && len(propArgs) == 0 {
+		all := !*listConnectors && !*listEncoders && !*listPlanes && !*listFBs
+		l := lister{s}
+		if all || *listEncoders {
+			l.encoders()
+		}
+		if all || *listConnectors {
+			l.connectors()
+		}
+		if all || *listPlanes {
+			l.crtcs()
+			l.planes()
+		}
+		if all || *listFBs {
+			l.fbs()
+		}
+		return
+	}
+
+	if *atomic && !atomicOK {
+		log.Fatal("the device doesn't support the atomic API")
+	}
+	if *vsync && len(pipeArgs) == 0 {
+		log.Fatal("-v requires -s")
+	}
+
+	st := &state{n: n, s: s, atomic: *atomic, pattern: pattern}
+	defer st.cleanup()
+
+	for _, arg := range pipeArgs {
+		if err := st.parsePipe(arg); err != nil {
+			log.Fatalf("invalid mode %q: %v", arg, err)
+		}
+	}
+	if err := st.routePipes(); err != nil {
+		log.Fatal(err)
+	}
+	for _, arg := range planeArgs {
+		if err := st.parsePlane(arg); err != nil {
+			log.Fatalf("invalid plane %q: %v", arg, err)
+		}
+	}
+	for _, arg := range propArgs {
+		if err := st.parseProperty(arg); err != nil {
+			log.Fatalf("invalid property %q: %v", arg, err)
+		}
+	}
+
+	if err := st.commit(); err != nil {
+		log.Print(err)
+		return
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	if *vsync {
+		if err := st.flipLoop(*frames, interrupt); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	if len(st.pipes) > 0 || len(st.planes) > 0 {
+		fmt.Println("Press Enter or Ctrl+C to exit")
+		done := make(chan struct{})
+		go func() {
+			bufio.NewReader(os.Stdin).ReadString('\n')
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-interrupt:
+		}
+	}
+}
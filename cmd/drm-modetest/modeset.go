@@ -0,0 +1,534 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+// pipe is a CRTC driving one or more connectors, set up with -s.
+type pipe struct {
+	conns  []drm.ConnectorID
+	crtc   drm.CRTCID
+	mode   *drm.ModeModeInfo
+	format drm.Format
+
+	plane drm.PlaneID
+	// fbs[0] holds the test pattern, fbs[1] is only used by the page-flip
+	// loop
+	fbs     [2]*drm.DumbFramebuffer
+	front   int
+	pending bool // a page flip hasn't completed yet
+	stats   flipStats
+}
+
+// plane is an overlay plane set up with -P.
+type plane struct {
+	id     drm.PlaneID
+	crtc   drm.CRTCID
+	x, y   int32
+	w, h   uint32
+	scale  float64
+	format drm.Format
+	fb     *drm.DumbFramebuffer
+}
+
+// property is a property change requested with -w.
+type property struct {
+	obj   drm.AnyID
+	prop  drm.PropertyID
+	value uint64
+}
+
+type state struct {
+	n       *drm.Node
+	s       *drm.Snapshot
+	atomic  bool
+	pattern drm.Pattern
+
+	pipes  []*pipe
+	planes []*plane
+	props  []property
+}
+
+func (st *state) connector(id drm.ConnectorID) *drm.SnapshotConnector {
+	for i := range st.s.Connectors {
+		if st.s.Connectors[i].ID == id {
+			return &st.s.Connectors[i]
+		}
+	}
+	return nil
+}
+
+func (st *state) crtc(id drm.CRTCID) *drm.SnapshotCRTC {
+	for i := range st.s.CRTCs {
+		if st.s.CRTCs[i].ID == id {
+			return &st.s.CRTCs[i]
+		}
+	}
+	return nil
+}
+
+func (st *state) plane(id drm.PlaneID) *drm.SnapshotPlane {
+	for i := range st.s.Planes {
+		if st.s.Planes[i].ID == id {
+			return &st.s.Planes[i]
+		}
+	}
+	return nil
+}
+
+func (st *state) crtcIndex(id drm.CRTCID) int {
+	for i, crtc := range st.s.CRTCs {
+		if crtc.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseConnector accepts a connector ID or name.
+func (st *state) parseConnector(s string) (*drm.SnapshotConnector, error) {
+	for i := range st.s.Connectors {
+		if st.s.Connectors[i].Name == s {
+			return &st.s.Connectors[i], nil
+		}
+	}
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unknown connector %q", s)
+	}
+	conn := st.connector(drm.ConnectorID(id))
+	if conn == nil {
+		return nil, fmt.Errorf("unknown connector %v", id)
+	}
+	return conn, nil
+}
+
+func (st *state) parseCRTC(s string) (drm.CRTCID, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CRTC %q", s)
+	}
+	if st.crtc(drm.CRTCID(id)) == nil {
+		return 0, fmt.Errorf("unknown CRTC %v", id)
+	}
+	return drm.CRTCID(id), nil
+}
+
+// parseFormat accepts a fourcc code or a format name.
+func (st *state) parseFormat(s string) (drm.Format, error) {
+	var f drm.Format
+	if len(s) == 4 {
+		f = drm.Format(uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24)
+	}
+	for _, plane := range st.s.Planes {
+		for _, pf := range plane.Formats {
+			if pf == f || strings.EqualFold(pf.String(), s) {
+				f = pf
+			}
+		}
+	}
+	if f == 0 {
+		return 0, fmt.Errorf("unknown format %q", s)
+	}
+	if f.Info() == nil {
+		return 0, fmt.Errorf("format %v isn't supported for software rendering", formatName(f))
+	}
+	return f, nil
+}
+
+// parseMode picks a mode with "#<index>" or "<name>[-<vrefresh>]". An empty
+// string selects the preferred mode.
+func parseMode(conn *drm.SnapshotConnector, s string) (*drm.ModeModeInfo, error) {
+	if len(conn.Modes) == 0 {
+		return nil, fmt.Errorf("connector %v has no modes", conn.Name)
+	}
+
+	if s == "" {
+		for i := range conn.Modes {
+			if conn.Modes[i].Type&drm.ModeTypePreferred != 0 {
+				return &conn.Modes[i], nil
+			}
+		}
+		return &conn.Modes[0], nil
+	}
+
+	if strings.HasPrefix(s, "#") {
+		i, err := strconv.Atoi(s[1:])
+		if err != nil || i < 0 || i >= len(conn.Modes) {
+			return nil, fmt.Errorf("invalid mode index %q", s[1:])
+		}
+		return &conn.Modes[i], nil
+	}
+
+	name := s
+	var vrefresh float64
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		var err error
+		name = s[:i]
+		if vrefresh, err = strconv.ParseFloat(s[i+1:], 64); err != nil {
+			return nil, fmt.Errorf("invalid refresh rate %q", s[i+1:])
+		}
+	}
+	for i := range conn.Modes {
+		mode := &conn.Modes[i]
+		if mode.Name != name {
+			continue
+		}
+		// Allow e.g. "60" to select a 59.94 Hz mode
+		if vrefresh != 0 && math.Abs(mode.RefreshRate()-vrefresh) > 0.5 {
+			continue
+		}
+		return mode, nil
+	}
+	return nil, fmt.Errorf("connector %v has no mode %q", conn.Name, s)
+}
+
+// parsePipe parses a -s argument:
+// <connector>[,<connector>][@<crtc>][:<mode>][@<format>].
+func (st *state) parsePipe(arg string) error {
+	connsStr, modeStr := arg, ""
+	if i := strings.IndexByte(arg, ':'); i >= 0 {
+		connsStr, modeStr = arg[:i], arg[i+1:]
+	}
+
+	p := &pipe{format: drm.FormatXRGB8888}
+	if i := strings.IndexByte(connsStr, '@'); i >= 0 {
+		var err error
+		if p.crtc, err = st.parseCRTC(connsStr[i+1:]); err != nil {
+			return err
+		}
+		connsStr = connsStr[:i]
+	}
+	if i := strings.IndexByte(modeStr, '@'); i >= 0 {
+		var err error
+		if p.format, err = st.parseFormat(modeStr[i+1:]); err != nil {
+			return err
+		}
+		modeStr = modeStr[:i]
+	}
+
+	var first *drm.SnapshotConnector
+	for _, s := range strings.Split(connsStr, ",") {
+		conn, err := st.parseConnector(s)
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = conn
+		}
+		p.conns = append(p.conns, conn.ID)
+	}
+
+	var err error
+	if p.mode, err = parseMode(first, modeStr); err != nil {
+		return err
+	}
+
+	st.pipes = append(st.pipes, p)
+	return nil
+}
+
+// routePipes picks a CRTC for pipes which don't specify one, and a primary
+// plane for all pipes.
+func (st *state) routePipes() error {
+	var conns []drm.ConnectorID
+	for _, p := range st.pipes {
+		if p.crtc == 0 {
+			conns = append(conns, p.conns[0])
+		}
+	}
+
+	if len(conns) > 0 {
+		routes, err := st.n.SolveRoutes(conns)
+		if err != nil {
+			return err
+		}
+		i := 0
+		for _, p := range st.pipes {
+			if p.crtc == 0 {
+				p.crtc = routes[i].CRTC
+				i++
+			}
+		}
+	}
+
+	seen := make(map[drm.CRTCID]bool)
+	for _, p := range st.pipes {
+		if seen[p.crtc] {
+			return fmt.Errorf("CRTC %v is used by multiple pipes", p.crtc)
+		}
+		seen[p.crtc] = true
+		if p.plane = st.primaryPlane(p.crtc); p.plane == 0 {
+			return fmt.Errorf("no primary plane for CRTC %v", p.crtc)
+		}
+	}
+	return nil
+}
+
+// primaryPlane returns the primary plane of a CRTC, preferring the one
+// currently attached to it.
+func (st *state) primaryPlane(crtc drm.CRTCID) drm.PlaneID {
+	mask := uint32(1) << uint(st.crtcIndex(crtc))
+	var candidate drm.PlaneID
+	for _, plane := range st.s.Planes {
+		if plane.Properties["type"].Enum != "Primary" || plane.PossibleCRTCs&mask == 0 {
+			continue
+		}
+		if plane.CRTC == crtc {
+			return plane.ID
+		}
+		if candidate == 0 {
+			candidate = plane.ID
+		}
+	}
+	return candidate
+}
+
+// parsePlane parses a -P argument:
+// <plane>@<crtc>:<w>x<h>[+<x>+<y>][*<scale>][@<format>].
+func (st *state) parsePlane(arg string) error {
+	i := strings.IndexByte(arg, '@')
+	j := strings.IndexByte(arg, ':')
+	if i < 0 || j < i {
+		return fmt.Errorf("expected <plane>@<crtc>:<w>x<h>")
+	}
+
+	pl := &plane{scale: 1, format: drm.FormatXRGB8888}
+	id, err := strconv.ParseUint(arg[:i], 10, 32)
+	if err != nil || st.plane(drm.PlaneID(id)) == nil {
+		return fmt.Errorf("unknown plane %q", arg[:i])
+	}
+	pl.id = drm.PlaneID(id)
+	if pl.crtc, err = st.parseCRTC(arg[i+1 : j]); err != nil {
+		return err
+	}
+
+	geom := arg[j+1:]
+	if k := strings.IndexByte(geom, '@'); k >= 0 {
+		if pl.format, err = st.parseFormat(geom[k+1:]); err != nil {
+			return err
+		}
+		geom = geom[:k]
+	}
+	if k := strings.IndexByte(geom, '*'); k >= 0 {
+		if pl.scale, err = strconv.ParseFloat(geom[k+1:], 64); err != nil || pl.scale <= 0 {
+			return fmt.Errorf("invalid scale %q", geom[k+1:])
+		}
+		geom = geom[:k]
+	}
+	if k := strings.IndexByte(geom, '+'); k >= 0 {
+		if _, err := fmt.Sscanf(geom[k:], "+%d+%d", &pl.x, &pl.y); err != nil {
+			return fmt.Errorf("invalid position %q", geom[k:])
+		}
+		geom = geom[:k]
+	}
+	if _, err := fmt.Sscanf(geom, "%dx%d", &pl.w, &pl.h); err != nil || pl.w == 0 || pl.h == 0 {
+		return fmt.Errorf("invalid size %q", geom)
+	}
+
+	st.planes = append(st.planes, pl)
+	return nil
+}
+
+// parseProperty parses a -w argument: <object>:<property>:<value>.
+func (st *state) parseProperty(arg string) error {
+	fields := strings.SplitN(arg, ":", 3)
+	if len(fields) != 3 {
+		return fmt.Errorf("expected <object>:<property>:<value>")
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid object ID %q", fields[0])
+	}
+
+	var obj drm.AnyID
+	var props map[string]drm.SnapshotProperty
+	if conn := st.connector(drm.ConnectorID(id)); conn != nil {
+		obj, props = conn.ID, conn.Properties
+	} else if crtc := st.crtc(drm.CRTCID(id)); crtc != nil {
+		obj, props = crtc.ID, crtc.Properties
+	} else if plane := st.plane(drm.PlaneID(id)); plane != nil {
+		obj, props = plane.ID, plane.Properties
+	} else {
+		return fmt.Errorf("unknown object %v", id)
+	}
+
+	prop, ok := props[fields[1]]
+	if !ok {
+		return fmt.Errorf("object %v has no property %q", id, fields[1])
+	}
+	if prop.Immutable {
+		return fmt.Errorf("property %q is immutable", fields[1])
+	}
+
+	var value uint64
+	found := false
+	for _, e := range prop.Enums {
+		if e.Name == fields[2] {
+			value, found = e.Value, true
+		}
+	}
+	if !found {
+		v, err := strconv.ParseInt(fields[2], 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", fields[2])
+		}
+		value = uint64(v)
+	}
+
+	st.props = append(st.props, property{obj, prop.ID, value})
+	return nil
+}
+
+func (st *state) createFB(format drm.Format, width, height int, pattern drm.Pattern) (*drm.DumbFramebuffer, error) {
+	fb, err := st.n.CreateDumbFramebuffer(format, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %vx%v %v framebuffer: %v", width, height, formatName(format), err)
+	}
+	if err := drm.FillPattern(fb.Pixels, pattern); err != nil {
+		st.n.DestroyDumbFramebuffer(fb)
+		return nil, err
+	}
+	return fb, nil
+}
+
+// commit allocates framebuffers and applies the requested configuration.
+func (st *state) commit() error {
+	for _, p := range st.pipes {
+		fb, err := st.createFB(p.format, int(p.mode.HDisplay), int(p.mode.VDisplay), st.pattern)
+		if err != nil {
+			return err
+		}
+		p.fbs[0] = fb
+	}
+	for _, pl := range st.planes {
+		fb, err := st.createFB(pl.format, int(pl.w), int(pl.h), st.pattern)
+		if err != nil {
+			return err
+		}
+		pl.fb = fb
+	}
+
+	if st.atomic {
+		return st.commitAtomic()
+	}
+	return st.commitLegacy()
+}
+
+func (st *state) commitLegacy() error {
+	for _, p := range st.pipes {
+		if err := st.n.ModeSetCRTC(p.crtc, p.fbs[0].ID, 0, 0, p.conns, p.mode); err != nil {
+			return fmt.Errorf("failed to set mode on CRTC %v: %v", p.crtc, err)
+		}
+	}
+	for _, pl := range st.planes {
+		err := st.n.ModeSetPlane(&drm.ModeSetPlane{
+			Plane: pl.id,
+			CRTC:  pl.crtc,
+			FB:    pl.fb.ID,
+			CRTCX: pl.x,
+			CRTCY: pl.y,
+			CRTCW: uint32(float64(pl.w) * pl.scale),
+			CRTCH: uint32(float64(pl.h) * pl.scale),
+			SrcW:  pl.w << 16,
+			SrcH:  pl.h << 16,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set plane %v: %v", pl.id, err)
+		}
+	}
+	for _, prop := range st.props {
+		if err := st.n.ModeObjectSetProperty(prop.obj, prop.prop, prop.value); err != nil {
+			return fmt.Errorf("failed to set property %v of object %v: %v", prop.prop, prop.obj.Object(), err)
+		}
+	}
+	return nil
+}
+
+// atomicRequest wraps an AtomicRequest to add properties by name.
+type atomicRequest struct {
+	drm.AtomicRequest
+	err error
+}
+
+func (req *atomicRequest) set(obj drm.AnyID, props map[string]drm.SnapshotProperty, name string, value uint64) {
+	prop, ok := props[name]
+	if !ok {
+		if req.err == nil {
+			req.err = fmt.Errorf("object %v has no property %q", obj.Object(), name)
+		}
+		return
+	}
+	req.Add(obj, prop.ID, value)
+}
+
+// setPlane adds the properties needed to display a whole framebuffer on a
+// plane.
+func (req *atomicRequest) setPlane(plane *drm.SnapshotPlane, crtc drm.CRTCID, fb *drm.DumbFramebuffer, x, y int32, w, h uint32) {
+	props := plane.Properties
+	req.set(plane.ID, props, "FB_ID", uint64(fb.ID))
+	req.set(plane.ID, props, "CRTC_ID", uint64(crtc))
+	req.set(plane.ID, props, "SRC_X", 0)
+	req.set(plane.ID, props, "SRC_Y", 0)
+	req.set(plane.ID, props, "SRC_W", uint64(fb.Pixels.Width)<<16)
+	req.set(plane.ID, props, "SRC_H", uint64(fb.Pixels.Height)<<16)
+	req.set(plane.ID, props, "CRTC_X", uint64(int64(x)))
+	req.set(plane.ID, props, "CRTC_Y", uint64(int64(y)))
+	req.set(plane.ID, props, "CRTC_W", uint64(w))
+	req.set(plane.ID, props, "CRTC_H", uint64(h))
+}
+
+func (st *state) commitAtomic() error {
+	var req atomicRequest
+	for _, p := range st.pipes {
+		blob, err := st.n.ModeCreateBlob(p.mode.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to create mode blob: %v", err)
+		}
+		crtc := st.crtc(p.crtc)
+		req.set(crtc.ID, crtc.Properties, "MODE_ID", uint64(blob))
+		req.set(crtc.ID, crtc.Properties, "ACTIVE", 1)
+		for _, id := range p.conns {
+			conn := st.connector(id)
+			req.set(conn.ID, conn.Properties, "CRTC_ID", uint64(p.crtc))
+		}
+		req.setPlane(st.plane(p.plane), p.crtc, p.fbs[0], 0, 0, uint32(p.mode.HDisplay), uint32(p.mode.VDisplay))
+	}
+	for _, pl := range st.planes {
+		w, h := uint32(float64(pl.w)*pl.scale), uint32(float64(pl.h)*pl.scale)
+		req.setPlane(st.plane(pl.id), pl.crtc, pl.fb, pl.x, pl.y, w, h)
+	}
+	for _, prop := range st.props {
+		req.Add(prop.obj, prop.prop, prop.value)
+	}
+	if req.err != nil {
+		return req.err
+	}
+
+	if err := st.n.ModeAtomicCommit(&req.AtomicRequest, drm.AtomicAllowModeset, 0); err != nil {
+		return fmt.Errorf("atomic commit failed: %v", err)
+	}
+	return nil
+}
+
+// cleanup releases framebuffers. The kernel disables the planes and CRTCs
+// scanning them out.
+func (st *state) cleanup() {
+	for _, p := range st.pipes {
+		for _, fb := range p.fbs {
+			if fb != nil {
+				st.n.DestroyDumbFramebuffer(fb)
+			}
+		}
+	}
+	for _, pl := range st.planes {
+		if pl.fb != nil {
+			st.n.DestroyDumbFramebuffer(pl.fb)
+		}
+	}
+}
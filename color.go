@@ -0,0 +1,382 @@
+package drm
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+// ColorLUTEntry is an entry of a gamma or degamma LUT. Components are 16-bit.
+type ColorLUTEntry struct {
+	Red, Green, Blue uint16
+}
+
+// ColorLUT is a color lookup table, as used by the legacy gamma ioctls and the
+// GAMMA_LUT and DEGAMMA_LUT properties.
+type ColorLUT []ColorLUTEntry
+
+const colorLUTEntrySize = 8
+
+// ParseColorLUT decodes a GAMMA_LUT or DEGAMMA_LUT blob, an array of
+// struct drm_color_lut.
+func ParseColorLUT(b []byte) (ColorLUT, error) {
+	if len(b)%colorLUTEntrySize != 0 {
+		return nil, &BlobError{"GAMMA_LUT", "size", "not a multiple of the LUT entry size"}
+	}
+
+	var lut ColorLUT
+	if len(b) > 0 {
+		lut = make(ColorLUT, len(b)/colorLUTEntrySize)
+		for i := range lut {
+			off := i * colorLUTEntrySize
+			lut[i] = ColorLUTEntry{
+				Red:   nativeEndian.Uint16(b[off : off+2]),
+				Green: nativeEndian.Uint16(b[off+2 : off+4]),
+				Blue:  nativeEndian.Uint16(b[off+4 : off+6]),
+			}
+		}
+	}
+	return lut, nil
+}
+
+// Bytes encodes the LUT into a GAMMA_LUT or DEGAMMA_LUT blob.
+func (lut ColorLUT) Bytes() []byte {
+	b := make([]byte, len(lut)*colorLUTEntrySize)
+	for i, e := range lut {
+		off := i * colorLUTEntrySize
+		nativeEndian.PutUint16(b[off:off+2], e.Red)
+		nativeEndian.PutUint16(b[off+2:off+4], e.Green)
+		nativeEndian.PutUint16(b[off+4:off+6], e.Blue)
+	}
+	return b
+}
+
+func newLUTComponent(v float64) uint16 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return math.MaxUint16
+	}
+	return uint16(math.Round(v * math.MaxUint16))
+}
+
+// NewColorLUT builds a LUT by sampling f on [0, 1]. The components returned by
+// f are clamped to [0, 1].
+func NewColorLUT(size int, f func(x float64) (r, g, b float64)) ColorLUT {
+	lut := make(ColorLUT, size)
+	for i := range lut {
+		x := 0.0
+		if size > 1 {
+			x = float64(i) / float64(size-1)
+		}
+		r, g, b := f(x)
+		lut[i] = ColorLUTEntry{
+			Red:   newLUTComponent(r),
+			Green: newLUTComponent(g),
+			Blue:  newLUTComponent(b),
+		}
+	}
+	return lut
+}
+
+// NewGammaLUT builds a LUT applying a gamma exponent, like xgamma: each
+// component x is mapped to x^(1/gamma).
+func NewGammaLUT(size int, gamma float64) ColorLUT {
+	return NewColorLUT(size, func(x float64) (r, g, b float64) {
+		v := math.Pow(x, 1/gamma)
+		return v, v, v
+	})
+}
+
+// NewColorTemperatureLUT builds a linear LUT scaled to the white point of a
+// color temperature in Kelvin. 6500K is neutral, lower temperatures are
+// warmer.
+func NewColorTemperatureLUT(size int, kelvin float64) ColorLUT {
+	wr, wg, wb := ColorTemperature(kelvin)
+	return NewColorLUT(size, func(x float64) (r, g, b float64) {
+		return x * wr, x * wg, x * wb
+	})
+}
+
+// blackbody approximates the color of a black body, with Tanner Helland's
+// fit of the CIE 1964 10-degree color matching functions.
+func blackbody(kelvin float64) (r, g, b float64) {
+	t := kelvin / 100
+
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	if t >= 66 {
+		b = 255
+	} else if t <= 19 {
+		b = 0
+	} else {
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	clamp := func(v float64) float64 {
+		return math.Max(0, math.Min(255, v)) / 255
+	}
+	return clamp(r), clamp(g), clamp(b)
+}
+
+// ColorTemperature returns the RGB multipliers of the white point of a color
+// temperature in Kelvin, normalized so that 6500K is (1, 1, 1). The
+// temperature is clamped to [1000, 25000].
+func ColorTemperature(kelvin float64) (r, g, b float64) {
+	kelvin = math.Max(1000, math.Min(25000, kelvin))
+	nr, ng, nb := blackbody(6500)
+	r, g, b = blackbody(kelvin)
+	return math.Min(1, r/nr), math.Min(1, g/ng), math.Min(1, b/nb)
+}
+
+// ColorMatrix is a 3x3 color transformation matrix in row-major order, as
+// used by the CTM property. Output colors are computed as M * [R G B]^T.
+type ColorMatrix [9]float64
+
+// IdentityColorMatrix leaves colors unchanged.
+var IdentityColorMatrix = ColorMatrix{
+	1, 0, 0,
+	0, 1, 0,
+	0, 0, 1,
+}
+
+const colorMatrixSize = 9 * 8
+
+// ParseColorMatrix decodes a CTM blob, a struct drm_color_ctm containing
+// S31.32 sign-magnitude fixed-point coefficients.
+func ParseColorMatrix(b []byte) (*ColorMatrix, error) {
+	if len(b) != colorMatrixSize {
+		return nil, &BlobError{"CTM", "size", fmt.Sprintf("got %v bytes, want %v", len(b), colorMatrixSize)}
+	}
+
+	var m ColorMatrix
+	for i := range m {
+		v := nativeEndian.Uint64(b[8*i : 8*i+8])
+		f := float64(v&^(1<<63)) / (1 << 32)
+		if v&(1<<63) != 0 {
+			f = -f
+		}
+		m[i] = f
+	}
+	return &m, nil
+}
+
+// Bytes encodes the matrix into a CTM blob. Coefficients are clamped to the
+// range representable in S31.32.
+func (m *ColorMatrix) Bytes() []byte {
+	b := make([]byte, colorMatrixSize)
+	for i, f := range m {
+		var sign uint64
+		if f < 0 {
+			sign = 1 << 63
+			f = -f
+		}
+		var v uint64
+		if f >= (1 << 31) {
+			v = 1<<63 - 1
+		} else if f > 0 {
+			v = uint64(math.Round(f * (1 << 32)))
+		}
+		nativeEndian.PutUint64(b[8*i:8*i+8], sign|v)
+	}
+	return b
+}
+
+// ModeGetGamma returns the CRTC's legacy gamma ramp.
+func (n *Node) ModeGetGamma(id CRTCID) (ColorLUT, error) {
+	crtc, err := n.ModeGetCRTC(id)
+	if err != nil {
+		return nil, err
+	}
+	if crtc.GammaSize == 0 {
+		return nil, nil
+	}
+
+	size := crtc.GammaSize
+	red := make([]uint16, size)
+	green := make([]uint16, size)
+	blue := make([]uint16, size)
+	r := uapi.ModeCRTCLUT{
+		CRTCID:    uint32(id),
+		GammaSize: size,
+		Red:       uapi.NewPtr(unsafe.Pointer(&red[0])),
+		Green:     uapi.NewPtr(unsafe.Pointer(&green[0])),
+		Blue:      uapi.NewPtr(unsafe.Pointer(&blue[0])),
+	}
+	if err := modeGetGamma(n.backend, &r); err != nil {
+		return nil, err
+	}
+
+	lut := make(ColorLUT, size)
+	for i := range lut {
+		lut[i] = ColorLUTEntry{red[i], green[i], blue[i]}
+	}
+	return lut, nil
+}
+
+// ModeSetGamma sets the CRTC's legacy gamma ramp. The LUT size must match the
+// CRTC's gamma size.
+func (n *Node) ModeSetGamma(id CRTCID, lut ColorLUT) error {
+	if len(lut) == 0 {
+		return fmt.Errorf("drm: empty gamma LUT")
+	}
+
+	red := make([]uint16, len(lut))
+	green := make([]uint16, len(lut))
+	blue := make([]uint16, len(lut))
+	for i, e := range lut {
+		red[i], green[i], blue[i] = e.Red, e.Green, e.Blue
+	}
+	r := uapi.ModeCRTCLUT{
+		CRTCID:    uint32(id),
+		GammaSize: uint32(len(lut)),
+		Red:       uapi.NewPtr(unsafe.Pointer(&red[0])),
+		Green:     uapi.NewPtr(unsafe.Pointer(&green[0])),
+		Blue:      uapi.NewPtr(unsafe.Pointer(&blue[0])),
+	}
+	err := modeSetGamma(n.backend, &r)
+	runtime.KeepAlive(red)
+	runtime.KeepAlive(green)
+	runtime.KeepAlive(blue)
+	return err
+}
+
+// ModeCRTCColor describes the color management properties of a CRTC. LUT sizes
+// are zero if the CRTC doesn't support the LUT. LUTs and CTM are nil if unset.
+type ModeCRTCColor struct {
+	GammaLUTSize   int
+	DegammaLUTSize int
+	HasCTM         bool
+
+	GammaLUT   ColorLUT
+	DegammaLUT ColorLUT
+	CTM        *ColorMatrix
+}
+
+// ModeGetCRTCColor returns the color management properties of a CRTC.
+func (n *Node) ModeGetCRTCColor(id CRTCID) (*ModeCRTCColor, error) {
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var color ModeCRTCColor
+	if prop, ok := props["GAMMA_LUT_SIZE"]; ok {
+		color.GammaLUTSize = int(prop.Value)
+	}
+	if prop, ok := props["DEGAMMA_LUT_SIZE"]; ok {
+		color.DegammaLUTSize = int(prop.Value)
+	}
+
+	getBlob := func(name string) ([]byte, error) {
+		prop, ok := props[name]
+		if !ok || prop.Value == 0 {
+			return nil, nil
+		}
+		return n.ModeGetBlob(BlobID(prop.Value))
+	}
+
+	if b, err := getBlob("GAMMA_LUT"); err != nil {
+		return nil, err
+	} else if b != nil {
+		if color.GammaLUT, err = ParseColorLUT(b); err != nil {
+			return nil, err
+		}
+	}
+	if b, err := getBlob("DEGAMMA_LUT"); err != nil {
+		return nil, err
+	} else if b != nil {
+		if color.DegammaLUT, err = ParseColorLUT(b); err != nil {
+			return nil, err
+		}
+	}
+
+	_, color.HasCTM = props["CTM"]
+	if b, err := getBlob("CTM"); err != nil {
+		return nil, err
+	} else if b != nil {
+		if color.CTM, err = ParseColorMatrix(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return &color, nil
+}
+
+// ModeSetCRTCGammaLUT sets the CRTC's GAMMA_LUT property with a legacy
+// property update. The LUT size must match GAMMA_LUT_SIZE. A nil LUT disables
+// gamma correction.
+func (n *Node) ModeSetCRTCGammaLUT(id CRTCID, lut ColorLUT) error {
+	return n.setCRTCLUT(id, "GAMMA_LUT", lut)
+}
+
+// ModeSetCRTCDegammaLUT sets the CRTC's DEGAMMA_LUT property, see
+// ModeSetCRTCGammaLUT.
+func (n *Node) ModeSetCRTCDegammaLUT(id CRTCID, lut ColorLUT) error {
+	return n.setCRTCLUT(id, "DEGAMMA_LUT", lut)
+}
+
+// ModeSetCRTCCTM sets the CRTC's CTM property with a legacy property update.
+// A nil matrix disables color transformation.
+func (n *Node) ModeSetCRTCCTM(id CRTCID, m *ColorMatrix) error {
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if m != nil {
+		b = m.Bytes()
+	}
+	return n.setBlobProperty(id, props, "CTM", b)
+}
+
+func (n *Node) setCRTCLUT(id CRTCID, name string, lut ColorLUT) error {
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return err
+	}
+	if lut == nil {
+		return n.setBlobProperty(id, props, name, nil)
+	}
+
+	size, ok := props[name+"_SIZE"]
+	if !ok {
+		return fmt.Errorf("drm: CRTC %v doesn't support %v", id, name)
+	}
+	if uint64(len(lut)) != size.Value {
+		return fmt.Errorf("drm: %v has %v entries, want %v", name, len(lut), size.Value)
+	}
+	return n.setBlobProperty(id, props, name, lut.Bytes())
+}
+
+// setBlobProperty sets a blob property to a new blob containing data, or to
+// zero if data is nil.
+func (n *Node) setBlobProperty(id AnyID, props map[string]modeObjectProperty, name string, data []byte) error {
+	prop, ok := props[name]
+	if !ok {
+		return fmt.Errorf("drm: object %v has no %v property", id.Object(), name)
+	}
+
+	if data == nil {
+		return n.ModeObjectSetProperty(id, prop.ID, 0)
+	}
+
+	blob, err := n.ModeCreateBlob(data)
+	if err != nil {
+		return err
+	}
+	// The property holds a reference to the blob
+	defer n.ModeDestroyBlob(blob)
+
+	return n.ModeObjectSetProperty(id, prop.ID, uint64(blob))
+}
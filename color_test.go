@@ -0,0 +1,69 @@
+package drm_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func TestColorMatrix(t *testing.T) {
+	m := drm.ColorMatrix{
+		1, 0, 0,
+		0, -1.5, 0,
+		0.25, 0, 2,
+	}
+	b := m.Bytes()
+
+	// S31.32 sign-magnitude
+	want := map[int]uint64{
+		0: 1 << 32,
+		4: 1<<63 | 3<<31,
+		6: 1 << 30,
+		8: 2 << 32,
+	}
+	for i, v := range want {
+		// Check both byte orders, the blob uses the native one
+		le, be := binary.LittleEndian.Uint64(b[8*i:]), binary.BigEndian.Uint64(b[8*i:])
+		if le != v && be != v {
+			t.Errorf("CTM coefficient %v = %#x, want %#x", i, le, v)
+		}
+	}
+
+	parsed, err := drm.ParseColorMatrix(b)
+	if err != nil {
+		t.Fatalf("ParseColorMatrix() = %v", err)
+	}
+	if *parsed != m {
+		t.Errorf("ParseColorMatrix() = %v, want %v", *parsed, m)
+	}
+
+	if _, err := drm.ParseColorMatrix(b[:64]); err == nil {
+		t.Errorf("ParseColorMatrix() succeeded on a truncated blob")
+	}
+}
+
+func TestColorLUT(t *testing.T) {
+	lut := drm.NewGammaLUT(3, 1)
+	want := drm.ColorLUT{{0, 0, 0}, {0x8000, 0x8000, 0x8000}, {0xFFFF, 0xFFFF, 0xFFFF}}
+	if !reflect.DeepEqual(lut, want) {
+		t.Errorf("NewGammaLUT() = %v, want %v", lut, want)
+	}
+
+	parsed, err := drm.ParseColorLUT(lut.Bytes())
+	if err != nil {
+		t.Fatalf("ParseColorLUT() = %v", err)
+	}
+	if !reflect.DeepEqual(parsed, lut) {
+		t.Errorf("ParseColorLUT() = %v, want %v", parsed, lut)
+	}
+
+	if r, g, b := drm.ColorTemperature(6500); r != 1 || g != 1 || b != 1 {
+		t.Errorf("ColorTemperature(6500) = %v, %v, %v, want 1, 1, 1", r, g, b)
+	}
+	warm := drm.NewColorTemperatureLUT(2, 3000)[1]
+	if warm.Red != 0xFFFF || warm.Blue >= warm.Green || warm.Green >= warm.Red {
+		t.Errorf("NewColorTemperatureLUT(3000) white = %+v, want warmer", warm)
+	}
+}
@@ -0,0 +1,377 @@
+package drm
+
+import (
+	"fmt"
+)
+
+// ConnectorProperties provides typed access to the standard properties of a
+// connector. Getters return false if the connector doesn't have the property
+// or if its value is unknown. Setters issue legacy property updates.
+type ConnectorProperties struct {
+	n     *Node
+	id    ConnectorID
+	props map[string]modeObjectProperty
+}
+
+// ModeGetConnectorProperties retrieves the properties of a connector.
+func (n *Node) ModeGetConnectorProperties(id ConnectorID) (*ConnectorProperties, error) {
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return nil, err
+	}
+	return &ConnectorProperties{n: n, id: id, props: props}, nil
+}
+
+// Has checks whether the connector has a property.
+func (p *ConnectorProperties) Has(name string) bool {
+	_, ok := p.props[name]
+	return ok
+}
+
+// enum returns the name of the current value of an enum property.
+func (p *ConnectorProperties) enum(name string) (string, bool) {
+	prop, ok := p.props[name]
+	if !ok {
+		return "", false
+	}
+	enums, _ := prop.Enums()
+	for _, e := range enums {
+		if e.Value == prop.Value {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
+
+// enumNames returns the names of the values supported by an enum property.
+func (p *ConnectorProperties) enumNames(name string) []string {
+	prop, ok := p.props[name]
+	if !ok {
+		return nil
+	}
+	enums, _ := prop.Enums()
+	names := make([]string, len(enums))
+	for i, e := range enums {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func (p *ConnectorProperties) set(name string, value uint64) error {
+	prop, ok := p.props[name]
+	if !ok {
+		return fmt.Errorf("drm: connector %v has no %q property", p.id, name)
+	}
+	if err := p.n.ModeObjectSetProperty(p.id, prop.ID, value); err != nil {
+		return err
+	}
+	prop.Value = value
+	p.props[name] = prop
+	return nil
+}
+
+// setEnum sets an enum property by name. Enum values are driver-specific, so
+// they're looked up in the property.
+func (p *ConnectorProperties) setEnum(name, enumName string) error {
+	prop, ok := p.props[name]
+	if !ok {
+		return fmt.Errorf("drm: connector %v has no %q property", p.id, name)
+	}
+	enums, _ := prop.Enums()
+	for _, e := range enums {
+		if e.Name == enumName {
+			return p.set(name, e.Value)
+		}
+	}
+	return fmt.Errorf("drm: connector %v doesn't support %q for property %q", p.id, enumName, name)
+}
+
+func (p *ConnectorProperties) rangeValue(name string) (uint64, bool) {
+	prop, ok := p.props[name]
+	return prop.Value, ok
+}
+
+func (p *ConnectorProperties) Colorspace() (Colorspace, bool) {
+	name, ok := p.enum("Colorspace")
+	if !ok {
+		return 0, false
+	}
+	return parseColorspace(name)
+}
+
+func (p *ConnectorProperties) SupportedColorspaces() []Colorspace {
+	var l []Colorspace
+	for _, name := range p.enumNames("Colorspace") {
+		if cs, ok := parseColorspace(name); ok {
+			l = append(l, cs)
+		}
+	}
+	return l
+}
+
+func (p *ConnectorProperties) SetColorspace(cs Colorspace) error {
+	return p.setEnum("Colorspace", cs.String())
+}
+
+// MaxBPC returns the maximum bits per color channel requested for the
+// connector.
+func (p *ConnectorProperties) MaxBPC() (uint64, bool) {
+	return p.rangeValue("max bpc")
+}
+
+// MaxBPCRange returns the bounds supported by the "max bpc" property.
+func (p *ConnectorProperties) MaxBPCRange() (min, max uint64, ok bool) {
+	prop, ok := p.props["max bpc"]
+	if !ok {
+		return 0, 0, false
+	}
+	return prop.Range()
+}
+
+func (p *ConnectorProperties) SetMaxBPC(bpc uint64) error {
+	return p.set("max bpc", bpc)
+}
+
+func (p *ConnectorProperties) BroadcastRGB() (BroadcastRGB, bool) {
+	name, ok := p.enum("Broadcast RGB")
+	if !ok {
+		return 0, false
+	}
+	return parseBroadcastRGB(name)
+}
+
+func (p *ConnectorProperties) SetBroadcastRGB(v BroadcastRGB) error {
+	return p.setEnum("Broadcast RGB", v.String())
+}
+
+func (p *ConnectorProperties) ContentType() (ContentType, bool) {
+	name, ok := p.enum("content type")
+	if !ok {
+		return 0, false
+	}
+	return parseContentType(name)
+}
+
+func (p *ConnectorProperties) SetContentType(t ContentType) error {
+	return p.setEnum("content type", t.String())
+}
+
+func (p *ConnectorProperties) ContentProtection() (ContentProtection, bool) {
+	name, ok := p.enum("Content Protection")
+	if !ok {
+		return 0, false
+	}
+	return parseContentProtection(name)
+}
+
+// SetContentProtection requests HDCP. Only ContentProtectionUndesired and
+// ContentProtectionDesired can be set, the driver switches to
+// ContentProtectionEnabled once the link is protected.
+func (p *ConnectorProperties) SetContentProtection(cp ContentProtection) error {
+	return p.setEnum("Content Protection", cp.String())
+}
+
+func (p *ConnectorProperties) HDCPContentType() (HDCPContentType, bool) {
+	name, ok := p.enum("HDCP Content Type")
+	if !ok {
+		return 0, false
+	}
+	return parseHDCPContentType(name)
+}
+
+func (p *ConnectorProperties) SetHDCPContentType(t HDCPContentType) error {
+	return p.setEnum("HDCP Content Type", t.String())
+}
+
+func (p *ConnectorProperties) ScalingMode() (ScalingMode, bool) {
+	name, ok := p.enum("scaling mode")
+	if !ok {
+		return 0, false
+	}
+	return parseScalingMode(name)
+}
+
+func (p *ConnectorProperties) SupportedScalingModes() []ScalingMode {
+	var l []ScalingMode
+	for _, name := range p.enumNames("scaling mode") {
+		if m, ok := parseScalingMode(name); ok {
+			l = append(l, m)
+		}
+	}
+	return l
+}
+
+func (p *ConnectorProperties) SetScalingMode(m ScalingMode) error {
+	return p.setEnum("scaling mode", m.String())
+}
+
+func (p *ConnectorProperties) Underscan() (Underscan, bool) {
+	name, ok := p.enum("underscan")
+	if !ok {
+		return 0, false
+	}
+	return parseUnderscan(name)
+}
+
+func (p *ConnectorProperties) SetUnderscan(u Underscan) error {
+	return p.setEnum("underscan", u.String())
+}
+
+// UnderscanBorders returns the horizontal and vertical underscan borders, in
+// pixels.
+func (p *ConnectorProperties) UnderscanBorders() (h, v uint64, ok bool) {
+	h, okH := p.rangeValue("underscan hborder")
+	v, okV := p.rangeValue("underscan vborder")
+	return h, v, okH && okV
+}
+
+func (p *ConnectorProperties) SetUnderscanBorders(h, v uint64) error {
+	if err := p.set("underscan hborder", h); err != nil {
+		return err
+	}
+	return p.set("underscan vborder", v)
+}
+
+// PanelOrientation returns the mounting orientation of a built-in panel.
+func (p *ConnectorProperties) PanelOrientation() (PanelOrientation, bool) {
+	name, ok := p.enum("panel orientation")
+	if !ok {
+		return 0, false
+	}
+	return parsePanelOrientation(name)
+}
+
+// PrivacyScreen returns the privacy screen state requested by software.
+func (p *ConnectorProperties) PrivacyScreen() (PrivacyScreen, bool) {
+	name, ok := p.enum("privacy-screen sw-state")
+	if !ok {
+		return 0, false
+	}
+	return parsePrivacyScreen(name)
+}
+
+// PrivacyScreenHW returns the actual privacy screen state, which may be
+// locked by a hardware switch.
+func (p *ConnectorProperties) PrivacyScreenHW() (PrivacyScreen, bool) {
+	name, ok := p.enum("privacy-screen hw-state")
+	if !ok {
+		return 0, false
+	}
+	return parsePrivacyScreen(name)
+}
+
+// SetPrivacyScreen requests a privacy screen state. Only
+// PrivacyScreenDisabled and PrivacyScreenEnabled can be set.
+func (p *ConnectorProperties) SetPrivacyScreen(s PrivacyScreen) error {
+	return p.setEnum("privacy-screen sw-state", s.String())
+}
+
+// VRRCapable checks whether the sink supports variable refresh rate.
+func (p *ConnectorProperties) VRRCapable() bool {
+	v, ok := p.rangeValue("vrr_capable")
+	return ok && v != 0
+}
+
+func (p *ConnectorProperties) LinkStatus() (LinkStatus, bool) {
+	name, ok := p.enum("link-status")
+	if !ok {
+		return 0, false
+	}
+	return parseLinkStatus(name)
+}
+
+// SetLinkStatus resets the link status. Only LinkStatusGood can be set, after
+// the link has been retrained with a new modeset.
+func (p *ConnectorProperties) SetLinkStatus(s LinkStatus) error {
+	return p.setEnum("link-status", s.String())
+}
+
+func parseColorspace(name string) (Colorspace, bool) {
+	for cs := ColorspaceDefault; cs <= ColorspaceBT601YCC; cs++ {
+		if cs.String() == name {
+			return cs, true
+		}
+	}
+	return 0, false
+}
+
+func parseBroadcastRGB(name string) (BroadcastRGB, bool) {
+	for _, v := range []BroadcastRGB{BroadcastRGBAutomatic, BroadcastRGBFull, BroadcastRGBLimited} {
+		if v.String() == name {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func parseContentType(name string) (ContentType, bool) {
+	for t := ContentTypeNoData; t <= ContentTypeGame; t++ {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func parseContentProtection(name string) (ContentProtection, bool) {
+	for _, cp := range []ContentProtection{ContentProtectionUndesired, ContentProtectionDesired, ContentProtectionEnabled} {
+		if cp.String() == name {
+			return cp, true
+		}
+	}
+	return 0, false
+}
+
+func parseHDCPContentType(name string) (HDCPContentType, bool) {
+	for _, t := range []HDCPContentType{HDCPContentType0, HDCPContentType1} {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func parseScalingMode(name string) (ScalingMode, bool) {
+	for _, m := range []ScalingMode{ScalingModeNone, ScalingModeFull, ScalingModeCenter, ScalingModeFullAspect} {
+		if m.String() == name {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func parseUnderscan(name string) (Underscan, bool) {
+	for _, u := range []Underscan{UnderscanOff, UnderscanOn, UnderscanAuto} {
+		if u.String() == name {
+			return u, true
+		}
+	}
+	return 0, false
+}
+
+func parsePanelOrientation(name string) (PanelOrientation, bool) {
+	for _, o := range []PanelOrientation{PanelOrientationNormal, PanelOrientationUpsideDown, PanelOrientationLeftSideUp, PanelOrientationRightSideUp} {
+		if o.String() == name {
+			return o, true
+		}
+	}
+	return 0, false
+}
+
+func parsePrivacyScreen(name string) (PrivacyScreen, bool) {
+	for _, s := range []PrivacyScreen{PrivacyScreenDisabled, PrivacyScreenEnabled, PrivacyScreenDisabledLocked, PrivacyScreenEnabledLocked} {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func parseLinkStatus(name string) (LinkStatus, bool) {
+	for _, s := range []LinkStatus{LinkStatusGood, LinkStatusBad} {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
@@ -1,5 +1,9 @@
 package drm
 
+import (
+	"strings"
+)
+
 type NodeType int
 
 const (
@@ -62,6 +66,7 @@ const (
 	CapCRTCInVBlankEvent   Cap = 0x12
 	CapSyncObj             Cap = 0x13
 	CapSyncObjTimeline     Cap = 0x14
+	CapAtomicAsyncPageFlip Cap = 0x15
 )
 
 func (c Cap) String() string {
@@ -94,6 +99,8 @@ func (c Cap) String() string {
 		return "SYNCOBJ"
 	case CapSyncObjTimeline:
 		return "SYNCOBJ_TIMELINE"
+	case CapAtomicAsyncPageFlip:
+		return "ATOMIC_ASYNC_PAGE_FLIP"
 	}
 	return "unknown"
 }
@@ -106,6 +113,7 @@ const (
 	ClientCapAtomic              ClientCap = 3
 	ClientCapAspectRatio         ClientCap = 4
 	ClientCapWritebackConnectors ClientCap = 5
+	ClientCapCursorPlaneHotspot  ClientCap = 6
 )
 
 func (c ClientCap) String() string {
@@ -117,9 +125,11 @@ func (c ClientCap) String() string {
 	case ClientCapAtomic:
 		return "ATOMIC"
 	case ClientCapAspectRatio:
-		return "APSECT_RATIO"
+		return "ASPECT_RATIO"
 	case ClientCapWritebackConnectors:
 		return "WRITEBACK_CONNECTORS"
+	case ClientCapCursorPlaneHotspot:
+		return "CURSOR_PLANE_HOTSPOT"
 	}
 	return "unknown"
 }
@@ -129,6 +139,17 @@ const (
 	CapPrimeExport = 0x2
 )
 
+// PrimeCaps is the value of CapPrime.
+type PrimeCaps uint64
+
+func (c PrimeCaps) Import() bool {
+	return c&CapPrimeImport != 0
+}
+
+func (c PrimeCaps) Export() bool {
+	return c&CapPrimeExport != 0
+}
+
 type ConnectorType uint32
 
 const (
@@ -151,6 +172,8 @@ const (
 	ConnectorDSI         ConnectorType = 16
 	ConnectorDPI         ConnectorType = 17
 	ConnectorWriteback   ConnectorType = 18
+	ConnectorSPI         ConnectorType = 19
+	ConnectorUSB         ConnectorType = 20
 )
 
 func (t ConnectorType) String() string {
@@ -191,11 +214,63 @@ func (t ConnectorType) String() string {
 		return "DPI"
 	case ConnectorWriteback:
 		return "writeback"
+	case ConnectorSPI:
+		return "SPI"
+	case ConnectorUSB:
+		return "USB"
 	default:
 		return "unknown"
 	}
 }
 
+// kernelName returns the name used by the kernel for connector names.
+func (t ConnectorType) kernelName() string {
+	switch t {
+	case ConnectorVGA:
+		return "VGA"
+	case ConnectorDVII:
+		return "DVI-I"
+	case ConnectorDVID:
+		return "DVI-D"
+	case ConnectorDVIA:
+		return "DVI-A"
+	case ConnectorComposite:
+		return "Composite"
+	case ConnectorSVideo:
+		return "SVIDEO"
+	case ConnectorLVDS:
+		return "LVDS"
+	case ConnectorComponent:
+		return "Component"
+	case Connector9PinDIN:
+		return "DIN"
+	case ConnectorDisplayPort:
+		return "DP"
+	case ConnectorHDMIA:
+		return "HDMI-A"
+	case ConnectorHDMIB:
+		return "HDMI-B"
+	case ConnectorTV:
+		return "TV"
+	case ConnectorEDP:
+		return "eDP"
+	case ConnectorVirtual:
+		return "Virtual"
+	case ConnectorDSI:
+		return "DSI"
+	case ConnectorDPI:
+		return "DPI"
+	case ConnectorWriteback:
+		return "Writeback"
+	case ConnectorSPI:
+		return "SPI"
+	case ConnectorUSB:
+		return "USB"
+	default:
+		return "Unknown"
+	}
+}
+
 type EncoderType uint32
 
 const (
@@ -302,3 +377,374 @@ func (t PlaneType) String() string {
 		return "unknown"
 	}
 }
+
+type Rotation uint32
+
+const (
+	Rotate0   Rotation = 1 << 0
+	Rotate90  Rotation = 1 << 1
+	Rotate180 Rotation = 1 << 2
+	Rotate270 Rotation = 1 << 3
+	ReflectX  Rotation = 1 << 4
+	ReflectY  Rotation = 1 << 5
+)
+
+func (r Rotation) String() string {
+	names := []struct {
+		r    Rotation
+		name string
+	}{
+		{Rotate0, "rotate-0"},
+		{Rotate90, "rotate-90"},
+		{Rotate180, "rotate-180"},
+		{Rotate270, "rotate-270"},
+		{ReflectX, "reflect-x"},
+		{ReflectY, "reflect-y"},
+	}
+	var l []string
+	for _, n := range names {
+		if r&n.r != 0 {
+			l = append(l, n.name)
+		}
+	}
+	if len(l) == 0 {
+		return "none"
+	}
+	return strings.Join(l, "|")
+}
+
+type BlendMode uint32
+
+const (
+	BlendModeNone          BlendMode = 0
+	BlendModePremultiplied BlendMode = 1
+	BlendModeCoverage      BlendMode = 2
+)
+
+func (m BlendMode) String() string {
+	switch m {
+	case BlendModeNone:
+		return "None"
+	case BlendModePremultiplied:
+		return "Pre-multiplied"
+	case BlendModeCoverage:
+		return "Coverage"
+	default:
+		return "unknown"
+	}
+}
+
+type ColorEncoding uint32
+
+const (
+	ColorEncodingBT601  ColorEncoding = 0
+	ColorEncodingBT709  ColorEncoding = 1
+	ColorEncodingBT2020 ColorEncoding = 2
+)
+
+func (e ColorEncoding) String() string {
+	switch e {
+	case ColorEncodingBT601:
+		return "ITU-R BT.601 YCbCr"
+	case ColorEncodingBT709:
+		return "ITU-R BT.709 YCbCr"
+	case ColorEncodingBT2020:
+		return "ITU-R BT.2020 YCbCr"
+	default:
+		return "unknown"
+	}
+}
+
+type ColorRange uint32
+
+const (
+	ColorRangeLimited ColorRange = 0
+	ColorRangeFull    ColorRange = 1
+)
+
+func (r ColorRange) String() string {
+	switch r {
+	case ColorRangeLimited:
+		return "YCbCr limited range"
+	case ColorRangeFull:
+		return "YCbCr full range"
+	default:
+		return "unknown"
+	}
+}
+
+type ScalingFilter uint32
+
+const (
+	ScalingFilterDefault         ScalingFilter = 0
+	ScalingFilterNearestNeighbor ScalingFilter = 1
+)
+
+func (f ScalingFilter) String() string {
+	switch f {
+	case ScalingFilterDefault:
+		return "Default"
+	case ScalingFilterNearestNeighbor:
+		return "Nearest Neighbor"
+	default:
+		return "unknown"
+	}
+}
+
+type Colorspace uint32
+
+const (
+	ColorspaceDefault         Colorspace = 0
+	ColorspaceSMPTE170MYCC    Colorspace = 1
+	ColorspaceBT709YCC        Colorspace = 2
+	ColorspaceXVYCC601        Colorspace = 3
+	ColorspaceXVYCC709        Colorspace = 4
+	ColorspaceSYCC601         Colorspace = 5
+	ColorspaceOpYCC601        Colorspace = 6
+	ColorspaceOpRGB           Colorspace = 7
+	ColorspaceBT2020CYCC      Colorspace = 8
+	ColorspaceBT2020RGB       Colorspace = 9
+	ColorspaceBT2020YCC       Colorspace = 10
+	ColorspaceDCIP3RGBD65     Colorspace = 11
+	ColorspaceDCIP3RGBTheater Colorspace = 12
+	ColorspaceRGBWideFixed    Colorspace = 13
+	ColorspaceRGBWideFloat    Colorspace = 14
+	ColorspaceBT601YCC        Colorspace = 15
+)
+
+func (c Colorspace) String() string {
+	switch c {
+	case ColorspaceDefault:
+		return "Default"
+	case ColorspaceSMPTE170MYCC:
+		return "SMPTE_170M_YCC"
+	case ColorspaceBT709YCC:
+		return "BT709_YCC"
+	case ColorspaceXVYCC601:
+		return "XVYCC_601"
+	case ColorspaceXVYCC709:
+		return "XVYCC_709"
+	case ColorspaceSYCC601:
+		return "SYCC_601"
+	case ColorspaceOpYCC601:
+		return "opYCC_601"
+	case ColorspaceOpRGB:
+		return "opRGB"
+	case ColorspaceBT2020CYCC:
+		return "BT2020_CYCC"
+	case ColorspaceBT2020RGB:
+		return "BT2020_RGB"
+	case ColorspaceBT2020YCC:
+		return "BT2020_YCC"
+	case ColorspaceDCIP3RGBD65:
+		return "DCI-P3_RGB_D65"
+	case ColorspaceDCIP3RGBTheater:
+		return "DCI-P3_RGB_Theater"
+	case ColorspaceRGBWideFixed:
+		return "RGB_WIDE_FIXED"
+	case ColorspaceRGBWideFloat:
+		return "RGB_WIDE_FLOAT"
+	case ColorspaceBT601YCC:
+		return "BT601_YCC"
+	default:
+		return "unknown"
+	}
+}
+
+type BroadcastRGB uint32
+
+const (
+	BroadcastRGBAutomatic BroadcastRGB = 0
+	BroadcastRGBFull      BroadcastRGB = 1
+	BroadcastRGBLimited   BroadcastRGB = 2
+)
+
+func (b BroadcastRGB) String() string {
+	switch b {
+	case BroadcastRGBAutomatic:
+		return "Automatic"
+	case BroadcastRGBFull:
+		return "Full"
+	case BroadcastRGBLimited:
+		return "Limited 16:235"
+	default:
+		return "unknown"
+	}
+}
+
+type ContentType uint32
+
+const (
+	ContentTypeNoData   ContentType = 0
+	ContentTypeGraphics ContentType = 1
+	ContentTypePhoto    ContentType = 2
+	ContentTypeCinema   ContentType = 3
+	ContentTypeGame     ContentType = 4
+)
+
+func (c ContentType) String() string {
+	switch c {
+	case ContentTypeNoData:
+		return "No Data"
+	case ContentTypeGraphics:
+		return "Graphics"
+	case ContentTypePhoto:
+		return "Photo"
+	case ContentTypeCinema:
+		return "Cinema"
+	case ContentTypeGame:
+		return "Game"
+	default:
+		return "unknown"
+	}
+}
+
+type ContentProtection uint32
+
+const (
+	ContentProtectionUndesired ContentProtection = 0
+	ContentProtectionDesired   ContentProtection = 1
+	ContentProtectionEnabled   ContentProtection = 2
+)
+
+func (c ContentProtection) String() string {
+	switch c {
+	case ContentProtectionUndesired:
+		return "Undesired"
+	case ContentProtectionDesired:
+		return "Desired"
+	case ContentProtectionEnabled:
+		return "Enabled"
+	default:
+		return "unknown"
+	}
+}
+
+type HDCPContentType uint32
+
+const (
+	HDCPContentType0 HDCPContentType = 0
+	HDCPContentType1 HDCPContentType = 1
+)
+
+func (h HDCPContentType) String() string {
+	switch h {
+	case HDCPContentType0:
+		return "HDCP Type0"
+	case HDCPContentType1:
+		return "HDCP Type1"
+	default:
+		return "unknown"
+	}
+}
+
+type ScalingMode uint32
+
+const (
+	ScalingModeNone       ScalingMode = 0
+	ScalingModeFull       ScalingMode = 1
+	ScalingModeCenter     ScalingMode = 2
+	ScalingModeFullAspect ScalingMode = 3
+)
+
+func (s ScalingMode) String() string {
+	switch s {
+	case ScalingModeNone:
+		return "None"
+	case ScalingModeFull:
+		return "Full"
+	case ScalingModeCenter:
+		return "Center"
+	case ScalingModeFullAspect:
+		return "Full aspect"
+	default:
+		return "unknown"
+	}
+}
+
+type Underscan uint32
+
+const (
+	UnderscanOff  Underscan = 0
+	UnderscanOn   Underscan = 1
+	UnderscanAuto Underscan = 2
+)
+
+func (u Underscan) String() string {
+	switch u {
+	case UnderscanOff:
+		return "off"
+	case UnderscanOn:
+		return "on"
+	case UnderscanAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+type PanelOrientation uint32
+
+const (
+	PanelOrientationNormal      PanelOrientation = 0
+	PanelOrientationUpsideDown  PanelOrientation = 1
+	PanelOrientationLeftSideUp  PanelOrientation = 2
+	PanelOrientationRightSideUp PanelOrientation = 3
+)
+
+func (p PanelOrientation) String() string {
+	switch p {
+	case PanelOrientationNormal:
+		return "Normal"
+	case PanelOrientationUpsideDown:
+		return "Upside Down"
+	case PanelOrientationLeftSideUp:
+		return "Left Side Up"
+	case PanelOrientationRightSideUp:
+		return "Right Side Up"
+	default:
+		return "unknown"
+	}
+}
+
+type PrivacyScreen uint32
+
+const (
+	PrivacyScreenDisabled       PrivacyScreen = 0
+	PrivacyScreenEnabled        PrivacyScreen = 1
+	PrivacyScreenDisabledLocked PrivacyScreen = 2
+	PrivacyScreenEnabledLocked  PrivacyScreen = 3
+)
+
+func (p PrivacyScreen) String() string {
+	switch p {
+	case PrivacyScreenDisabled:
+		return "Disabled"
+	case PrivacyScreenEnabled:
+		return "Enabled"
+	case PrivacyScreenDisabledLocked:
+		return "Disabled-locked"
+	case PrivacyScreenEnabledLocked:
+		return "Enabled-locked"
+	default:
+		return "unknown"
+	}
+}
+
+type LinkStatus uint32
+
+const (
+	LinkStatusGood LinkStatus = 0
+	LinkStatusBad  LinkStatus = 1
+)
+
+func (l LinkStatus) String() string {
+	switch l {
+	case LinkStatusGood:
+		return "Good"
+	case LinkStatusBad:
+		return "Bad"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,439 @@
+package drm
+
+import (
+	"fmt"
+	"math"
+)
+
+// PixelBuffer is an image in memory, in a format described by FormatInfo.
+type PixelBuffer struct {
+	Format        Format
+	Width, Height int
+	// Planes contains the memory of each plane, starting at the top-left
+	// pixel.
+	Planes  [3][]byte
+	Pitches [3]int
+	// ColorEncoding and ColorRange describe how YUV formats are encoded, they
+	// are ignored for RGB formats.
+	ColorEncoding ColorEncoding
+	ColorRange    ColorRange
+}
+
+// planeSize returns the size of a plane, in words.
+func (info *FormatInfo) planeSize(plane, width, height int) (int, int) {
+	if plane == 0 {
+		return (width + info.BlockWidth - 1) / info.BlockWidth, height
+	}
+	return (width + info.HSub - 1) / info.HSub, (height + info.VSub - 1) / info.VSub
+}
+
+func (info *FormatInfo) wordSize(plane int) int {
+	if plane == 0 {
+		return info.CPP[0] * info.BlockWidth
+	}
+	return info.CPP[plane]
+}
+
+// NewPixelBuffer allocates a pixel buffer with tightly packed planes.
+func NewPixelBuffer(format Format, width, height int) (*PixelBuffer, error) {
+	info := format.Info()
+	if info == nil {
+		return nil, fmt.Errorf("drm: unsupported format %v", format)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("drm: invalid pixel buffer size %vx%v", width, height)
+	}
+
+	buf := &PixelBuffer{Format: format, Width: width, Height: height}
+	for p := 0; p < info.NumPlanes; p++ {
+		w, h := info.planeSize(p, width, height)
+		buf.Pitches[p] = w * info.wordSize(p)
+		buf.Planes[p] = make([]byte, buf.Pitches[p]*h)
+	}
+	return buf, nil
+}
+
+func (buf *PixelBuffer) check(info *FormatInfo) error {
+	for p := 0; p < info.NumPlanes; p++ {
+		w, h := info.planeSize(p, buf.Width, buf.Height)
+		if buf.Pitches[p] < w*info.wordSize(p) {
+			return fmt.Errorf("drm: pitch of plane %v too small: got %v", p, buf.Pitches[p])
+		}
+		if len(buf.Planes[p]) < (h-1)*buf.Pitches[p]+w*info.wordSize(p) {
+			return fmt.Errorf("drm: plane %v too small: got %v bytes", p, len(buf.Planes[p]))
+		}
+	}
+	return nil
+}
+
+// pixel contains normalized channels, indexed like FormatInfo.Channels. RGB
+// and alpha values are in [0, 1], Y in [0, 1] and U, V in [-0.5, 0.5].
+type pixel [4]float32
+
+// channelCodec converts between a channel's bits and its normalized value:
+// value = code*scale + offset.
+type channelCodec struct {
+	FormatChannel
+	mask          uint64
+	scale, offset float32
+	float         bool
+}
+
+func newChannelCodecs(info *FormatInfo, r ColorRange) [4]channelCodec {
+	var codecs [4]channelCodec
+	for ch, c := range info.Channels {
+		if c.Bits == 0 {
+			continue
+		}
+		codec := channelCodec{FormatChannel: c, mask: 1<<c.Bits - 1, float: info.Float}
+		max := float32(codec.mask)
+		codec.scale = 1 / max
+		if info.YUV && ch != FormatChannelAlpha {
+			// Limited range codes are defined for 8 bits and scaled for
+			// higher depths
+			k := float32(uint64(1) << c.Bits / 256)
+			luma := ch == FormatChannelY
+			switch {
+			case r == ColorRangeLimited && luma:
+				codec.scale, codec.offset = 1/(219*k), -16.0/219
+			case r == ColorRangeLimited:
+				codec.scale, codec.offset = 1/(224*k), -128.0/224
+			case !luma:
+				codec.offset = -float32(uint64(1)<<(c.Bits-1)) / max
+			}
+		}
+		codecs[ch] = codec
+	}
+	return codecs
+}
+
+func (codec *channelCodec) decode(v uint64) float32 {
+	if codec.float {
+		return halfToFloat32(uint16(v))
+	}
+	return float32(v)*codec.scale + codec.offset
+}
+
+func (codec *channelCodec) encode(f float32) uint64 {
+	if codec.float {
+		return uint64(float32ToHalf(f))
+	}
+	v := (f-codec.offset)/codec.scale + 0.5
+	if !(v > 0) {
+		return 0
+	} else if v >= float32(codec.mask) {
+		return codec.mask
+	}
+	return uint64(v)
+}
+
+func readWord(b []byte, n int) uint64 {
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+func writeWord(b []byte, n int, v uint64) {
+	for i := 0; i < n; i++ {
+		b[i] = byte(v >> (8 * uint(i)))
+	}
+}
+
+// ycbcrCoeffs returns the luma coefficients of red and blue.
+func ycbcrCoeffs(enc ColorEncoding) (kr, kb float32) {
+	switch enc {
+	case ColorEncodingBT709:
+		return 0.2126, 0.0722
+	case ColorEncodingBT2020:
+		return 0.2627, 0.0593
+	default:
+		return 0.299, 0.114
+	}
+}
+
+func yuvToRGB(px *pixel, enc ColorEncoding) {
+	kr, kb := ycbcrCoeffs(enc)
+	y, u, v := px[FormatChannelY], px[FormatChannelU], px[FormatChannelV]
+	r := y + 2*(1-kr)*v
+	b := y + 2*(1-kb)*u
+	g := (y - kr*r - kb*b) / (1 - kr - kb)
+	px[FormatChannelRed], px[FormatChannelGreen], px[FormatChannelBlue] = r, g, b
+}
+
+func rgbToYUV(px *pixel, enc ColorEncoding) {
+	kr, kb := ycbcrCoeffs(enc)
+	r, g, b := px[FormatChannelRed], px[FormatChannelGreen], px[FormatChannelBlue]
+	y := kr*r + (1-kr-kb)*g + kb*b
+	px[FormatChannelY] = y
+	px[FormatChannelU] = (b - y) / (2 * (1 - kb))
+	px[FormatChannelV] = (r - y) / (2 * (1 - kr))
+}
+
+// pixelReader decodes rows of a pixel buffer.
+type pixelReader struct {
+	buf    *PixelBuffer
+	info   *FormatInfo
+	codecs [4]channelCodec
+}
+
+func (r *pixelReader) readRow(row []pixel, y int) {
+	info := r.info
+	var rows [3][]byte
+	var sizes [3]int
+	for p := 0; p < info.NumPlanes; p++ {
+		py := y
+		if p > 0 {
+			py = y / info.VSub
+		}
+		rows[p] = r.buf.Planes[p][py*r.buf.Pitches[p]:]
+		sizes[p] = info.wordSize(p)
+	}
+
+	for x := range row {
+		var words [3]uint64
+		for p := 0; p < info.NumPlanes; p++ {
+			i := x / info.BlockWidth
+			if p > 0 {
+				i = x / info.HSub
+			}
+			words[p] = readWord(rows[p][i*sizes[p]:], sizes[p])
+		}
+
+		px := &row[x]
+		for ch := range r.codecs {
+			codec := &r.codecs[ch]
+			if codec.Bits == 0 {
+				px[ch] = 0
+				if ch == FormatChannelAlpha {
+					px[ch] = 1
+				}
+				continue
+			}
+			shift := codec.Shift
+			if ch == FormatChannelY && info.BlockWidth == 2 && x%2 == 1 {
+				shift += 16
+			}
+			px[ch] = codec.decode((words[codec.Plane] >> shift) & codec.mask)
+		}
+	}
+}
+
+// pixelWriter encodes rows of a pixel buffer.
+type pixelWriter struct {
+	buf    *PixelBuffer
+	info   *FormatInfo
+	codecs [4]channelCodec
+}
+
+// rowGroup returns the number of rows written at once.
+func (w *pixelWriter) rowGroup() int {
+	if w.info.NumPlanes > 1 {
+		return w.info.VSub
+	}
+	return 1
+}
+
+// average computes a channel's mean over a block of pixels.
+func average(rows [][]pixel, ch, x0, x1 int) float32 {
+	var sum float32
+	for _, row := range rows {
+		for x := x0; x < x1; x++ {
+			sum += row[x][ch]
+		}
+	}
+	return sum / float32(len(rows)*(x1-x0))
+}
+
+// writeRows encodes a group of rows starting at y. Subsampled chroma samples
+// are the average of the pixels they cover.
+func (w *pixelWriter) writeRows(rows [][]pixel, y int) {
+	info := w.info
+	width := w.buf.Width
+	size := info.wordSize(0)
+
+	for i, row := range rows {
+		dst := w.buf.Planes[0][(y+i)*w.buf.Pitches[0]:]
+		for x := 0; x < width; x += info.BlockWidth {
+			end := x + info.BlockWidth
+			if end > width {
+				end = width
+			}
+			var word uint64
+			for ch := range w.codecs {
+				codec := &w.codecs[ch]
+				if codec.Bits == 0 || codec.Plane != 0 {
+					continue
+				}
+				switch {
+				case info.subsampled(ch):
+					word |= codec.encode(average(rows[i:i+1], ch, x, end)) << codec.Shift
+				case ch == FormatChannelY && info.BlockWidth == 2:
+					word |= codec.encode(row[x][ch]) << codec.Shift
+					word |= codec.encode(row[end-1][ch]) << (codec.Shift + 16)
+				default:
+					word |= codec.encode(row[x][ch]) << codec.Shift
+				}
+			}
+			writeWord(dst[(x/info.BlockWidth)*size:], size, word)
+		}
+	}
+
+	for p := 1; p < info.NumPlanes; p++ {
+		size := info.wordSize(p)
+		dst := w.buf.Planes[p][(y/info.VSub)*w.buf.Pitches[p]:]
+		for x := 0; x < width; x += info.HSub {
+			end := x + info.HSub
+			if end > width {
+				end = width
+			}
+			var word uint64
+			for ch := range w.codecs {
+				codec := &w.codecs[ch]
+				if codec.Bits == 0 || int(codec.Plane) != p {
+					continue
+				}
+				word |= codec.encode(average(rows, ch, x, end)) << codec.Shift
+			}
+			writeWord(dst[(x/info.HSub)*size:], size, word)
+		}
+	}
+}
+
+// ConvertPixels copies pixels from src to dst, converting between formats.
+// Both buffers must have the same size.
+//
+// Conversions between YUV and RGB only apply the YCbCr matrix of the
+// ColorEncoding, no gamut mapping is performed. Alpha is copied as-is, and
+// dropped if dst has no alpha channel.
+func ConvertPixels(dst, src *PixelBuffer) error {
+	srcInfo, dstInfo := src.Format.Info(), dst.Format.Info()
+	if srcInfo == nil {
+		return fmt.Errorf("drm: unsupported format %v", src.Format)
+	}
+	if dstInfo == nil {
+		return fmt.Errorf("drm: unsupported format %v", dst.Format)
+	}
+	if dst.Width != src.Width || dst.Height != src.Height {
+		return fmt.Errorf("drm: pixel buffer size mismatch: %vx%v != %vx%v", dst.Width, dst.Height, src.Width, src.Height)
+	}
+	if err := src.check(srcInfo); err != nil {
+		return err
+	}
+	if err := dst.check(dstInfo); err != nil {
+		return err
+	}
+
+	sameEncoding := src.ColorEncoding == dst.ColorEncoding && src.ColorRange == dst.ColorRange
+	if src.Format == dst.Format && (!srcInfo.YUV || sameEncoding) {
+		copyPlanes(dst, src, srcInfo)
+		return nil
+	}
+
+	r := pixelReader{src, srcInfo, newChannelCodecs(srcInfo, src.ColorRange)}
+	w := newPixelWriter(dst, dstInfo)
+	w.write(srcInfo.YUV, src.ColorEncoding, r.readRow)
+	return nil
+}
+
+func newPixelWriter(buf *PixelBuffer, info *FormatInfo) *pixelWriter {
+	return &pixelWriter{buf, info, newChannelCodecs(info, buf.ColorRange)}
+}
+
+// write fills the buffer with rows produced by read. The rows are in YUV with
+// the specified color encoding if yuv is true, and in RGB otherwise.
+func (w *pixelWriter) write(yuv bool, enc ColorEncoding, read func(row []pixel, y int)) {
+	buf := w.buf
+	toRGB := yuv && (!w.info.YUV || enc != buf.ColorEncoding)
+	toYUV := w.info.YUV && (!yuv || enc != buf.ColorEncoding)
+
+	rows := make([][]pixel, w.rowGroup())
+	for i := range rows {
+		rows[i] = make([]pixel, buf.Width)
+	}
+	for y := 0; y < buf.Height; y += len(rows) {
+		n := len(rows)
+		if y+n > buf.Height {
+			n = buf.Height - y
+		}
+		for i := 0; i < n; i++ {
+			row := rows[i]
+			read(row, y+i)
+			if !toRGB && !toYUV {
+				continue
+			}
+			for x := range row {
+				if toRGB {
+					yuvToRGB(&row[x], enc)
+				}
+				if toYUV {
+					rgbToYUV(&row[x], buf.ColorEncoding)
+				}
+			}
+		}
+		w.writeRows(rows[:n], y)
+	}
+}
+
+func copyPlanes(dst, src *PixelBuffer, info *FormatInfo) {
+	for p := 0; p < info.NumPlanes; p++ {
+		w, h := info.planeSize(p, src.Width, src.Height)
+		n := w * info.wordSize(p)
+		for y := 0; y < h; y++ {
+			copy(dst.Planes[p][y*dst.Pitches[p]:][:n], src.Planes[p][y*src.Pitches[p]:][:n])
+		}
+	}
+}
+
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1F
+	mant := uint32(h & 0x3FF)
+	switch {
+	case exp == 0x1F:
+		// Infinity or NaN
+		return math.Float32frombits(sign | 0x7F800000 | mant<<13)
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+func float32ToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xFF) - 127 + 15
+	mant := bits & 0x7FFFFF
+	switch {
+	case bits&0x7FFFFFFF > 0x7F800000:
+		return sign | 0x7E00 // NaN
+	case exp >= 0x1F:
+		return sign | 0x7C00 // Infinity
+	case exp <= 0:
+		if exp < -10 {
+			return sign
+		}
+		// Subnormal, the implicit leading bit becomes explicit
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := uint16(mant >> shift)
+		if mant>>(shift-1)&1 != 0 {
+			h++
+		}
+		return sign | h
+	}
+	// Rounding may carry into the exponent, which is the correct result
+	h := sign | uint16(exp)<<10 | uint16(mant>>13)
+	if mant&0x1000 != 0 {
+		h++
+	}
+	return h
+}
@@ -0,0 +1,191 @@
+package drm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+// newXRGB8888 creates a buffer from a list of pixels, as 0xRRGGBB values.
+func newXRGB8888(t testing.TB, width, height int, pixels ...uint32) *drm.PixelBuffer {
+	buf, err := drm.NewPixelBuffer(drm.FormatXRGB8888, width, height)
+	if err != nil {
+		t.Fatalf("NewPixelBuffer() = %v", err)
+	}
+	for i, px := range pixels {
+		b := buf.Planes[0][4*i:]
+		b[0], b[1], b[2], b[3] = byte(px), byte(px>>8), byte(px>>16), 0xFF
+	}
+	return buf
+}
+
+func convert(t testing.TB, src *drm.PixelBuffer, format drm.Format, enc drm.ColorEncoding, r drm.ColorRange) *drm.PixelBuffer {
+	dst, err := drm.NewPixelBuffer(format, src.Width, src.Height)
+	if err != nil {
+		t.Fatalf("NewPixelBuffer(%v) = %v", format, err)
+	}
+	dst.ColorEncoding = enc
+	dst.ColorRange = r
+	if err := drm.ConvertPixels(dst, src); err != nil {
+		t.Fatalf("ConvertPixels(%v -> %v) = %v", src.Format, format, err)
+	}
+	return dst
+}
+
+func TestConvertPixels_ycbcr(t *testing.T) {
+	// Reference Y, Cb, Cr values for red, green, blue, white and black
+	refs := []struct {
+		enc  drm.ColorEncoding
+		r    drm.ColorRange
+		want [5][3]byte
+	}{
+		{drm.ColorEncodingBT601, drm.ColorRangeLimited, [5][3]byte{
+			{81, 90, 240}, {145, 54, 34}, {41, 240, 110}, {235, 128, 128}, {16, 128, 128},
+		}},
+		{drm.ColorEncodingBT709, drm.ColorRangeLimited, [5][3]byte{
+			{63, 102, 240}, {173, 42, 26}, {32, 240, 118}, {235, 128, 128}, {16, 128, 128},
+		}},
+		{drm.ColorEncodingBT709, drm.ColorRangeFull, [5][3]byte{
+			{54, 99, 255}, {182, 30, 12}, {18, 255, 116}, {255, 128, 128}, {0, 128, 128},
+		}},
+		{drm.ColorEncodingBT2020, drm.ColorRangeLimited, [5][3]byte{
+			{74, 97, 240}, {164, 47, 25}, {29, 240, 119}, {235, 128, 128}, {16, 128, 128},
+		}},
+	}
+
+	src := newXRGB8888(t, 5, 1, 0xFF0000, 0x00FF00, 0x0000FF, 0xFFFFFF, 0x000000)
+	for _, ref := range refs {
+		dst := convert(t, src, drm.FormatYUV444, ref.enc, ref.r)
+		for i, want := range ref.want {
+			got := [3]byte{dst.Planes[0][i], dst.Planes[1][i], dst.Planes[2][i]}
+			if got != want {
+				t.Errorf("%v, %v: pixel %v = %v, want %v", ref.enc, ref.r, i, got, want)
+			}
+		}
+
+		// And back to RGB
+		back := convert(t, dst, drm.FormatXRGB8888, 0, 0)
+		for i := 0; i < len(src.Planes[0]); i++ {
+			if i%4 == 3 {
+				continue // padding
+			}
+			d := int(back.Planes[0][i]) - int(src.Planes[0][i])
+			if d < -2 || d > 2 {
+				t.Errorf("%v, %v: round-trip byte %v = %v, want %v", ref.enc, ref.r, i, back.Planes[0][i], src.Planes[0][i])
+			}
+		}
+	}
+}
+
+func TestConvertPixels_subsampled(t *testing.T) {
+	// Red and blue pixels, BT.601 limited range
+	src := newXRGB8888(t, 2, 2, 0xFF0000, 0x0000FF, 0xFF0000, 0x0000FF)
+
+	yuyv := convert(t, src, drm.FormatYUYV, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	want := []byte{81, 165, 41, 175, 81, 165, 41, 175}
+	if string(yuyv.Planes[0]) != string(want) {
+		t.Errorf("YUYV = %v, want %v", yuyv.Planes[0], want)
+	}
+
+	uyvy := convert(t, src, drm.FormatUYVY, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	want = []byte{165, 81, 175, 41, 165, 81, 175, 41}
+	if string(uyvy.Planes[0]) != string(want) {
+		t.Errorf("UYVY = %v, want %v", uyvy.Planes[0], want)
+	}
+
+	nv12 := convert(t, src, drm.FormatNV12, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	if want := []byte{81, 41, 81, 41}; string(nv12.Planes[0]) != string(want) {
+		t.Errorf("NV12 Y = %v, want %v", nv12.Planes[0], want)
+	}
+	if want := []byte{165, 175}; string(nv12.Planes[1]) != string(want) {
+		t.Errorf("NV12 UV = %v, want %v", nv12.Planes[1], want)
+	}
+
+	nv21 := convert(t, src, drm.FormatNV21, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	if want := []byte{175, 165}; string(nv21.Planes[1]) != string(want) {
+		t.Errorf("NV21 VU = %v, want %v", nv21.Planes[1], want)
+	}
+
+	yuv420 := convert(t, nv12, drm.FormatYUV420, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	got := [3]byte{yuv420.Planes[0][0], yuv420.Planes[1][0], yuv420.Planes[2][0]}
+	if want := [3]byte{81, 165, 175}; got != want {
+		t.Errorf("YUV420 = %v, want %v", got, want)
+	}
+
+	p010 := convert(t, src, drm.FormatP010, drm.ColorEncodingBT601, drm.ColorRangeLimited)
+	// 10-bit samples are stored in the high bits of little-endian words
+	if y := uint16(p010.Planes[0][0]) | uint16(p010.Planes[0][1])<<8; y != 326<<6 {
+		t.Errorf("P010 Y = %v, want %v", y>>6, 326)
+	}
+}
+
+func TestConvertPixels_rgb(t *testing.T) {
+	src := newXRGB8888(t, 3, 1, 0xFF0000, 0x00FF00, 0x0000FF)
+
+	tests := []struct {
+		format drm.Format
+		want   []byte
+	}{
+		{drm.FormatRGB565, []byte{0x00, 0xF8, 0xE0, 0x07, 0x1F, 0x00}},
+		{drm.FormatBGR888, []byte{0xFF, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0xFF}},
+		{drm.FormatRGBA4444, []byte{0x0F, 0xF0, 0x0F, 0x0F, 0xFF, 0x00}},
+		{drm.FormatXRGB2101010, []byte{0x00, 0x00, 0xF0, 0x3F, 0x00, 0xFC, 0x0F, 0x00, 0xFF, 0x03, 0x00, 0x00}},
+		{drm.FormatABGR16161616F, []byte{
+			0x00, 0x3C, 0x00, 0x00, 0x00, 0x00, 0x00, 0x3C,
+			0x00, 0x00, 0x00, 0x3C, 0x00, 0x00, 0x00, 0x3C,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x3C, 0x00, 0x3C,
+		}},
+	}
+	for _, tc := range tests {
+		dst := convert(t, src, tc.format, 0, 0)
+		if string(dst.Planes[0]) != string(tc.want) {
+			t.Errorf("%v = %x, want %x", tc.format, dst.Planes[0], tc.want)
+		}
+
+		back := convert(t, dst, drm.FormatXRGB8888, 0, 0)
+		for i := 3; i < len(back.Planes[0]); i += 4 {
+			back.Planes[0][i] = 0xFF // padding
+		}
+		if string(back.Planes[0]) != string(src.Planes[0]) {
+			t.Errorf("%v round-trip = %x, want %x", tc.format, back.Planes[0], src.Planes[0])
+		}
+	}
+}
+
+func BenchmarkConvertPixels(b *testing.B) {
+	const width, height = 640, 480
+
+	formats := []drm.Format{
+		drm.FormatXRGB8888,
+		drm.FormatRGB565,
+		drm.FormatXRGB2101010,
+		drm.FormatABGR16161616F,
+		drm.FormatYUYV,
+		drm.FormatNV12,
+		drm.FormatYUV420,
+	}
+	for _, srcFormat := range []drm.Format{drm.FormatXRGB8888, drm.FormatNV12} {
+		src, err := drm.NewPixelBuffer(srcFormat, width, height)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, dstFormat := range formats {
+			if dstFormat == srcFormat {
+				continue
+			}
+			dst, err := drm.NewPixelBuffer(dstFormat, width, height)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%v-%v", srcFormat, dstFormat), func(b *testing.B) {
+				b.SetBytes(width * height)
+				for i := 0; i < b.N; i++ {
+					if err := drm.ConvertPixels(dst, src); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -13,5 +13,5 @@ func devIsDRM(dev uint64) bool {
 }
 
 func isDRM(stat *syscall.Stat_t) bool {
-	return devIsDRM(stat.Rdev) && modeIsChr(stat.Mode)
+	return devIsDRM(uint64(stat.Rdev)) && modeIsChr(stat.Mode)
 }
@@ -26,8 +26,12 @@ func getMinorType(min uint32) (NodeType, error) {
 	}
 }
 
+// sysfsCharDir is the sysfs directory containing links to character devices,
+// named after their major and minor numbers. Tests can override it.
+var sysfsCharDir = "/sys/dev/char"
+
 func getPCIPath(dev uint64) string {
-	return fmt.Sprintf("/sys/dev/char/%d:%d/device", major(dev), minor(dev))
+	return fmt.Sprintf("%v/%d:%d/device", sysfsCharDir, major(dev), minor(dev))
 }
 
 func getSubsystemType(dev uint64) (BusType, error) {
@@ -0,0 +1,140 @@
+package drm
+
+import (
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+// Driver is a kernel driver name, as returned in Version.Name.
+type Driver string
+
+const (
+	DriverI915      Driver = "i915"
+	DriverXe        Driver = "xe"
+	DriverAMDGPU    Driver = "amdgpu"
+	DriverRadeon    Driver = "radeon"
+	DriverNouveau   Driver = "nouveau"
+	DriverNVIDIA    Driver = "nvidia-drm"
+	DriverMSM       Driver = "msm"
+	DriverVC4       Driver = "vc4"
+	DriverV3D       Driver = "v3d"
+	DriverPanfrost  Driver = "panfrost"
+	DriverLima      Driver = "lima"
+	DriverEtnaviv   Driver = "etnaviv"
+	DriverVirtioGPU Driver = "virtio_gpu"
+	DriverVMWGFX    Driver = "vmwgfx"
+	DriverQXL       Driver = "qxl"
+	DriverVKMS      Driver = "vkms"
+	DriverSimpleDRM Driver = "simpledrm"
+	DriverEVDI      Driver = "evdi"
+	DriverUDL       Driver = "udl"
+	DriverGUD       Driver = "gud"
+	DriverAST       Driver = "ast"
+	DriverMGAG200   Driver = "mgag200"
+	DriverBochs     Driver = "bochs"
+	DriverCirrus    Driver = "cirrus"
+	DriverHyperV    Driver = "hyperv_drm"
+)
+
+type driverInfo struct {
+	software    bool // no rendering hardware
+	dirtyFB     bool // needs DIRTYFB to flush front-buffer rendering
+	noModifiers bool // known not to support explicit modifiers
+}
+
+var driverInfos = map[Driver]driverInfo{
+	DriverRadeon:    {noModifiers: true},
+	DriverVirtioGPU: {dirtyFB: true},
+	DriverVMWGFX:    {dirtyFB: true, noModifiers: true},
+	DriverQXL:       {dirtyFB: true, noModifiers: true},
+	DriverVKMS:      {software: true},
+	DriverSimpleDRM: {software: true, dirtyFB: true, noModifiers: true},
+	DriverEVDI:      {software: true, dirtyFB: true, noModifiers: true},
+	DriverUDL:       {software: true, dirtyFB: true, noModifiers: true},
+	DriverGUD:       {software: true, dirtyFB: true, noModifiers: true},
+	DriverAST:       {software: true, dirtyFB: true, noModifiers: true},
+	DriverMGAG200:   {software: true, dirtyFB: true, noModifiers: true},
+	DriverBochs:     {software: true, noModifiers: true},
+	DriverCirrus:    {software: true, dirtyFB: true, noModifiers: true},
+	DriverHyperV:    {software: true, dirtyFB: true, noModifiers: true},
+}
+
+// Software returns true if the driver doesn't have any rendering hardware.
+func (d Driver) Software() bool {
+	return driverInfos[d].software
+}
+
+// NeedsDirtyFB returns true if the driver requires DIRTYFB to be called after
+// rendering to a front buffer.
+func (d Driver) NeedsDirtyFB() bool {
+	return driverInfos[d].dirtyFB
+}
+
+// NoModifiers returns true if the driver is known not to support explicit
+// format modifiers.
+func (d Driver) NoModifiers() bool {
+	return driverInfos[d].noModifiers
+}
+
+func (v *Version) Driver() Driver {
+	return Driver(v.Name)
+}
+
+// InterfaceVersion contains the DRM interface (DI) and driver (DD) versions
+// used by SetVersion. Set a field to -1 to leave it unchanged.
+type InterfaceVersion struct {
+	DIMajor, DIMinor int32
+	DDMajor, DDMinor int32
+}
+
+// SetVersion requests an interface version. It returns the versions in use.
+func (n *Node) SetVersion(v *InterfaceVersion) (*InterfaceVersion, error) {
+	r := uapi.SetVersionArg{
+		DIMajor: v.DIMajor,
+		DIMinor: v.DIMinor,
+		DDMajor: v.DDMajor,
+		DDMinor: v.DDMinor,
+	}
+	if err := setVersion(n.backend, &r); err != nil {
+		return nil, err
+	}
+	return &InterfaceVersion{
+		DIMajor: r.DIMajor,
+		DIMinor: r.DIMinor,
+		DDMajor: r.DDMajor,
+		DDMinor: r.DDMinor,
+	}, nil
+}
+
+// GetUnique returns the unique identifier of the device. The format depends
+// on the interface version, see BusID.
+func (n *Node) GetUnique() (string, error) {
+	for {
+		var r uapi.UniqueResp
+		if err := getUnique(n.backend, &r); err != nil {
+			return "", err
+		}
+		if r.UniqueLen == 0 {
+			return "", nil
+		}
+		count := r
+
+		unique := allocBytes(&r.Unique, r.UniqueLen)
+		if err := getUnique(n.backend, &r); err != nil {
+			return "", err
+		}
+
+		if r.UniqueLen != count.UniqueLen {
+			continue
+		}
+		return newString(unique), nil
+	}
+}
+
+// BusID returns the bus ID of the device, e.g. "pci:0000:01:00.0". It
+// requests interface version 1.4, which requires DRM master.
+func (n *Node) BusID() (string, error) {
+	if _, err := n.SetVersion(&InterfaceVersion{1, 4, -1, -1}); err != nil {
+		return "", err
+	}
+	return n.GetUnique()
+}
@@ -0,0 +1,313 @@
+package drmtest
+
+import (
+	"syscall"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const atomicFlags = drm.AtomicPageFlipEvent | drm.AtomicPageFlipAsync | drm.AtomicTestOnly | drm.AtomicNonblock | drm.AtomicAllowModeset
+
+// AddWritebackConnector adds a writeback connector, along with its atomic
+// CRTC_ID, WRITEBACK_FB_ID, WRITEBACK_OUT_FENCE_PTR and
+// WRITEBACK_PIXEL_FORMATS properties. Committing a framebuffer to the
+// connector captures the FB of the primary plane of its CRTC.
+func (d *Driver) AddWritebackConnector(conn *Connector, formats []drm.Format) drm.ConnectorID {
+	conn.Type = drm.ConnectorWriteback
+	id := d.AddConnector(conn)
+
+	var b []byte
+	if len(formats) > 0 {
+		l := 4 * len(formats)
+		b = (*[maxArrayLen]byte)(unsafe.Pointer(&formats[0]))[:l:l]
+	}
+
+	d.AddProperty(id, &Property{
+		Name:   "CRTC_ID",
+		Type:   drm.PropertyObject,
+		Atomic: true,
+		Values: []uint64{uint64(drm.ObjectCRTC)},
+	}, 0)
+	d.AddProperty(id, &Property{
+		Name:   "WRITEBACK_FB_ID",
+		Type:   drm.PropertyObject,
+		Atomic: true,
+		Values: []uint64{uint64(drm.ObjectFB)},
+	}, 0)
+	d.AddProperty(id, &Property{
+		Name:   "WRITEBACK_OUT_FENCE_PTR",
+		Type:   drm.PropertyRange,
+		Atomic: true,
+		Values: []uint64{0, ^uint64(0)},
+	}, 0)
+	d.AddProperty(id, &Property{
+		Name:      "WRITEBACK_PIXEL_FORMATS",
+		Type:      drm.PropertyBlob,
+		Immutable: true,
+	}, uint64(d.CreateBlob(b)))
+	return id
+}
+
+type atomicUpdate struct {
+	obj   drm.ObjectID
+	pv    *propertyValue
+	value uint64
+}
+
+// objectValue returns the value of an object's property after an atomic
+// commit.
+func (d *Driver) objectValue(updates []atomicUpdate, obj drm.ObjectID, name string) uint64 {
+	for _, u := range updates {
+		if u.obj == obj && u.pv.prop.Name == name {
+			return u.value
+		}
+	}
+	for _, pv := range d.objProps[obj] {
+		if pv.prop.Name == name {
+			return pv.value
+		}
+	}
+	return 0
+}
+
+func (c *client) modeAtomic(r *uapi.ModeAtomicArg) error {
+	d := c.d
+	flags := drm.AtomicFlags(r.Flags)
+	if c.caps[drm.ClientCapAtomic] == 0 || flags&^atomicFlags != 0 || r.Reserved != 0 {
+		return syscall.EINVAL
+	}
+	if flags&drm.AtomicTestOnly != 0 && flags&drm.AtomicPageFlipEvent != 0 {
+		return syscall.EINVAL
+	}
+
+	var objs, counts []uint32
+	if n := int(r.CountObjs); n > 0 {
+		if r.Objs == 0 || r.CountProps == 0 {
+			return syscall.EFAULT
+		}
+		objs = (*[maxArrayLen]uint32)(r.Objs.Pointer())[:n:n]
+		counts = (*[maxArrayLen]uint32)(r.CountProps.Pointer())[:n:n]
+	}
+	total := 0
+	for _, n := range counts {
+		total += int(n)
+	}
+	var props []uint32
+	var values []uint64
+	if total > 0 {
+		if r.Props == 0 || r.PropValues == 0 {
+			return syscall.EFAULT
+		}
+		props = (*[maxArrayLen]uint32)(r.Props.Pointer())[:total:total]
+		values = (*[maxArrayLen]uint64)(r.PropValues.Pointer())[:total:total]
+	}
+
+	// Validate the whole request before applying anything
+	var updates []atomicUpdate
+	k := 0
+	for i, obj := range objs {
+		id := drm.ObjectID(obj)
+		if _, ok := d.objects[id]; !ok {
+			return syscall.ENOENT
+		}
+		objProps := d.objProps[id]
+		for j := 0; j < int(counts[i]); j++ {
+			var pv *propertyValue
+			for l := range objProps {
+				if objProps[l].prop.id == drm.PropertyID(props[k]) {
+					pv = &objProps[l]
+					break
+				}
+			}
+			if pv == nil {
+				return syscall.ENOENT
+			}
+			if err := c.checkPropertyValue(pv.prop, values[k]); err != nil {
+				return err
+			}
+			updates = append(updates, atomicUpdate{id, pv, values[k]})
+			k++
+		}
+	}
+
+	crtcs := make(map[drm.CRTCID]bool)
+	for _, u := range updates {
+		modeset := false
+		switch d.objects[u.obj] {
+		case drm.ObjectCRTC:
+			crtcs[drm.CRTCID(u.obj)] = true
+			modeset = u.pv.prop.Name == "MODE_ID" || u.pv.prop.Name == "ACTIVE"
+		case drm.ObjectPlane:
+			if crtc := d.objectValue(updates, u.obj, "CRTC_ID"); crtc != 0 {
+				crtcs[drm.CRTCID(crtc)] = true
+			}
+		case drm.ObjectConnector:
+			modeset = u.pv.prop.Name == "CRTC_ID"
+		}
+		if modeset && u.value != u.pv.value && flags&drm.AtomicAllowModeset == 0 {
+			return syscall.EINVAL
+		}
+	}
+	if flags&drm.AtomicPageFlipEvent != 0 && len(crtcs) == 0 {
+		return syscall.EINVAL
+	}
+
+	var writebacks []*Connector
+	for _, conn := range d.connectors {
+		if conn.Type != drm.ConnectorWriteback {
+			continue
+		}
+		id := drm.ObjectID(conn.ID)
+		fb := d.objectValue(updates, id, "WRITEBACK_FB_ID")
+		fence := d.objectValue(updates, id, "WRITEBACK_OUT_FENCE_PTR")
+		if fb == 0 {
+			if fence != 0 {
+				return syscall.EINVAL
+			}
+			continue
+		}
+		crtc := d.crtc(drm.CRTCID(d.objectValue(updates, id, "CRTC_ID")))
+		if crtc == nil || crtc.Mode == nil {
+			return syscall.EINVAL
+		}
+		info := d.fbInfos[drm.FBID(fb)]
+		if info == nil || info.Width != uint32(crtc.Mode.HDisplay) || info.Height != uint32(crtc.Mode.VDisplay) {
+			return syscall.EINVAL
+		}
+		if !d.writebackSupports(conn, info.Format) {
+			return syscall.EINVAL
+		}
+		writebacks = append(writebacks, conn)
+	}
+
+	if flags&drm.AtomicTestOnly != 0 {
+		return nil
+	}
+
+	for _, u := range updates {
+		u.pv.value = u.value
+		if err := d.mirrorProperty(u.obj, u.pv.prop.Name, u.value); err != nil {
+			return err
+		}
+	}
+
+	for _, conn := range writebacks {
+		if err := d.writeback(conn); err != nil {
+			return err
+		}
+	}
+
+	if flags&drm.AtomicPageFlipEvent != 0 {
+		for id := range crtcs {
+			crtc := d.crtc(id)
+			if crtc == nil {
+				continue
+			}
+			d.pending = append(d.pending, &pendingEvent{
+				c:        c,
+				crtc:     crtc,
+				typ:      drm.EventFlipComplete,
+				seq:      crtc.seq + 1,
+				userData: r.UserData,
+			})
+		}
+	}
+	return nil
+}
+
+// mirrorProperty reflects a property update in the exported object fields.
+func (d *Driver) mirrorProperty(obj drm.ObjectID, name string, value uint64) error {
+	switch d.objects[obj] {
+	case drm.ObjectPlane:
+		plane := d.plane(drm.PlaneID(obj))
+		switch name {
+		case "FB_ID":
+			plane.FB = drm.FBID(value)
+		case "CRTC_ID":
+			plane.CRTC = drm.CRTCID(value)
+		}
+	case drm.ObjectCRTC:
+		crtc := d.crtc(drm.CRTCID(obj))
+		if name != "MODE_ID" {
+			break
+		}
+		if value == 0 {
+			crtc.Mode = nil
+			break
+		}
+		mode, err := drm.ParseModeModeInfo(d.blobs[drm.BlobID(value)])
+		if err != nil {
+			return syscall.EINVAL
+		}
+		crtc.Mode = mode
+	}
+	return nil
+}
+
+func (d *Driver) writebackSupports(conn *Connector, format drm.Format) bool {
+	blob := d.objectValue(nil, drm.ObjectID(conn.ID), "WRITEBACK_PIXEL_FORMATS")
+	formats, _ := drm.ParseFormats(d.blobs[drm.BlobID(blob)])
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeback captures the primary plane of the connector's CRTC into the
+// writeback framebuffer, and signals the out fence. The fence is a pipe with
+// a pending byte, which is readable like a signalled sync file.
+func (d *Driver) writeback(conn *Connector) error {
+	id := drm.ObjectID(conn.ID)
+	crtcID := drm.CRTCID(d.objectValue(nil, id, "CRTC_ID"))
+	dst := d.fbInfos[drm.FBID(d.objectValue(nil, id, "WRITEBACK_FB_ID"))]
+
+	var src *framebuffer
+	for _, plane := range d.planes {
+		if plane.Type == drm.PlanePrimary && plane.CRTC == crtcID {
+			src = d.fbInfos[plane.FB]
+		}
+	}
+
+	bpp := int(dst.Pitches[0] / dst.Width)
+	for y := 0; y < int(dst.Height); y++ {
+		row := dst.data[0][y*int(dst.Pitches[0]):][:bpp*int(dst.Width)]
+		if src == nil || src.Format != dst.Format || y >= int(src.Height) {
+			for i := range row {
+				row[i] = 0
+			}
+			continue
+		}
+		n := copy(row, src.data[0][y*int(src.Pitches[0]):][:bpp*int(src.Width)])
+		for i := range row[n:] {
+			row[n+i] = 0
+		}
+	}
+
+	if ptr := d.objectValue(nil, id, "WRITEBACK_OUT_FENCE_PTR"); ptr != 0 {
+		var p [2]int
+		if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC); err != nil {
+			return err
+		}
+		_, err := syscall.Write(p[1], []byte{0})
+		syscall.Close(p[1])
+		if err != nil {
+			syscall.Close(p[0])
+			return err
+		}
+		*(*int32)(uapi.Ptr(ptr).Pointer()) = int32(p[0])
+	}
+
+	// The writeback job is consumed by the commit
+	props := d.objProps[id]
+	for i := range props {
+		switch props[i].prop.Name {
+		case "WRITEBACK_FB_ID", "WRITEBACK_OUT_FENCE_PTR":
+			props[i].value = 0
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package drmtest
+
+import (
+	"syscall"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const (
+	dumbPitchAlign = 64
+	dumbMapShift   = 12
+)
+
+type framebuffer struct {
+	drm.ModeFB2
+	owner *client
+	// Memory of each plane, starting at the plane's offset
+	data [4][]byte
+}
+
+func (c *client) modeCreateDumb(r *uapi.ModeCreateDumbArg) error {
+	if r.Width == 0 || r.Height == 0 || r.BPP == 0 || r.Flags != 0 {
+		return syscall.EINVAL
+	}
+	if r.Width > c.d.MaxWidth || r.Height > c.d.MaxHeight {
+		return syscall.EINVAL
+	}
+
+	pitch := (uint64(r.Width)*uint64((r.BPP+7)/8) + dumbPitchAlign - 1) &^ (dumbPitchAlign - 1)
+	size := pitch * uint64(r.Height)
+	if size > maxArrayLen {
+		return syscall.ENOMEM
+	}
+
+	handle := c.nextHandle
+	c.nextHandle++
+	c.dumbs[handle] = make([]byte, size)
+
+	r.Handle = handle
+	r.Pitch = uint32(pitch)
+	r.Size = size
+	return nil
+}
+
+func (c *client) modeMapDumb(r *uapi.ModeMapDumbArg) error {
+	if _, ok := c.dumbs[r.Handle]; !ok {
+		return syscall.ENOENT
+	}
+	r.Offset = uint64(r.Handle) << dumbMapShift
+	return nil
+}
+
+func (c *client) modeDestroyDumb(r *uapi.ModeDestroyDumbArg) error {
+	if _, ok := c.dumbs[r.Handle]; !ok {
+		return syscall.ENOENT
+	}
+	delete(c.dumbs, r.Handle)
+	return nil
+}
+
+// Mmap maps a dumb buffer. The returned slice aliases the fake buffer memory.
+func (c *client) Mmap(offset int64, length int) ([]byte, error) {
+	d := c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, ok := c.dumbs[uint32(offset>>dumbMapShift)]
+	if !ok || offset&(1<<dumbMapShift-1) != 0 {
+		return nil, syscall.EINVAL
+	}
+	if length <= 0 || length > len(data) {
+		return nil, syscall.EINVAL
+	}
+	return data[:length:length], nil
+}
+
+func (c *client) Munmap(b []byte) error {
+	return nil
+}
+
+func (c *client) modeAddFB2(r *uapi.ModeFBCmd2) error {
+	d := c.d
+	flags := drm.FBFlags(r.Flags)
+	if flags&^(drm.FBInterlaced|drm.FBModifiers) != 0 {
+		return syscall.EINVAL
+	}
+	if r.Width < d.MinWidth || r.Width > d.MaxWidth || r.Height < d.MinHeight || r.Height > d.MaxHeight {
+		return syscall.EINVAL
+	}
+	if r.PixelFormat == 0 || r.Handles[0] == 0 {
+		return syscall.EINVAL
+	}
+
+	fb := &framebuffer{
+		ModeFB2: drm.ModeFB2{
+			Width:   r.Width,
+			Height:  r.Height,
+			Format:  drm.Format(r.PixelFormat),
+			Flags:   flags,
+			Handles: r.Handles,
+			Pitches: r.Pitches,
+			Offsets: r.Offsets,
+		},
+		owner: c,
+	}
+	for i, handle := range r.Handles {
+		if flags&drm.FBModifiers != 0 {
+			// Dumb buffers are always linear
+			if drm.Modifier(r.Modifiers[i]) != drm.ModifierLinear {
+				return syscall.EINVAL
+			}
+			fb.Modifiers[i] = drm.Modifier(r.Modifiers[i])
+		}
+		if handle == 0 {
+			continue
+		}
+		data, ok := c.dumbs[handle]
+		if !ok {
+			return syscall.ENOENT
+		}
+		// Chroma planes of subsampled formats have fewer rows
+		height := uint64(r.Height)
+		if info := drm.Format(r.PixelFormat).Info(); info != nil && i > 0 {
+			height = (height + uint64(info.VSub) - 1) / uint64(info.VSub)
+		}
+		end := uint64(r.Offsets[i]) + uint64(r.Pitches[i])*height
+		if r.Pitches[i] == 0 || end > uint64(len(data)) {
+			return syscall.EINVAL
+		}
+		fb.data[i] = data[r.Offsets[i]:end]
+	}
+
+	id := drm.FBID(d.allocID(drm.ObjectFB))
+	d.fbs = append(d.fbs, id)
+	d.fbInfos[id] = fb
+	r.FBID = uint32(id)
+	return nil
+}
+
+func (c *client) modeRemoveFB(r *uapi.ModeRemoveFBArg) error {
+	d := c.d
+	id := drm.FBID(r.FBID)
+	fb, ok := d.fbInfos[id]
+	if !ok || fb.owner != c {
+		return syscall.ENOENT
+	}
+
+	delete(d.fbInfos, id)
+	delete(d.objects, drm.ObjectID(id))
+	for i, other := range d.fbs {
+		if other == id {
+			d.fbs = append(d.fbs[:i], d.fbs[i+1:]...)
+			break
+		}
+	}
+
+	// CRTCs and planes scanning out the FB are disabled
+	for _, crtc := range d.crtcs {
+		if crtc.FB == id {
+			d.disableCRTC(crtc)
+		}
+	}
+	for _, plane := range d.planes {
+		if plane.FB == id {
+			plane.FB = 0
+		}
+	}
+	for _, props := range d.objProps {
+		for i := range props {
+			if props[i].prop.Type == drm.PropertyObject && props[i].value == uint64(id) {
+				props[i].value = 0
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Package drmtest implements an in-memory fake KMS driver, to test code using
+// go-drm without a DRM device.
+package drmtest
+
+import (
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+type CRTC struct {
+	ID        drm.CRTCID
+	FB        drm.FBID
+	X, Y      uint32
+	GammaSize uint32
+	Mode      *drm.ModeModeInfo
+
+	seq   uint64
+	gamma [3][]uint16
+}
+
+type Encoder struct {
+	ID                            drm.EncoderID
+	Type                          drm.EncoderType
+	CRTC                          drm.CRTCID
+	PossibleCRTCs, PossibleClones uint32
+}
+
+type Connector struct {
+	ID       drm.ConnectorID
+	Type     drm.ConnectorType
+	TypeID   uint32
+	Encoder  drm.EncoderID
+	Encoders []drm.EncoderID
+	Modes    []drm.ModeModeInfo
+
+	Status              drm.ConnectorStatus
+	PhyWidth, PhyHeight uint32
+	Subpixel            drm.Subpixel
+}
+
+type Plane struct {
+	ID            drm.PlaneID
+	Type          drm.PlaneType
+	CRTC          drm.CRTCID
+	FB            drm.FBID
+	PossibleCRTCs uint32
+	GammaSize     uint32
+	Formats       []drm.Format
+}
+
+// Property describes a KMS property. Values contains the bounds of range
+// properties and the object type of object properties.
+type Property struct {
+	Name      string
+	Type      drm.PropertyType
+	Immutable bool
+	Atomic    bool
+	Values    []uint64
+	Enums     []drm.ModePropertyEnum
+}
+
+type property struct {
+	Property
+	id drm.PropertyID
+}
+
+func (prop *property) flags() uint32 {
+	flags := uint32(prop.Type)
+	if prop.Immutable {
+		flags |= 1 << 2
+	}
+	if prop.Atomic {
+		flags |= 1 << 31
+	}
+	return flags
+}
+
+type propertyValue struct {
+	prop  *property
+	value uint64
+}
+
+// Driver is a fake KMS driver. Its topology is configured with the Add
+// methods, and can be accessed through nodes created with NewNode.
+type Driver struct {
+	Version                                  drm.Version
+	Unique                                   string
+	Caps                                     map[drm.Cap]uint64
+	MinWidth, MaxWidth, MinHeight, MaxHeight uint32
+
+	mu         sync.Mutex
+	nextID     uint32
+	objects    map[drm.ObjectID]drm.ObjectType
+	fbs        []drm.FBID
+	crtcs      []*CRTC
+	encoders   []*Encoder
+	connectors []*Connector
+	planes     []*Plane
+	props      map[drm.PropertyID]*property
+	propNames  map[string]*property
+	objProps   map[drm.ObjectID][]propertyValue
+	blobs      map[drm.BlobID][]byte
+	blobOwners map[drm.BlobID]*client
+	fbInfos    map[drm.FBID]*framebuffer
+	pending    []*pendingEvent
+}
+
+func NewDriver() *Driver {
+	return &Driver{
+		Version: drm.Version{
+			Major: 1,
+			Name:  "drmtest",
+			Date:  "20200101",
+			Desc:  "Fake KMS driver",
+		},
+		Unique: "platform:drmtest",
+		Caps: map[drm.Cap]uint64{
+			drm.CapDumbBuffer:         1,
+			drm.CapDumbPreferredDepth: 24,
+			drm.CapTimestampMonotonic: 1,
+			drm.CapCursorWidth:        64,
+			drm.CapCursorHeight:       64,
+			drm.CapAddFB2Modifiers:    1,
+			drm.CapVblankHighCRTC:     1,
+			drm.CapCRTCInVBlankEvent:  1,
+		},
+		MinWidth:   1,
+		MaxWidth:   8192,
+		MinHeight:  1,
+		MaxHeight:  8192,
+		nextID:     1,
+		objects:    make(map[drm.ObjectID]drm.ObjectType),
+		props:      make(map[drm.PropertyID]*property),
+		propNames:  make(map[string]*property),
+		objProps:   make(map[drm.ObjectID][]propertyValue),
+		blobs:      make(map[drm.BlobID][]byte),
+		blobOwners: make(map[drm.BlobID]*client),
+		fbInfos:    make(map[drm.FBID]*framebuffer),
+	}
+}
+
+func (d *Driver) allocID(t drm.ObjectType) drm.ObjectID {
+	id := drm.ObjectID(d.nextID)
+	d.nextID++
+	d.objects[id] = t
+	return id
+}
+
+func (d *Driver) AddCRTC(crtc *CRTC) drm.CRTCID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	crtc.ID = drm.CRTCID(d.allocID(drm.ObjectCRTC))
+	d.crtcs = append(d.crtcs, crtc)
+	return crtc.ID
+}
+
+func (d *Driver) AddEncoder(enc *Encoder) drm.EncoderID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	enc.ID = drm.EncoderID(d.allocID(drm.ObjectEncoder))
+	d.encoders = append(d.encoders, enc)
+	return enc.ID
+}
+
+// AddConnector adds a connector. If the type ID is zero, the next free one
+// for the connector type is used.
+func (d *Driver) AddConnector(conn *Connector) drm.ConnectorID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if conn.TypeID == 0 {
+		conn.TypeID = 1
+		for _, other := range d.connectors {
+			if other.Type == conn.Type && other.TypeID >= conn.TypeID {
+				conn.TypeID = other.TypeID + 1
+			}
+		}
+	}
+
+	conn.ID = drm.ConnectorID(d.allocID(drm.ObjectConnector))
+	d.connectors = append(d.connectors, conn)
+	return conn.ID
+}
+
+// AddPlane adds a plane, along with its immutable "type" property.
+func (d *Driver) AddPlane(plane *Plane) drm.PlaneID {
+	d.mu.Lock()
+	plane.ID = drm.PlaneID(d.allocID(drm.ObjectPlane))
+	d.planes = append(d.planes, plane)
+	d.mu.Unlock()
+
+	d.AddProperty(plane.ID, &Property{
+		Name:      "type",
+		Type:      drm.PropertyEnum,
+		Immutable: true,
+		Enums: []drm.ModePropertyEnum{
+			{Name: "Overlay", Value: uint64(drm.PlaneOverlay)},
+			{Name: "Primary", Value: uint64(drm.PlanePrimary)},
+			{Name: "Cursor", Value: uint64(drm.PlaneCursor)},
+		},
+	}, uint64(plane.Type))
+	return plane.ID
+}
+
+// AddProperty attaches a property to an object. Properties are identified by
+// name: if a property with the same name already exists, it is reused and
+// prop is ignored.
+func (d *Driver) AddProperty(obj drm.AnyID, prop *Property, value uint64) drm.PropertyID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.propNames[prop.Name]
+	if !ok {
+		p = &property{Property: *prop}
+		p.id = drm.PropertyID(d.allocID(drm.ObjectProperty))
+		d.props[p.id] = p
+		d.propNames[p.Name] = p
+	}
+
+	id := obj.Object()
+	d.objProps[id] = append(d.objProps[id], propertyValue{p, value})
+	return p.id
+}
+
+// SetProperty updates the value of an object's property. It returns false if
+// the object doesn't have the property.
+func (d *Driver) SetProperty(obj drm.AnyID, name string, value uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	props := d.objProps[obj.Object()]
+	for i := range props {
+		if props[i].prop.Name == name {
+			props[i].value = value
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Driver) CreateBlob(data []byte) drm.BlobID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := drm.BlobID(d.allocID(drm.ObjectBlob))
+	d.blobs[id] = append([]byte(nil), data...)
+	return id
+}
+
+// NewBackend creates a new client of the driver. Each client has its own
+// client caps, like an open file description of a DRM device.
+func (d *Driver) NewBackend() drm.Backend {
+	return &client{
+		d:          d,
+		caps:       make(map[drm.ClientCap]uint64),
+		dumbs:      make(map[uint32][]byte),
+		nextHandle: 1,
+	}
+}
+
+// NewNode creates a node for a new client of the driver.
+func (d *Driver) NewNode() *drm.Node {
+	return drm.NewNodeWithBackend(d.NewBackend())
+}
+
+type client struct {
+	d          *Driver
+	caps       map[drm.ClientCap]uint64
+	events     [][]byte
+	dumbs      map[uint32][]byte
+	nextHandle uint32
+}
+
+func (c *client) Ioctl(req uint32, arg unsafe.Pointer) error {
+	d := c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch req {
+	case uapi.IoctlVersion:
+		return c.version((*uapi.VersionResp)(arg))
+	case uapi.IoctlGetUnique:
+		return c.getUnique((*uapi.UniqueResp)(arg))
+	case uapi.IoctlSetVersion:
+		return c.setVersion((*uapi.SetVersionArg)(arg))
+	case uapi.IoctlGetCap:
+		return c.getCap((*uapi.GetCapArg)(arg))
+	case uapi.IoctlSetClientCap:
+		return c.setClientCap((*uapi.SetCapArg)(arg))
+	case uapi.IoctlWaitVBlank:
+		return c.waitVBlank((*uapi.WaitVBlankArg)(arg))
+	case uapi.IoctlCRTCGetSequence:
+		return c.crtcGetSequence((*uapi.CRTCGetSequenceArg)(arg))
+	case uapi.IoctlCRTCQueueSequence:
+		return c.crtcQueueSequence((*uapi.CRTCQueueSequenceArg)(arg))
+	case uapi.IoctlModeGetResources:
+		return c.modeGetResources((*uapi.ModeCardResp)(arg))
+	case uapi.IoctlModeGetCRTC:
+		return c.modeGetCRTC((*uapi.ModeCRTCResp)(arg))
+	case uapi.IoctlModeSetCRTC:
+		return c.modeSetCRTC((*uapi.ModeCRTCResp)(arg))
+	case uapi.IoctlModeGetGamma:
+		return c.modeGetGamma((*uapi.ModeCRTCLUT)(arg))
+	case uapi.IoctlModeSetGamma:
+		return c.modeSetGamma((*uapi.ModeCRTCLUT)(arg))
+	case uapi.IoctlModeGetEncoder:
+		return c.modeGetEncoder((*uapi.ModeEncoderResp)(arg))
+	case uapi.IoctlModeGetConnector:
+		return c.modeGetConnector((*uapi.ModeConnectorResp)(arg))
+	case uapi.IoctlModeRemoveFB:
+		return c.modeRemoveFB((*uapi.ModeRemoveFBArg)(arg))
+	case uapi.IoctlModePageFlip:
+		return c.modePageFlip((*uapi.ModeCRTCPageFlipArg)(arg))
+	case uapi.IoctlModeCreateDumb:
+		return c.modeCreateDumb((*uapi.ModeCreateDumbArg)(arg))
+	case uapi.IoctlModeMapDumb:
+		return c.modeMapDumb((*uapi.ModeMapDumbArg)(arg))
+	case uapi.IoctlModeDestroyDumb:
+		return c.modeDestroyDumb((*uapi.ModeDestroyDumbArg)(arg))
+	case uapi.IoctlModeAddFB2:
+		return c.modeAddFB2((*uapi.ModeFBCmd2)(arg))
+	case uapi.IoctlModeAtomic:
+		return c.modeAtomic((*uapi.ModeAtomicArg)(arg))
+	case uapi.IoctlModeGetPlaneResources:
+		return c.modeGetPlaneResources((*uapi.ModePlaneResourcesResp)(arg))
+	case uapi.IoctlModeGetPlane:
+		return c.modeGetPlane((*uapi.ModePlaneResp)(arg))
+	case uapi.IoctlModeSetPlane:
+		return c.modeSetPlane((*uapi.ModeSetPlaneArg)(arg))
+	case uapi.IoctlModeObjectGetProperties:
+		return c.modeObjectGetProperties((*uapi.ModeObjectGetPropertiesResp)(arg))
+	case uapi.IoctlModeGetProperty:
+		return c.modeGetProperty((*uapi.ModeGetPropertyResp)(arg))
+	case uapi.IoctlModeGetBlob:
+		return c.modeGetBlob((*uapi.ModeGetBlobResp)(arg))
+	case uapi.IoctlModeObjectSetProperty:
+		return c.modeObjectSetProperty((*uapi.ModeObjectSetPropertyArg)(arg))
+	case uapi.IoctlModeCreateBlob:
+		return c.modeCreateBlob((*uapi.ModeCreateBlobArg)(arg))
+	case uapi.IoctlModeDestroyBlob:
+		return c.modeDestroyBlob((*uapi.ModeDestroyBlobArg)(arg))
+	default:
+		return syscall.ENOTTY
+	}
+}
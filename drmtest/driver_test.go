@@ -0,0 +1,689 @@
+package drmtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/drmtest"
+)
+
+var testMode = drm.ModeModeInfo{
+	Clock:      148500,
+	HDisplay:   1920,
+	HSyncStart: 2008,
+	HSyncEnd:   2052,
+	HTotal:     2200,
+	VDisplay:   1080,
+	VSyncStart: 1084,
+	VSyncEnd:   1089,
+	VTotal:     1125,
+	VRefresh:   60,
+	Name:       "1920x1080",
+}
+
+func newTestDriver() *drmtest.Driver {
+	d := drmtest.NewDriver()
+	crtc := d.AddCRTC(&drmtest.CRTC{GammaSize: 256})
+	enc := d.AddEncoder(&drmtest.Encoder{Type: drm.EncoderTDMS, PossibleCRTCs: 0x1})
+	d.AddConnector(&drmtest.Connector{
+		Type:     drm.ConnectorHDMIA,
+		Encoders: []drm.EncoderID{enc},
+		Modes:    []drm.ModeModeInfo{testMode},
+		Status:   drm.ConnectorStatusConnected,
+	})
+	primary := d.AddPlane(&drmtest.Plane{
+		Type:          drm.PlanePrimary,
+		CRTC:          crtc,
+		PossibleCRTCs: 0x1,
+		Formats:       []drm.Format{drm.FormatXRGB8888, drm.FormatARGB8888},
+	})
+	d.AddProperty(primary, &drmtest.Property{
+		Name:   "zpos",
+		Type:   drm.PropertyRange,
+		Values: []uint64{0, 2},
+	}, 1)
+	return d
+}
+
+func TestDriver(t *testing.T) {
+	n := newTestDriver().NewNode()
+
+	v, err := n.Version()
+	if err != nil {
+		t.Fatalf("Version() = %v", err)
+	}
+	if v.Driver() != "drmtest" {
+		t.Errorf("Version().Driver() = %q, want %q", v.Driver(), "drmtest")
+	}
+
+	caps, err := n.Caps()
+	if err != nil {
+		t.Fatalf("Caps() = %v", err)
+	}
+	if !caps.DumbBuffer || caps.CursorWidth != 64 || caps.SyncObj {
+		t.Errorf("Caps() = %+v, want dumb buffers, 64px cursor and no syncobj", caps)
+	}
+
+	busID, err := n.BusID()
+	if err != nil {
+		t.Fatalf("BusID() = %v", err)
+	}
+	if busID != "platform:drmtest" {
+		t.Errorf("BusID() = %q, want %q", busID, "platform:drmtest")
+	}
+
+	card, err := n.ModeGetResources()
+	if err != nil {
+		t.Fatalf("ModeGetResources() = %v", err)
+	}
+	if len(card.CRTCs) != 1 || len(card.Encoders) != 1 || len(card.Connectors) != 1 {
+		t.Fatalf("ModeGetResources() = %+v, want 1 CRTC, encoder and connector", card)
+	}
+
+	conn, err := n.ModeGetConnector(card.Connectors[0])
+	if err != nil {
+		t.Fatalf("ModeGetConnector() = %v", err)
+	}
+	if name := conn.Name(); name != "HDMI-A-1" {
+		t.Errorf("Name() = %q, want %q", name, "HDMI-A-1")
+	}
+	if !reflect.DeepEqual(conn.Modes, []drm.ModeModeInfo{testMode}) {
+		t.Errorf("Modes = %+v, want %+v", conn.Modes, testMode)
+	}
+
+	// Primary planes are hidden without universal planes
+	planes, err := n.ModeGetPlaneResources()
+	if err != nil {
+		t.Fatalf("ModeGetPlaneResources() = %v", err)
+	}
+	if len(planes) != 0 {
+		t.Errorf("ModeGetPlaneResources() = %v, want no plane", planes)
+	}
+
+	if err := n.SetClientCap(drm.ClientCapUniversalPlanes, 1); err != nil {
+		t.Fatalf("SetClientCap() = %v", err)
+	}
+	planes, err = n.ModeGetPlaneResources()
+	if err != nil {
+		t.Fatalf("ModeGetPlaneResources() = %v", err)
+	}
+	if len(planes) != 1 {
+		t.Fatalf("ModeGetPlaneResources() = %v, want one plane", planes)
+	}
+
+	info, err := n.ModeGetPlaneInfo(planes[0])
+	if err != nil {
+		t.Fatalf("ModeGetPlaneInfo() = %v", err)
+	}
+	if info.Type != drm.PlanePrimary {
+		t.Errorf("Type = %v, want %v", info.Type, drm.PlanePrimary)
+	}
+	if !info.HasZPos || info.ZPos != 1 || info.ZPosMax != 2 {
+		t.Errorf("ZPos = %v (%v..%v), want 1 (0..2)", info.ZPos, info.ZPosMin, info.ZPosMax)
+	}
+	if !info.InFormats.Has(drm.FormatARGB8888, drm.ModifierInvalid) {
+		t.Errorf("InFormats doesn't contain ARGB8888 with implicit modifier")
+	}
+}
+
+func TestDriver_notFound(t *testing.T) {
+	n := newTestDriver().NewNode()
+
+	_, err := n.ModeGetCRTC(1234)
+	if !errors.Is(err, drm.ErrNotFound) {
+		t.Errorf("ModeGetCRTC() = %v, want ErrNotFound", err)
+	}
+	var drmErr *drm.Error
+	if !errors.As(err, &drmErr) || drmErr.Op != "MODE_GETCRTC" || drmErr.Object != 1234 {
+		t.Errorf("ModeGetCRTC() = %#v, want MODE_GETCRTC error on object 1234", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	n := newTestDriver().NewNode()
+
+	s, err := n.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	if len(s.Planes) != 1 || s.Planes[0].Properties["type"].Enum != "Primary" {
+		t.Errorf("Snapshot().Planes = %+v, want one primary plane", s.Planes)
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	var s2 drm.Snapshot
+	if err := json.Unmarshal(b, &s2); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(s, &s2) {
+		t.Errorf("JSON round-trip mismatch:\n%+v\n%+v", s, &s2)
+	}
+}
+
+func TestSnapshot_sideEffects(t *testing.T) {
+	var trace bytes.Buffer
+	rec := drm.NewRecorder(newTestDriver().NewBackend(), &trace)
+	if _, err := drm.NewNodeWithBackend(rec).Snapshot(); err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+
+	dec := json.NewDecoder(&trace)
+	for {
+		var entry drm.TraceEntry
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		switch entry.Name {
+		case "SET_VERSION":
+			t.Errorf("Snapshot() changed the interface version")
+		case "SET_CLIENT_CAP":
+			if cap := drm.ClientCap(entry.Arg["Cap"].(float64)); cap != drm.ClientCapUniversalPlanes {
+				t.Errorf("Snapshot() enabled client cap %v", cap)
+			}
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var trace bytes.Buffer
+	rec := drm.NewRecorder(newTestDriver().NewBackend(), &trace)
+	want, err := drm.NewNodeWithBackend(rec).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Recorder.Err() = %v", err)
+	}
+
+	rep, err := drm.NewReplayer(&trace)
+	if err != nil {
+		t.Fatalf("NewReplayer() = %v", err)
+	}
+	got, err := drm.NewNodeWithBackend(rep).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	if !rep.Done() {
+		t.Errorf("Done() = false, want true")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed snapshot mismatch:\n%+v\n%+v", got, want)
+	}
+}
+
+func TestRecordReplay_inputs(t *testing.T) {
+	d := newTestDriver()
+	crtc := d.AddCRTC(&drmtest.CRTC{Mode: &testMode, GammaSize: 4})
+	record := func(n *drm.Node, lut drm.ColorLUT) error {
+		if err := n.ModeSetGamma(crtc, lut); err != nil {
+			return err
+		}
+		if _, err := n.CRTCQueueSequence(crtc, 1, drm.CRTCSequenceRelative, 42); err != nil {
+			return err
+		}
+		d.VBlank(crtc)
+		events, err := n.ReadEvents()
+		if err != nil {
+			return err
+		}
+		if len(events) != 1 {
+			return fmt.Errorf("ReadEvents() = %v, want a single event", events)
+		}
+		return nil
+	}
+
+	var trace bytes.Buffer
+	rec := drm.NewRecorder(d.NewBackend(), &trace)
+	if err := record(drm.NewNodeWithBackend(rec), drm.NewGammaLUT(4, 2.2)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Recorder.Err() = %v", err)
+	}
+
+	rep, err := drm.NewReplayer(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReplayer() = %v", err)
+	}
+	if err := record(drm.NewNodeWithBackend(rep), drm.NewGammaLUT(4, 2.2)); err != nil {
+		t.Errorf("replay: %v", err)
+	}
+	if !rep.Done() {
+		t.Errorf("Done() = false, want true")
+	}
+
+	rep, err = drm.NewReplayer(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReplayer() = %v", err)
+	}
+	if _, err := rep.Read(make([]byte, 4096)); err == nil {
+		t.Errorf("Read() succeeded before an ioctl")
+	}
+	if err := drm.NewNodeWithBackend(rep).ModeSetGamma(crtc, drm.NewGammaLUT(4, 1)); err == nil {
+		t.Errorf("ModeSetGamma() with a different LUT succeeded")
+	}
+}
+
+func TestRecordReplay_writeback(t *testing.T) {
+	d := drmtest.NewDriver()
+	crtc := d.AddCRTC(&drmtest.CRTC{Mode: &drm.ModeModeInfo{
+		HDisplay: 64,
+		VDisplay: 32,
+		VRefresh: 60,
+		Name:     "64x32",
+	}})
+	conn := d.AddWritebackConnector(&drmtest.Connector{}, []drm.Format{drm.FormatXRGB8888})
+
+	var trace bytes.Buffer
+	rec := drm.NewRecorder(d.NewBackend(), &trace)
+	if _, err := drm.NewNodeWithBackend(rec).WritebackCapture(conn, crtc, time.Second); err != nil {
+		t.Fatalf("WritebackCapture() = %v", err)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatalf("Recorder.Err() = %v", err)
+	}
+
+	rep, err := drm.NewReplayer(&trace)
+	if err != nil {
+		t.Fatalf("NewReplayer() = %v", err)
+	}
+	img, err := drm.NewNodeWithBackend(rep).WritebackCapture(conn, crtc, time.Second)
+	if err != nil {
+		t.Fatalf("replayed WritebackCapture() = %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+		t.Errorf("replayed WritebackCapture() size = %v", img.Bounds())
+	}
+	if !rep.Done() {
+		t.Errorf("Done() = false, want true")
+	}
+}
+
+func TestVBlank(t *testing.T) {
+	d := drmtest.NewDriver()
+	mode := testMode
+	crtc := d.AddCRTC(&drmtest.CRTC{Mode: &mode})
+	n := d.NewNode()
+
+	reply, err := n.WaitVBlank(&drm.WaitVBlankRequest{Sequence: 2, Relative: true})
+	if err != nil {
+		t.Fatalf("WaitVBlank() = %v", err)
+	}
+	if reply.Sequence != 2 || reply.Time != (2*time.Second/60).Truncate(time.Microsecond) {
+		t.Errorf("WaitVBlank() = %+v, want sequence 2", reply)
+	}
+
+	if _, err := n.WaitVBlank(&drm.WaitVBlankRequest{CRTCIndex: 1}); err == nil {
+		t.Errorf("WaitVBlank() on missing CRTC succeeded")
+	}
+
+	seq, err := n.CRTCGetSequence(crtc)
+	if err != nil {
+		t.Fatalf("CRTCGetSequence() = %v", err)
+	}
+	if !seq.Active || seq.Sequence != 2 {
+		t.Errorf("CRTCGetSequence() = %+v, want active with sequence 2", seq)
+	}
+
+	queued, err := n.CRTCQueueSequence(crtc, 1, drm.CRTCSequenceRelative, 42)
+	if err != nil {
+		t.Fatalf("CRTCQueueSequence() = %v", err)
+	}
+	if queued != 3 {
+		t.Errorf("CRTCQueueSequence() = %v, want 3", queued)
+	}
+	if _, err := n.WaitVBlank(&drm.WaitVBlankRequest{Sequence: 1, Relative: true, Event: true, UserData: 43}); err != nil {
+		t.Fatalf("WaitVBlank() = %v", err)
+	}
+	if _, err := n.ReadEvents(); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("ReadEvents() = %v, want EAGAIN", err)
+	}
+
+	d.VBlank(crtc)
+	events, err := n.ReadEvents()
+	if err != nil {
+		t.Fatalf("ReadEvents() = %v", err)
+	}
+	want := []drm.Event{
+		&drm.CRTCSequenceEvent{UserData: 42, Time: 3 * time.Second / 60, Sequence: 3},
+		&drm.VBlankEvent{Type: drm.EventVBlank, UserData: 43, Time: 3 * time.Second / 60, Sequence: 3, CRTC: crtc},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("ReadEvents() = %v, want %v", events, want)
+	}
+}
+
+func TestColor(t *testing.T) {
+	d := drmtest.NewDriver()
+	crtc := d.AddCRTC(&drmtest.CRTC{GammaSize: 4})
+	d.AddProperty(crtc, &drmtest.Property{Name: "GAMMA_LUT", Type: drm.PropertyBlob}, 0)
+	d.AddProperty(crtc, &drmtest.Property{
+		Name:      "GAMMA_LUT_SIZE",
+		Type:      drm.PropertyRange,
+		Immutable: true,
+		Values:    []uint64{0, 4096},
+	}, 16)
+	d.AddProperty(crtc, &drmtest.Property{Name: "CTM", Type: drm.PropertyBlob}, 0)
+	n := d.NewNode()
+
+	lut := drm.NewGammaLUT(4, 2.2)
+	if err := n.ModeSetGamma(crtc, lut); err != nil {
+		t.Fatalf("ModeSetGamma() = %v", err)
+	}
+	if got, err := n.ModeGetGamma(crtc); err != nil {
+		t.Fatalf("ModeGetGamma() = %v", err)
+	} else if !reflect.DeepEqual(got, lut) {
+		t.Errorf("ModeGetGamma() = %v, want %v", got, lut)
+	}
+	if err := n.ModeSetGamma(crtc, drm.NewGammaLUT(8, 1)); err == nil {
+		t.Errorf("ModeSetGamma() succeeded with the wrong size")
+	}
+
+	gammaLUT := drm.NewColorTemperatureLUT(16, 4000)
+	if err := n.ModeSetCRTCGammaLUT(crtc, gammaLUT); err != nil {
+		t.Fatalf("ModeSetCRTCGammaLUT() = %v", err)
+	}
+	if err := n.ModeSetCRTCGammaLUT(crtc, lut); err == nil {
+		t.Errorf("ModeSetCRTCGammaLUT() succeeded with the wrong size")
+	}
+	if err := n.ModeSetCRTCCTM(crtc, &drm.IdentityColorMatrix); err != nil {
+		t.Fatalf("ModeSetCRTCCTM() = %v", err)
+	}
+
+	color, err := n.ModeGetCRTCColor(crtc)
+	if err != nil {
+		t.Fatalf("ModeGetCRTCColor() = %v", err)
+	}
+	if color.GammaLUTSize != 16 || color.DegammaLUTSize != 0 || !color.HasCTM {
+		t.Errorf("ModeGetCRTCColor() = %+v, want 16-entry gamma LUT and CTM", color)
+	}
+	if !reflect.DeepEqual(color.GammaLUT, gammaLUT) {
+		t.Errorf("ModeGetCRTCColor().GammaLUT = %v, want %v", color.GammaLUT, gammaLUT)
+	}
+	if color.CTM == nil || *color.CTM != drm.IdentityColorMatrix {
+		t.Errorf("ModeGetCRTCColor().CTM = %v, want identity", color.CTM)
+	}
+}
+
+func TestConnectorProperties(t *testing.T) {
+	d := drmtest.NewDriver()
+	conn := d.AddConnector(&drmtest.Connector{Type: drm.ConnectorEDP, Status: drm.ConnectorStatusConnected})
+	d.AddProperty(conn, &drmtest.Property{
+		Name: "Colorspace",
+		Type: drm.PropertyEnum,
+		Enums: []drm.ModePropertyEnum{
+			{Name: "Default", Value: 0},
+			{Name: "BT2020_RGB", Value: 9},
+			{Name: "BT2020_YCC", Value: 10},
+		},
+	}, 0)
+	d.AddProperty(conn, &drmtest.Property{Name: "max bpc", Type: drm.PropertyRange, Values: []uint64{6, 12}}, 8)
+	d.AddProperty(conn, &drmtest.Property{
+		Name:      "panel orientation",
+		Type:      drm.PropertyEnum,
+		Immutable: true,
+		Enums: []drm.ModePropertyEnum{
+			{Name: "Normal", Value: 0},
+			{Name: "Upside Down", Value: 1},
+		},
+	}, 1)
+	d.AddProperty(conn, &drmtest.Property{
+		Name:      "vrr_capable",
+		Type:      drm.PropertyRange,
+		Immutable: true,
+		Values:    []uint64{0, 1},
+	}, 1)
+	d.AddProperty(conn, &drmtest.Property{
+		Name:      "privacy-screen hw-state",
+		Type:      drm.PropertyEnum,
+		Immutable: true,
+		Enums: []drm.ModePropertyEnum{
+			{Name: "Disabled", Value: 0},
+			{Name: "Enabled", Value: 1},
+			{Name: "Disabled-locked", Value: 2},
+			{Name: "Enabled-locked", Value: 3},
+		},
+	}, 3)
+	n := d.NewNode()
+
+	props, err := n.ModeGetConnectorProperties(conn)
+	if err != nil {
+		t.Fatalf("ModeGetConnectorProperties() = %v", err)
+	}
+	if cs, ok := props.Colorspace(); !ok || cs != drm.ColorspaceDefault {
+		t.Errorf("Colorspace() = %v, %v, want %v", cs, ok, drm.ColorspaceDefault)
+	}
+	want := []drm.Colorspace{drm.ColorspaceDefault, drm.ColorspaceBT2020RGB, drm.ColorspaceBT2020YCC}
+	if l := props.SupportedColorspaces(); !reflect.DeepEqual(l, want) {
+		t.Errorf("SupportedColorspaces() = %v, want %v", l, want)
+	}
+	if o, ok := props.PanelOrientation(); !ok || o != drm.PanelOrientationUpsideDown {
+		t.Errorf("PanelOrientation() = %v, %v, want %v", o, ok, drm.PanelOrientationUpsideDown)
+	}
+	if !props.VRRCapable() {
+		t.Errorf("VRRCapable() = false, want true")
+	}
+	if s, ok := props.PrivacyScreenHW(); !ok || s != drm.PrivacyScreenEnabledLocked {
+		t.Errorf("PrivacyScreenHW() = %v, %v, want %v", s, ok, drm.PrivacyScreenEnabledLocked)
+	}
+	if _, ok := props.PrivacyScreen(); ok {
+		t.Errorf("PrivacyScreen() succeeded without the property")
+	}
+	if _, ok := props.BroadcastRGB(); ok {
+		t.Errorf("BroadcastRGB() succeeded without the property")
+	}
+
+	if err := props.SetColorspace(drm.ColorspaceBT2020RGB); err != nil {
+		t.Fatalf("SetColorspace() = %v", err)
+	}
+	if err := props.SetColorspace(drm.ColorspaceOpRGB); err == nil {
+		t.Errorf("SetColorspace() succeeded with an unsupported colorspace")
+	}
+	if err := props.SetMaxBPC(10); err != nil {
+		t.Fatalf("SetMaxBPC() = %v", err)
+	}
+	if err := props.SetMaxBPC(16); err == nil {
+		t.Errorf("SetMaxBPC() succeeded with an out-of-range value")
+	}
+
+	props, err = n.ModeGetConnectorProperties(conn)
+	if err != nil {
+		t.Fatalf("ModeGetConnectorProperties() = %v", err)
+	}
+	if cs, ok := props.Colorspace(); !ok || cs != drm.ColorspaceBT2020RGB {
+		t.Errorf("Colorspace() = %v, %v, want %v", cs, ok, drm.ColorspaceBT2020RGB)
+	}
+	if bpc, ok := props.MaxBPC(); !ok || bpc != 10 {
+		t.Errorf("MaxBPC() = %v, %v, want 10", bpc, ok)
+	}
+}
+
+func TestWritebackCapture(t *testing.T) {
+	const width, height = 64, 32
+
+	d := drmtest.NewDriver()
+	crtc := d.AddCRTC(&drmtest.CRTC{Mode: &drm.ModeModeInfo{
+		HDisplay: width,
+		VDisplay: height,
+		VRefresh: 60,
+		Name:     "64x32",
+	}})
+	primary := d.AddPlane(&drmtest.Plane{
+		Type:          drm.PlanePrimary,
+		CRTC:          crtc,
+		PossibleCRTCs: 0x1,
+		Formats:       []drm.Format{drm.FormatXRGB8888},
+	})
+	fbProp := d.AddProperty(primary, &drmtest.Property{
+		Name:   "FB_ID",
+		Type:   drm.PropertyObject,
+		Atomic: true,
+		Values: []uint64{uint64(drm.ObjectFB)},
+	}, 0)
+	d.AddProperty(primary, &drmtest.Property{
+		Name:   "CRTC_ID",
+		Type:   drm.PropertyObject,
+		Atomic: true,
+		Values: []uint64{uint64(drm.ObjectCRTC)},
+	}, uint64(crtc))
+	conn := d.AddWritebackConnector(&drmtest.Connector{}, []drm.Format{drm.FormatXRGB8888})
+
+	n := d.NewNode()
+	if err := n.SetClientCap(drm.ClientCapAtomic, 1); err != nil {
+		t.Fatalf("SetClientCap() = %v", err)
+	}
+
+	buf, err := n.ModeCreateDumb(width, height, 32)
+	if err != nil {
+		t.Fatalf("ModeCreateDumb() = %v", err)
+	}
+	data, err := n.MapDumb(buf)
+	if err != nil {
+		t.Fatalf("MapDumb() = %v", err)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// XRGB8888 is stored as little-endian B, G, R, X
+			px := data[y*int(buf.Pitch)+4*x:]
+			px[0], px[1], px[2], px[3] = byte(y), byte(x), 0xFF, 0
+		}
+	}
+	fb, err := n.ModeAddFB2(&drm.ModeFB2{
+		Width:   width,
+		Height:  height,
+		Format:  drm.FormatXRGB8888,
+		Handles: [4]uint32{buf.Handle},
+		Pitches: [4]uint32{buf.Pitch},
+	})
+	if err != nil {
+		t.Fatalf("ModeAddFB2() = %v", err)
+	}
+
+	var req drm.AtomicRequest
+	req.Add(primary, fbProp, uint64(fb))
+	if err := n.ModeAtomicCommit(&req, drm.AtomicPageFlipEvent, 42); err != nil {
+		t.Fatalf("ModeAtomicCommit() = %v", err)
+	}
+	d.VBlank(crtc)
+	events, err := n.ReadEvents()
+	if err != nil {
+		t.Fatalf("ReadEvents() = %v", err)
+	}
+	if len(events) != 1 || events[0].EventType() != drm.EventFlipComplete {
+		t.Errorf("ReadEvents() = %v, want a single flip event", events)
+	}
+
+	img, err := n.WritebackCapture(conn, crtc, time.Second)
+	if err != nil {
+		t.Fatalf("WritebackCapture() = %v", err)
+	}
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != height {
+		t.Fatalf("WritebackCapture() size = %v", img.Bounds())
+	}
+	for _, p := range []struct{ x, y int }{{0, 0}, {10, 20}, {width - 1, height - 1}} {
+		r, g, b, a := img.At(p.x, p.y).RGBA()
+		want := [4]uint32{0xFFFF, uint32(p.x) * 0x101, uint32(p.y) * 0x101, 0xFFFF}
+		if got := [4]uint32{r, g, b, a}; got != want {
+			t.Errorf("pixel at (%v, %v) = %v, want %v", p.x, p.y, got, want)
+		}
+	}
+
+	props, err := n.ModeObjectGetProperties(conn)
+	if err != nil {
+		t.Fatalf("ModeObjectGetProperties() = %v", err)
+	}
+	for id, v := range props {
+		prop, err := n.ModeGetProperty(id)
+		if err != nil {
+			t.Fatalf("ModeGetProperty() = %v", err)
+		}
+		if prop.Name == "CRTC_ID" && v != 0 {
+			t.Errorf("connector CRTC_ID = %v after capture, want 0", v)
+		}
+	}
+}
+
+func TestLegacyModeset(t *testing.T) {
+	d := newTestDriver()
+	n := d.NewNode()
+	n.SetClientCap(drm.ClientCapUniversalPlanes, 1)
+
+	card, err := n.ModeGetResources()
+	if err != nil {
+		t.Fatalf("ModeGetResources() = %v", err)
+	}
+	crtc, conn := card.CRTCs[0], card.Connectors[0]
+
+	var fbs [2]*drm.DumbFramebuffer
+	for i := range fbs {
+		fbs[i], err = n.CreateDumbFramebuffer(drm.FormatXRGB8888, 1920, 1080)
+		if err != nil {
+			t.Fatalf("CreateDumbFramebuffer() = %v", err)
+		}
+	}
+
+	if err := n.ModeSetCRTC(crtc, fbs[0].ID, 0, 0, []drm.ConnectorID{conn}, &testMode); err != nil {
+		t.Fatalf("ModeSetCRTC() = %v", err)
+	}
+	got, err := n.ModeGetCRTC(crtc)
+	if err != nil {
+		t.Fatalf("ModeGetCRTC() = %v", err)
+	}
+	if got.FB != fbs[0].ID || got.Mode == nil || *got.Mode != testMode {
+		t.Errorf("ModeGetCRTC() = %+v, want FB %v and mode %+v", got, fbs[0].ID, testMode)
+	}
+
+	if err := n.ModePageFlip(crtc, fbs[1].ID, drm.PageFlipEvent, 0, 42); err != nil {
+		t.Fatalf("ModePageFlip() = %v", err)
+	}
+	// Only one flip can be pending at a time
+	if err := n.ModePageFlip(crtc, fbs[0].ID, drm.PageFlipEvent, 0, 43); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("ModePageFlip() = %v, want EBUSY", err)
+	}
+	d.VBlank(crtc)
+	events, err := n.ReadEvents()
+	if err != nil {
+		t.Fatalf("ReadEvents() = %v", err)
+	}
+	if len(events) != 1 || events[0].EventType() != drm.EventFlipComplete || events[0].(*drm.VBlankEvent).UserData != 42 {
+		t.Errorf("ReadEvents() = %+v, want a flip-complete event", events)
+	}
+
+	// Removing the scanned out FB disables the CRTC
+	if err := n.DestroyDumbFramebuffer(fbs[1]); err != nil {
+		t.Fatalf("DestroyDumbFramebuffer() = %v", err)
+	}
+	if got, err := n.ModeGetCRTC(crtc); err != nil || got.Mode != nil {
+		t.Errorf("ModeGetCRTC() = %+v, %v, want a disabled CRTC", got, err)
+	}
+	if err := n.ModeSetCRTC(crtc, 0, 0, 0, nil, nil); err != nil {
+		t.Errorf("ModeSetCRTC() = %v", err)
+	}
+}
+
+func TestCreateDumbFramebuffer(t *testing.T) {
+	n := newTestDriver().NewNode()
+
+	for _, format := range []drm.Format{drm.FormatNV12, drm.FormatYUV420, drm.FormatNV24, drm.FormatYUYV} {
+		fb, err := n.CreateDumbFramebuffer(format, 63, 31)
+		if err != nil {
+			t.Fatalf("CreateDumbFramebuffer(%v) = %v", format, err)
+		}
+		if err := drm.FillPattern(fb.Pixels, drm.SMPTEBars{}); err != nil {
+			t.Errorf("FillPattern(%v) = %v", format, err)
+		}
+		if err := n.DestroyDumbFramebuffer(fb); err != nil {
+			t.Errorf("DestroyDumbFramebuffer(%v) = %v", format, err)
+		}
+	}
+}
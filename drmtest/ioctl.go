@@ -0,0 +1,590 @@
+package drmtest
+
+import (
+	"syscall"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const maxArrayLen = 1 << 26
+
+// putUint32s copies as many items as the user buffer can hold, like the
+// kernel does.
+func putUint32s(ptr uapi.Ptr, n uint32, src []uint32) error {
+	l := len(src)
+	if int(n) < l {
+		l = int(n)
+	}
+	if l == 0 {
+		return nil
+	}
+	if ptr == 0 {
+		return syscall.EFAULT
+	}
+	copy((*[maxArrayLen]uint32)(ptr.Pointer())[:l:l], src)
+	return nil
+}
+
+func putUint64s(ptr uapi.Ptr, n uint32, src []uint64) error {
+	l := len(src)
+	if int(n) < l {
+		l = int(n)
+	}
+	if l == 0 {
+		return nil
+	}
+	if ptr == 0 {
+		return syscall.EFAULT
+	}
+	copy((*[maxArrayLen]uint64)(ptr.Pointer())[:l:l], src)
+	return nil
+}
+
+func putString(ptr *byte, n uint, s string) (uint, error) {
+	l := len(s)
+	if int(n) < l {
+		l = int(n)
+	}
+	if l > 0 {
+		if ptr == nil {
+			return 0, syscall.EFAULT
+		}
+		copy((*[maxArrayLen]byte)(unsafe.Pointer(ptr))[:l:l], s)
+	}
+	return uint(len(s)), nil
+}
+
+func newModeModeInfo(mode *drm.ModeModeInfo) uapi.ModeModeInfo {
+	info := uapi.ModeModeInfo{
+		Clock:      mode.Clock,
+		HDisplay:   mode.HDisplay,
+		HSyncStart: mode.HSyncStart,
+		HSyncEnd:   mode.HSyncEnd,
+		HTotal:     mode.HTotal,
+		HSkew:      mode.HSkew,
+		VDisplay:   mode.VDisplay,
+		VSyncStart: mode.VSyncStart,
+		VSyncEnd:   mode.VSyncEnd,
+		VTotal:     mode.VTotal,
+		VScan:      mode.VScan,
+		VRefresh:   mode.VRefresh,
+		Flags:      mode.Flags,
+		Type:       mode.Type,
+	}
+	copy(info.Name[:len(info.Name)-1], mode.Name)
+	return info
+}
+
+func (c *client) version(r *uapi.VersionResp) error {
+	v := &c.d.Version
+	r.Major, r.Minor, r.Patch = v.Major, v.Minor, v.Patch
+
+	var err error
+	if r.NameLen, err = putString(r.Name, r.NameLen, v.Name); err != nil {
+		return err
+	}
+	if r.DateLen, err = putString(r.Date, r.DateLen, v.Date); err != nil {
+		return err
+	}
+	if r.DescLen, err = putString(r.Desc, r.DescLen, v.Desc); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *client) getUnique(r *uapi.UniqueResp) error {
+	var err error
+	r.UniqueLen, err = putString(r.Unique, r.UniqueLen, c.d.Unique)
+	return err
+}
+
+func (c *client) setVersion(r *uapi.SetVersionArg) error {
+	if r.DIMajor != -1 && (r.DIMajor != 1 || r.DIMinor < 0 || r.DIMinor > 4) {
+		return syscall.EINVAL
+	}
+	r.DIMajor, r.DIMinor = 1, 4
+	r.DDMajor, r.DDMinor = c.d.Version.Major, c.d.Version.Minor
+	return nil
+}
+
+func (c *client) getCap(r *uapi.GetCapArg) error {
+	v, ok := c.d.Caps[drm.Cap(r.Cap)]
+	if !ok {
+		return syscall.EINVAL
+	}
+	r.Ret = v
+	return nil
+}
+
+func (c *client) setClientCap(r *uapi.SetCapArg) error {
+	cap := drm.ClientCap(r.Cap)
+	if r.Val > 1 {
+		return syscall.EINVAL
+	}
+	switch cap {
+	case drm.ClientCapStereo3D, drm.ClientCapUniversalPlanes, drm.ClientCapAspectRatio:
+	case drm.ClientCapAtomic:
+		c.caps[drm.ClientCapUniversalPlanes] = r.Val
+		c.caps[drm.ClientCapAspectRatio] = r.Val
+	case drm.ClientCapWritebackConnectors, drm.ClientCapCursorPlaneHotspot:
+		if c.caps[drm.ClientCapAtomic] == 0 {
+			return syscall.EINVAL
+		}
+	default:
+		return syscall.EINVAL
+	}
+	c.caps[cap] = r.Val
+	return nil
+}
+
+func (c *client) hasConnector(conn *Connector) bool {
+	return conn.Type != drm.ConnectorWriteback || c.caps[drm.ClientCapWritebackConnectors] != 0
+}
+
+func (c *client) modeGetResources(r *uapi.ModeCardResp) error {
+	d := c.d
+
+	var fbs, crtcs, conns, encs []uint32
+	for _, id := range d.fbs {
+		fbs = append(fbs, uint32(id))
+	}
+	for _, crtc := range d.crtcs {
+		crtcs = append(crtcs, uint32(crtc.ID))
+	}
+	for _, conn := range d.connectors {
+		if c.hasConnector(conn) {
+			conns = append(conns, uint32(conn.ID))
+		}
+	}
+	for _, enc := range d.encoders {
+		encs = append(encs, uint32(enc.ID))
+	}
+
+	if err := putUint32s(r.FBs, r.FBsLen, fbs); err != nil {
+		return err
+	}
+	if err := putUint32s(r.CRTCs, r.CRTCsLen, crtcs); err != nil {
+		return err
+	}
+	if err := putUint32s(r.Connectors, r.ConnectorsLen, conns); err != nil {
+		return err
+	}
+	if err := putUint32s(r.Encoders, r.EncodersLen, encs); err != nil {
+		return err
+	}
+
+	r.FBsLen = uint32(len(fbs))
+	r.CRTCsLen = uint32(len(crtcs))
+	r.ConnectorsLen = uint32(len(conns))
+	r.EncodersLen = uint32(len(encs))
+	r.MinWidth, r.MaxWidth = d.MinWidth, d.MaxWidth
+	r.MinHeight, r.MaxHeight = d.MinHeight, d.MaxHeight
+	return nil
+}
+
+func (d *Driver) crtc(id drm.CRTCID) *CRTC {
+	for _, crtc := range d.crtcs {
+		if crtc.ID == id {
+			return crtc
+		}
+	}
+	return nil
+}
+
+func (d *Driver) encoder(id drm.EncoderID) *Encoder {
+	for _, enc := range d.encoders {
+		if enc.ID == id {
+			return enc
+		}
+	}
+	return nil
+}
+
+func (d *Driver) connector(id drm.ConnectorID) *Connector {
+	for _, conn := range d.connectors {
+		if conn.ID == id {
+			return conn
+		}
+	}
+	return nil
+}
+
+func (d *Driver) plane(id drm.PlaneID) *Plane {
+	for _, plane := range d.planes {
+		if plane.ID == id {
+			return plane
+		}
+	}
+	return nil
+}
+
+func (c *client) modeGetCRTC(r *uapi.ModeCRTCResp) error {
+	crtc := c.d.crtc(drm.CRTCID(r.ID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+
+	r.FB = uint32(crtc.FB)
+	r.X, r.Y = crtc.X, crtc.Y
+	r.GammaSize = crtc.GammaSize
+	r.ModeValid = 0
+	r.Mode = uapi.ModeModeInfo{}
+	if crtc.Mode != nil {
+		r.ModeValid = 1
+		r.Mode = newModeModeInfo(crtc.Mode)
+	}
+	return nil
+}
+
+func (c *client) modeGetEncoder(r *uapi.ModeEncoderResp) error {
+	enc := c.d.encoder(drm.EncoderID(r.ID))
+	if enc == nil {
+		return syscall.ENOENT
+	}
+
+	r.Type = uint32(enc.Type)
+	r.CRTC = uint32(enc.CRTC)
+	r.PossibleCRTCs = enc.PossibleCRTCs
+	r.PossibleClones = enc.PossibleClones
+	return nil
+}
+
+func (c *client) modeGetConnector(r *uapi.ModeConnectorResp) error {
+	conn := c.d.connector(drm.ConnectorID(r.ID))
+	if conn == nil || !c.hasConnector(conn) {
+		return syscall.ENOENT
+	}
+
+	// Like the kernel, only copy modes if they all fit
+	if len(conn.Modes) > 0 && int(r.ModesLen) >= len(conn.Modes) {
+		if r.Modes == 0 {
+			return syscall.EFAULT
+		}
+		l := len(conn.Modes)
+		modes := (*[maxArrayLen / 64]uapi.ModeModeInfo)(r.Modes.Pointer())[:l:l]
+		for i := range conn.Modes {
+			modes[i] = newModeModeInfo(&conn.Modes[i])
+		}
+	}
+
+	var encs []uint32
+	for _, id := range conn.Encoders {
+		encs = append(encs, uint32(id))
+	}
+	if err := putUint32s(r.Encoders, r.EncodersLen, encs); err != nil {
+		return err
+	}
+
+	propIDs, propValues := c.objectProperties(conn.ID)
+	if err := putUint32s(r.PropIDs, r.PropsLen, propIDs); err != nil {
+		return err
+	}
+	if err := putUint64s(r.PropValues, r.PropsLen, propValues); err != nil {
+		return err
+	}
+
+	r.ModesLen = uint32(len(conn.Modes))
+	r.EncodersLen = uint32(len(encs))
+	r.PropsLen = uint32(len(propIDs))
+	r.Encoder = uint32(conn.Encoder)
+	r.Type = uint32(conn.Type)
+	r.TypeID = conn.TypeID
+	r.Status = uint32(conn.Status)
+	r.PhyWidth, r.PhyHeight = conn.PhyWidth, conn.PhyHeight
+	r.Subpixel = uint32(conn.Subpixel)
+	return nil
+}
+
+func (c *client) hasPlane(plane *Plane) bool {
+	return plane.Type == drm.PlaneOverlay || c.caps[drm.ClientCapUniversalPlanes] != 0
+}
+
+func (c *client) modeGetPlaneResources(r *uapi.ModePlaneResourcesResp) error {
+	var planes []uint32
+	for _, plane := range c.d.planes {
+		if c.hasPlane(plane) {
+			planes = append(planes, uint32(plane.ID))
+		}
+	}
+
+	if err := putUint32s(r.Planes, r.PlanesLen, planes); err != nil {
+		return err
+	}
+	r.PlanesLen = uint32(len(planes))
+	return nil
+}
+
+func (c *client) modeGetPlane(r *uapi.ModePlaneResp) error {
+	plane := c.d.plane(drm.PlaneID(r.ID))
+	if plane == nil || !c.hasPlane(plane) {
+		return syscall.ENOENT
+	}
+
+	if len(plane.Formats) > 0 && int(r.FormatsLen) >= len(plane.Formats) {
+		formats := make([]uint32, len(plane.Formats))
+		for i, f := range plane.Formats {
+			formats[i] = uint32(f)
+		}
+		if err := putUint32s(r.Formats, r.FormatsLen, formats); err != nil {
+			return err
+		}
+	}
+
+	r.CRTC = uint32(plane.CRTC)
+	r.FB = uint32(plane.FB)
+	r.PossibleCRTCs = plane.PossibleCRTCs
+	r.GammaSize = plane.GammaSize
+	r.FormatsLen = uint32(len(plane.Formats))
+	return nil
+}
+
+func (c *client) objectProperties(id drm.AnyID) ([]uint32, []uint64) {
+	var ids []uint32
+	var values []uint64
+	for _, pv := range c.d.objProps[id.Object()] {
+		if pv.prop.Atomic && c.caps[drm.ClientCapAtomic] == 0 {
+			continue
+		}
+		ids = append(ids, uint32(pv.prop.id))
+		values = append(values, pv.value)
+	}
+	return ids, values
+}
+
+func (c *client) modeObjectGetProperties(r *uapi.ModeObjectGetPropertiesResp) error {
+	t, ok := c.d.objects[drm.ObjectID(r.ID)]
+	if !ok || (drm.ObjectType(r.Type) != drm.ObjectAny && drm.ObjectType(r.Type) != t) {
+		return syscall.ENOENT
+	}
+
+	ids, values := c.objectProperties(drm.ObjectID(r.ID))
+	if err := putUint32s(r.PropIDs, r.PropsLen, ids); err != nil {
+		return err
+	}
+	if err := putUint64s(r.PropValues, r.PropsLen, values); err != nil {
+		return err
+	}
+	r.PropsLen = uint32(len(ids))
+	return nil
+}
+
+func (c *client) modeGetProperty(r *uapi.ModeGetPropertyResp) error {
+	prop, ok := c.d.props[drm.PropertyID(r.ID)]
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	values := prop.Values
+	var enums []drm.ModePropertyEnum
+	switch prop.Type {
+	case drm.PropertyEnum, drm.PropertyBitmask:
+		enums = prop.Enums
+		values = nil
+		for _, e := range enums {
+			values = append(values, e.Value)
+		}
+	case drm.PropertyBlob:
+		values = nil
+	}
+
+	if len(values) > 0 && int(r.ValuesLen) >= len(values) {
+		if err := putUint64s(r.Values, r.ValuesLen, values); err != nil {
+			return err
+		}
+	}
+	if len(enums) > 0 && int(r.EnumBlobsLen) >= len(enums) {
+		if r.EnumBlobs == 0 {
+			return syscall.EFAULT
+		}
+		l := len(enums)
+		out := (*[maxArrayLen / 64]uapi.ModePropertyEnum)(r.EnumBlobs.Pointer())[:l:l]
+		for i, e := range enums {
+			out[i] = uapi.ModePropertyEnum{Value: e.Value}
+			copy(out[i].Name[:len(out[i].Name)-1], e.Name)
+		}
+	}
+
+	r.Flags = prop.flags()
+	r.Name = [32]byte{}
+	copy(r.Name[:len(r.Name)-1], prop.Name)
+	r.ValuesLen = uint32(len(values))
+	r.EnumBlobsLen = uint32(len(enums))
+	return nil
+}
+
+func (c *client) modeGetBlob(r *uapi.ModeGetBlobResp) error {
+	data, ok := c.d.blobs[drm.BlobID(r.ID)]
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	if int(r.Size) == len(data) && len(data) > 0 {
+		if r.Data == 0 {
+			return syscall.EFAULT
+		}
+		l := len(data)
+		copy((*[maxArrayLen]byte)(r.Data.Pointer())[:l:l], data)
+	}
+	r.Size = uint32(len(data))
+	return nil
+}
+
+func (c *client) modeGetGamma(r *uapi.ModeCRTCLUT) error {
+	crtc := c.d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+	if crtc.GammaSize == 0 || r.GammaSize != crtc.GammaSize {
+		return syscall.EINVAL
+	}
+	if r.Red == 0 || r.Green == 0 || r.Blue == 0 {
+		return syscall.EFAULT
+	}
+
+	gamma := crtc.gamma
+	if gamma[0] == nil {
+		// Default to a linear ramp
+		ramp := make([]uint16, crtc.GammaSize)
+		for i := range ramp {
+			if crtc.GammaSize > 1 {
+				ramp[i] = uint16(i * 0xFFFF / int(crtc.GammaSize-1))
+			}
+		}
+		gamma = [3][]uint16{ramp, ramp, ramp}
+	}
+
+	l := int(crtc.GammaSize)
+	for i, ptr := range []uapi.Ptr{r.Red, r.Green, r.Blue} {
+		copy((*[maxArrayLen]uint16)(ptr.Pointer())[:l:l], gamma[i])
+	}
+	return nil
+}
+
+func (c *client) modeSetGamma(r *uapi.ModeCRTCLUT) error {
+	crtc := c.d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+	if crtc.GammaSize == 0 || r.GammaSize != crtc.GammaSize {
+		return syscall.EINVAL
+	}
+	if r.Red == 0 || r.Green == 0 || r.Blue == 0 {
+		return syscall.EFAULT
+	}
+
+	l := int(crtc.GammaSize)
+	for i, ptr := range []uapi.Ptr{r.Red, r.Green, r.Blue} {
+		crtc.gamma[i] = append([]uint16(nil), (*[maxArrayLen]uint16)(ptr.Pointer())[:l:l]...)
+	}
+	return nil
+}
+
+func (c *client) checkPropertyValue(prop *property, v uint64) error {
+	if prop.Immutable {
+		return syscall.EINVAL
+	}
+
+	switch prop.Type {
+	case drm.PropertyRange:
+		if len(prop.Values) == 2 && (v < prop.Values[0] || v > prop.Values[1]) {
+			return syscall.EINVAL
+		}
+	case drm.PropertySignedRange:
+		if len(prop.Values) == 2 && (int64(v) < int64(prop.Values[0]) || int64(v) > int64(prop.Values[1])) {
+			return syscall.EINVAL
+		}
+	case drm.PropertyEnum:
+		for _, e := range prop.Enums {
+			if e.Value == v {
+				return nil
+			}
+		}
+		return syscall.EINVAL
+	case drm.PropertyBitmask:
+		var mask uint64
+		for _, e := range prop.Enums {
+			mask |= 1 << e.Value
+		}
+		if v&^mask != 0 {
+			return syscall.EINVAL
+		}
+	case drm.PropertyBlob:
+		if _, ok := c.d.blobs[drm.BlobID(v)]; v != 0 && !ok {
+			return syscall.EINVAL
+		}
+	case drm.PropertyObject:
+		t, ok := c.d.objects[drm.ObjectID(v)]
+		if v != 0 && (!ok || (len(prop.Values) == 1 && t != drm.ObjectType(prop.Values[0]))) {
+			return syscall.EINVAL
+		}
+	}
+	return nil
+}
+
+func (c *client) modeObjectSetProperty(r *uapi.ModeObjectSetPropertyArg) error {
+	d := c.d
+	t, ok := d.objects[drm.ObjectID(r.ObjID)]
+	if !ok || (drm.ObjectType(r.ObjType) != drm.ObjectAny && drm.ObjectType(r.ObjType) != t) {
+		return syscall.ENOENT
+	}
+
+	props := d.objProps[drm.ObjectID(r.ObjID)]
+	for i := range props {
+		pv := &props[i]
+		if pv.prop.id != drm.PropertyID(r.PropID) {
+			continue
+		}
+		if pv.prop.Atomic && c.caps[drm.ClientCapAtomic] == 0 {
+			return syscall.EINVAL
+		}
+		if err := c.checkPropertyValue(pv.prop, r.Value); err != nil {
+			return err
+		}
+		pv.value = r.Value
+		return nil
+	}
+	return syscall.EINVAL
+}
+
+func (c *client) modeCreateBlob(r *uapi.ModeCreateBlobArg) error {
+	d := c.d
+	if r.Length == 0 {
+		return syscall.EINVAL
+	}
+	if r.Data == 0 {
+		return syscall.EFAULT
+	}
+
+	l := int(r.Length)
+	id := drm.BlobID(d.allocID(drm.ObjectBlob))
+	d.blobs[id] = append([]byte(nil), (*[maxArrayLen]byte)(r.Data.Pointer())[:l:l]...)
+	d.blobOwners[id] = c
+	r.BlobID = uint32(id)
+	return nil
+}
+
+func (c *client) modeDestroyBlob(r *uapi.ModeDestroyBlobArg) error {
+	d := c.d
+	id := drm.BlobID(r.BlobID)
+	if _, ok := d.blobs[id]; !ok {
+		return syscall.ENOENT
+	}
+	if d.blobOwners[id] != c {
+		return syscall.EPERM
+	}
+	delete(d.blobOwners, id)
+
+	// Blobs stay alive while a property references them
+	for _, props := range d.objProps {
+		for _, pv := range props {
+			if pv.prop.Type == drm.PropertyBlob && pv.value == uint64(id) {
+				return nil
+			}
+		}
+	}
+	delete(d.blobs, id)
+	delete(d.objects, drm.ObjectID(id))
+	return nil
+}
@@ -0,0 +1,278 @@
+package drmtest
+
+import (
+	"syscall"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const pageFlipFlags = drm.PageFlipEvent | drm.PageFlipAsync | drm.PageFlipTargetAbsolute | drm.PageFlipTargetRelative
+
+// syncProperty updates an object's property if it has one, so that the atomic
+// state reflects legacy updates.
+func (d *Driver) syncProperty(obj drm.AnyID, name string, value uint64) {
+	props := d.objProps[obj.Object()]
+	for i := range props {
+		if props[i].prop.Name == name {
+			props[i].value = value
+		}
+	}
+}
+
+func (d *Driver) crtcIndex(id drm.CRTCID) int {
+	for i, crtc := range d.crtcs {
+		if crtc.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// primaryPlane returns the primary plane used by legacy updates of a CRTC.
+func (d *Driver) primaryPlane(id drm.CRTCID) *Plane {
+	var candidate *Plane
+	for _, plane := range d.planes {
+		if plane.Type != drm.PlanePrimary || plane.PossibleCRTCs&(1<<uint(d.crtcIndex(id))) == 0 {
+			continue
+		}
+		if plane.CRTC == id {
+			return plane
+		}
+		if candidate == nil && plane.CRTC == 0 {
+			candidate = plane
+		}
+	}
+	return candidate
+}
+
+func (d *Driver) setPlaneFB(plane *Plane, crtc drm.CRTCID, fb drm.FBID) {
+	plane.CRTC, plane.FB = crtc, fb
+	d.syncProperty(plane.ID, "CRTC_ID", uint64(crtc))
+	d.syncProperty(plane.ID, "FB_ID", uint64(fb))
+}
+
+func (c *client) modeSetCRTC(r *uapi.ModeCRTCResp) error {
+	d := c.d
+	crtc := d.crtc(drm.CRTCID(r.ID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+
+	var conns []*Connector
+	if n := int(r.SetConnectorsLen); n > 0 {
+		if r.SetConnectors == 0 {
+			return syscall.EFAULT
+		}
+		for _, id := range (*[maxArrayLen]uint32)(r.SetConnectors.Pointer())[:n:n] {
+			conn := d.connector(drm.ConnectorID(id))
+			if conn == nil || !c.hasConnector(conn) {
+				return syscall.ENOENT
+			}
+			conns = append(conns, conn)
+		}
+	}
+
+	if r.ModeValid == 0 {
+		if r.FB != 0 || len(conns) > 0 {
+			return syscall.EINVAL
+		}
+		d.disableCRTC(crtc)
+		return nil
+	}
+
+	b := (*[unsafe.Sizeof(uapi.ModeModeInfo{})]byte)(unsafe.Pointer(&r.Mode))[:]
+	mode, err := drm.ParseModeModeInfo(b)
+	if err != nil || mode.HDisplay == 0 || mode.VDisplay == 0 || len(conns) == 0 {
+		return syscall.EINVAL
+	}
+
+	// Like the kernel, an FB ID of -1 keeps the current FB
+	fbID := drm.FBID(r.FB)
+	if r.FB == ^uint32(0) {
+		fbID = crtc.FB
+	}
+	fb := d.fbInfos[fbID]
+	if fb == nil {
+		return syscall.ENOENT
+	}
+	if uint64(r.X)+uint64(mode.HDisplay) > uint64(fb.Width) || uint64(r.Y)+uint64(mode.VDisplay) > uint64(fb.Height) {
+		return syscall.ENOSPC
+	}
+
+	plane := d.primaryPlane(crtc.ID)
+	if plane == nil {
+		return syscall.EINVAL
+	}
+	mask := uint32(1) << uint(d.crtcIndex(crtc.ID))
+	encs := make([]*Encoder, len(conns))
+	for i, conn := range conns {
+		for _, id := range conn.Encoders {
+			if enc := d.encoder(id); enc != nil && enc.PossibleCRTCs&mask != 0 {
+				encs[i] = enc
+				break
+			}
+		}
+		if encs[i] == nil {
+			return syscall.EINVAL
+		}
+	}
+
+	// Connectors previously driven by the CRTC are released
+	for _, conn := range d.connectors {
+		if enc := d.encoder(conn.Encoder); enc != nil && enc.CRTC == crtc.ID {
+			enc.CRTC = 0
+			conn.Encoder = 0
+			d.syncProperty(conn.ID, "CRTC_ID", 0)
+		}
+	}
+
+	crtc.Mode = mode
+	crtc.FB = fbID
+	crtc.X, crtc.Y = r.X, r.Y
+	d.syncProperty(crtc.ID, "ACTIVE", 1)
+	d.setPlaneFB(plane, crtc.ID, fbID)
+	for i, conn := range conns {
+		encs[i].CRTC = crtc.ID
+		conn.Encoder = encs[i].ID
+		d.syncProperty(conn.ID, "CRTC_ID", uint64(crtc.ID))
+	}
+	return nil
+}
+
+func (d *Driver) disableCRTC(crtc *CRTC) {
+	crtc.Mode = nil
+	crtc.FB = 0
+	crtc.X, crtc.Y = 0, 0
+	d.syncProperty(crtc.ID, "ACTIVE", 0)
+	for _, plane := range d.planes {
+		if plane.CRTC == crtc.ID {
+			d.setPlaneFB(plane, 0, 0)
+		}
+	}
+	for _, conn := range d.connectors {
+		if enc := d.encoder(conn.Encoder); enc != nil && enc.CRTC == crtc.ID {
+			enc.CRTC = 0
+			conn.Encoder = 0
+			d.syncProperty(conn.ID, "CRTC_ID", 0)
+		}
+	}
+}
+
+func (c *client) modePageFlip(r *uapi.ModeCRTCPageFlipArg) error {
+	d := c.d
+	flags := drm.PageFlipFlags(r.Flags)
+	target := flags & (drm.PageFlipTargetAbsolute | drm.PageFlipTargetRelative)
+	if flags&^pageFlipFlags != 0 || target == drm.PageFlipTargetAbsolute|drm.PageFlipTargetRelative {
+		return syscall.EINVAL
+	}
+	if target != 0 && d.Caps[drm.CapPageFlipTarget] == 0 {
+		return syscall.EINVAL
+	}
+	if target == 0 && r.Sequence != 0 {
+		return syscall.EINVAL
+	}
+	if flags&drm.PageFlipAsync != 0 && d.Caps[drm.CapAsyncPageFlip] == 0 {
+		return syscall.EINVAL
+	}
+
+	crtc := d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+	if crtc.Mode == nil {
+		return syscall.EINVAL
+	}
+	fb := d.fbInfos[drm.FBID(r.FBID)]
+	if fb == nil {
+		return syscall.ENOENT
+	}
+	if uint64(crtc.X)+uint64(crtc.Mode.HDisplay) > uint64(fb.Width) || uint64(crtc.Y)+uint64(crtc.Mode.VDisplay) > uint64(fb.Height) {
+		return syscall.ENOSPC
+	}
+	for _, ev := range d.pending {
+		if ev.crtc == crtc && ev.typ == drm.EventFlipComplete {
+			return syscall.EBUSY
+		}
+	}
+
+	crtc.FB = drm.FBID(r.FBID)
+	if plane := d.primaryPlane(crtc.ID); plane != nil {
+		d.setPlaneFB(plane, crtc.ID, crtc.FB)
+	}
+
+	if flags&drm.PageFlipEvent != 0 {
+		seq := crtc.seq + 1
+		switch target {
+		case drm.PageFlipTargetAbsolute:
+			if s := uint64(r.Sequence); s > crtc.seq {
+				seq = s
+			}
+		case drm.PageFlipTargetRelative:
+			seq = crtc.seq + uint64(r.Sequence)
+		}
+		d.pending = append(d.pending, &pendingEvent{
+			c:        c,
+			crtc:     crtc,
+			typ:      drm.EventFlipComplete,
+			seq:      seq,
+			userData: r.UserData,
+		})
+	}
+	return nil
+}
+
+func (c *client) modeSetPlane(r *uapi.ModeSetPlaneArg) error {
+	d := c.d
+	plane := d.plane(drm.PlaneID(r.PlaneID))
+	if plane == nil || !c.hasPlane(plane) {
+		return syscall.ENOENT
+	}
+	if r.FBID == 0 {
+		d.setPlaneFB(plane, 0, 0)
+		return nil
+	}
+
+	crtc := d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+	if plane.PossibleCRTCs&(1<<uint(d.crtcIndex(crtc.ID))) == 0 {
+		return syscall.EINVAL
+	}
+	fb := d.fbInfos[drm.FBID(r.FBID)]
+	if fb == nil {
+		return syscall.ENOENT
+	}
+	supported := false
+	for _, f := range plane.Formats {
+		supported = supported || f == fb.Format
+	}
+	if !supported {
+		return syscall.EINVAL
+	}
+	fbW, fbH := uint64(fb.Width)<<16, uint64(fb.Height)<<16
+	if uint64(r.SrcX)+uint64(r.SrcW) > fbW || uint64(r.SrcY)+uint64(r.SrcH) > fbH {
+		return syscall.ENOSPC
+	}
+
+	d.setPlaneFB(plane, crtc.ID, drm.FBID(r.FBID))
+	props := []struct {
+		name  string
+		value uint64
+	}{
+		{"CRTC_X", uint64(int64(r.CRTCX))},
+		{"CRTC_Y", uint64(int64(r.CRTCY))},
+		{"CRTC_W", uint64(r.CRTCW)},
+		{"CRTC_H", uint64(r.CRTCH)},
+		{"SRC_X", uint64(r.SrcX)},
+		{"SRC_Y", uint64(r.SrcY)},
+		{"SRC_W", uint64(r.SrcW)},
+		{"SRC_H", uint64(r.SrcH)},
+	}
+	for _, prop := range props {
+		d.syncProperty(plane.ID, prop.name, prop.value)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package drmtest
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm"
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const (
+	vblankRelative      = 0x00000001
+	vblankHighCRTCShift = 1
+	vblankHighCRTCMask  = 0x0000003e
+	vblankEvent         = 0x04000000
+	vblankNextOnMiss    = 0x10000000
+	vblankSecondary     = 0x20000000
+
+	vblankFlags = vblankRelative | vblankHighCRTCMask | vblankEvent | vblankNextOnMiss | vblankSecondary
+
+	crtcSequenceRelative   = 1 << 0
+	crtcSequenceNextOnMiss = 1 << 1
+)
+
+type eventHeader struct {
+	Type, Length uint32
+}
+
+type eventVBlank struct {
+	eventHeader
+	UserData  uint64
+	Sec, Usec uint32
+	Sequence  uint32
+	CRTCID    uint32
+}
+
+type eventCRTCSequence struct {
+	eventHeader
+	UserData uint64
+	TimeNs   int64
+	Sequence uint64
+}
+
+type pendingEvent struct {
+	c        *client
+	crtc     *CRTC
+	typ      drm.EventType
+	seq      uint64
+	userData uint64
+}
+
+// vblankTime returns the timestamp of a vblank sequence, assuming the CRTC
+// has always been running at the current mode's refresh rate.
+func vblankTime(crtc *CRTC, seq uint64) time.Duration {
+	refresh := uint32(60)
+	if crtc.Mode != nil && crtc.Mode.VRefresh > 0 {
+		refresh = crtc.Mode.VRefresh
+	}
+	return time.Duration(seq) * time.Second / time.Duration(refresh)
+}
+
+// VBlank simulates a vblank on a CRTC: its sequence is incremented and the
+// events waiting for it are delivered. It returns false if the CRTC doesn't
+// exist or is disabled.
+func (d *Driver) VBlank(id drm.CRTCID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	crtc := d.crtc(id)
+	if crtc == nil || crtc.Mode == nil {
+		return false
+	}
+	d.advance(crtc, crtc.seq+1)
+	return true
+}
+
+// advance moves a CRTC's sequence forward and delivers due events.
+func (d *Driver) advance(crtc *CRTC, seq uint64) {
+	if seq > crtc.seq {
+		crtc.seq = seq
+	}
+
+	pending := d.pending[:0]
+	for _, ev := range d.pending {
+		if ev.crtc != crtc || ev.seq > crtc.seq {
+			pending = append(pending, ev)
+			continue
+		}
+		ev.c.events = append(ev.c.events, ev.encode())
+	}
+	d.pending = pending
+}
+
+func (ev *pendingEvent) encode() []byte {
+	t := vblankTime(ev.crtc, ev.seq)
+	switch ev.typ {
+	case drm.EventCRTCSequence:
+		e := eventCRTCSequence{
+			eventHeader: eventHeader{uint32(ev.typ), uint32(unsafe.Sizeof(eventCRTCSequence{}))},
+			UserData:    ev.userData,
+			TimeNs:      int64(t),
+			Sequence:    ev.seq,
+		}
+		return append([]byte(nil), (*[unsafe.Sizeof(e)]byte)(unsafe.Pointer(&e))[:]...)
+	default:
+		e := eventVBlank{
+			eventHeader: eventHeader{uint32(ev.typ), uint32(unsafe.Sizeof(eventVBlank{}))},
+			UserData:    ev.userData,
+			Sec:         uint32(t / time.Second),
+			Usec:        uint32(t % time.Second / time.Microsecond),
+			Sequence:    uint32(ev.seq),
+			CRTCID:      uint32(ev.crtc.ID),
+		}
+		return append([]byte(nil), (*[unsafe.Sizeof(e)]byte)(unsafe.Pointer(&e))[:]...)
+	}
+}
+
+// Read reads pending events. Since the fake driver can't block, EAGAIN is
+// returned if there are none, like a non-blocking DRM file descriptor.
+func (c *client) Read(b []byte) (int, error) {
+	d := c.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(c.events) == 0 {
+		return 0, syscall.EAGAIN
+	}
+
+	n := 0
+	for len(c.events) > 0 && n+len(c.events[0]) <= len(b) {
+		n += copy(b[n:], c.events[0])
+		c.events = c.events[1:]
+	}
+	return n, nil
+}
+
+func (c *client) waitVBlank(r *uapi.WaitVBlankArg) error {
+	d := c.d
+	if r.Type&^vblankFlags != 0 {
+		return syscall.EINVAL
+	}
+
+	index := 0
+	if r.Type&vblankHighCRTCMask != 0 {
+		index = int(r.Type&vblankHighCRTCMask) >> vblankHighCRTCShift
+	} else if r.Type&vblankSecondary != 0 {
+		index = 1
+	}
+	if index >= len(d.crtcs) {
+		return syscall.EINVAL
+	}
+	crtc := d.crtcs[index]
+	if crtc.Mode == nil {
+		return syscall.EINVAL
+	}
+
+	// Sequences are 32-bit in this ioctl, extend them relative to the
+	// current one
+	cur := crtc.seq
+	req := r.Sequence
+	if r.Type&vblankRelative != 0 {
+		req += uint32(cur)
+	}
+	diff := int64(int32(req - uint32(cur)))
+	if r.Type&vblankNextOnMiss != 0 && diff <= 0 {
+		diff = 1
+	}
+	target := uint64(int64(cur) + diff)
+
+	if r.Type&vblankEvent != 0 {
+		d.pending = append(d.pending, &pendingEvent{
+			c:        c,
+			crtc:     crtc,
+			typ:      drm.EventVBlank,
+			seq:      target,
+			userData: uint64(r.Signal),
+		})
+		d.advance(crtc, cur)
+		r.Sequence = uint32(target)
+		return nil
+	}
+
+	// Blocking waits complete instantly, as if time had passed
+	d.advance(crtc, target)
+	t := vblankTime(crtc, crtc.seq)
+	r.Sequence = uint32(crtc.seq)
+	r.Signal = uint(t / time.Second)
+	r.TvalUsec = int(t % time.Second / time.Microsecond)
+	return nil
+}
+
+func (c *client) crtcGetSequence(r *uapi.CRTCGetSequenceArg) error {
+	crtc := c.d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+
+	r.Active = 0
+	if crtc.Mode != nil {
+		r.Active = 1
+	}
+	r.Sequence = crtc.seq
+	r.SequenceNs = int64(vblankTime(crtc, crtc.seq))
+	return nil
+}
+
+func (c *client) crtcQueueSequence(r *uapi.CRTCQueueSequenceArg) error {
+	d := c.d
+	crtc := d.crtc(drm.CRTCID(r.CRTCID))
+	if crtc == nil {
+		return syscall.ENOENT
+	}
+	if r.Flags&^(crtcSequenceRelative|crtcSequenceNextOnMiss) != 0 {
+		return syscall.EINVAL
+	}
+	if crtc.Mode == nil {
+		return syscall.EINVAL
+	}
+
+	target := r.Sequence
+	if r.Flags&crtcSequenceRelative != 0 {
+		target += crtc.seq
+	}
+	if r.Flags&crtcSequenceNextOnMiss != 0 && target <= crtc.seq {
+		target = crtc.seq + 1
+	}
+
+	d.pending = append(d.pending, &pendingEvent{
+		c:        c,
+		crtc:     crtc,
+		typ:      drm.EventCRTCSequence,
+		seq:      target,
+		userData: r.UserData,
+	})
+	d.advance(crtc, crtc.seq)
+	r.Sequence = target
+	return nil
+}
@@ -0,0 +1,157 @@
+package drm
+
+import (
+	"fmt"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+// DumbBuffer is a linear buffer allocated by the kernel, suitable for software
+// rendering.
+type DumbBuffer struct {
+	Handle        uint32
+	Width, Height uint32
+	BPP           uint32
+	Pitch         uint32
+	Size          uint64
+}
+
+func (n *Node) ModeCreateDumb(width, height, bpp uint32) (*DumbBuffer, error) {
+	r := uapi.ModeCreateDumbArg{Width: width, Height: height, BPP: bpp}
+	if err := modeCreateDumb(n.backend, &r); err != nil {
+		return nil, err
+	}
+	return &DumbBuffer{
+		Handle: r.Handle,
+		Width:  width,
+		Height: height,
+		BPP:    bpp,
+		Pitch:  r.Pitch,
+		Size:   r.Size,
+	}, nil
+}
+
+// ModeMapDumb prepares a dumb buffer for mapping, and returns the offset to
+// pass to mmap.
+func (n *Node) ModeMapDumb(handle uint32) (uint64, error) {
+	r := uapi.ModeMapDumbArg{Handle: handle}
+	if err := modeMapDumb(n.backend, &r); err != nil {
+		return 0, err
+	}
+	return r.Offset, nil
+}
+
+func (n *Node) ModeDestroyDumb(handle uint32) error {
+	r := uapi.ModeDestroyDumbArg{Handle: handle}
+	return modeDestroyDumb(n.backend, &r)
+}
+
+// MapDumb maps the memory of a dumb buffer. The mapping must be released with
+// Munmap.
+func (n *Node) MapDumb(buf *DumbBuffer) ([]byte, error) {
+	m, ok := n.backend.(Mapper)
+	if !ok {
+		return nil, fmt.Errorf("drm: backend doesn't support memory mappings")
+	}
+	offset, err := n.ModeMapDumb(buf.Handle)
+	if err != nil {
+		return nil, err
+	}
+	return m.Mmap(int64(offset), int(buf.Size))
+}
+
+// Munmap releases a memory mapping.
+func (n *Node) Munmap(b []byte) error {
+	m, ok := n.backend.(Mapper)
+	if !ok {
+		return fmt.Errorf("drm: backend doesn't support memory mappings")
+	}
+	return m.Munmap(b)
+}
+
+// DumbFramebuffer is a framebuffer backed by a single mapped dumb buffer
+// holding all of its planes. It can be filled with software rendering in any
+// format described by Format.Info, including YUV formats.
+type DumbFramebuffer struct {
+	ID     FBID
+	Buffer *DumbBuffer
+	// Pixels aliases the mapped planes
+	Pixels *PixelBuffer
+
+	data []byte
+}
+
+// CreateDumbFramebuffer allocates and maps a dumb buffer large enough for all
+// planes of a format, and adds a framebuffer for it. Planes are stacked
+// vertically and share the dumb buffer's pitch. The framebuffer must be
+// released with DestroyDumbFramebuffer.
+func (n *Node) CreateDumbFramebuffer(format Format, width, height int) (*DumbFramebuffer, error) {
+	info := format.Info()
+	if info == nil {
+		return nil, fmt.Errorf("drm: unsupported format %v", format)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("drm: invalid framebuffer size %vx%v", width, height)
+	}
+
+	// The dumb buffer is sized in units of the first plane's pixels, wide
+	// enough for the widest plane
+	var rowSize, totalHeight int
+	for p := 0; p < info.NumPlanes; p++ {
+		w, h := info.planeSize(p, width, height)
+		if s := w * info.wordSize(p); s > rowSize {
+			rowSize = s
+		}
+		totalHeight += h
+	}
+	cpp := info.CPP[0]
+	buf, err := n.ModeCreateDumb(uint32((rowSize+cpp-1)/cpp), uint32(totalHeight), uint32(8*cpp))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := n.MapDumb(buf)
+	if err != nil {
+		n.ModeDestroyDumb(buf.Handle)
+		return nil, err
+	}
+
+	fb := &DumbFramebuffer{
+		Buffer: buf,
+		Pixels: &PixelBuffer{Format: format, Width: width, Height: height},
+		data:   data,
+	}
+	cmd := ModeFB2{Width: uint32(width), Height: uint32(height), Format: format}
+	offset := 0
+	for p := 0; p < info.NumPlanes; p++ {
+		_, h := info.planeSize(p, width, height)
+		size := int(buf.Pitch) * h
+		cmd.Handles[p] = buf.Handle
+		cmd.Pitches[p] = buf.Pitch
+		cmd.Offsets[p] = uint32(offset)
+		fb.Pixels.Planes[p] = data[offset : offset+size]
+		fb.Pixels.Pitches[p] = int(buf.Pitch)
+		offset += size
+	}
+
+	fb.ID, err = n.ModeAddFB2(&cmd)
+	if err != nil {
+		n.Munmap(data)
+		n.ModeDestroyDumb(buf.Handle)
+		return nil, err
+	}
+	return fb, nil
+}
+
+// DestroyDumbFramebuffer removes the framebuffer, unmaps its memory and
+// destroys its dumb buffer.
+func (n *Node) DestroyDumbFramebuffer(fb *DumbFramebuffer) error {
+	err := n.ModeRemoveFB(fb.ID)
+	if unmapErr := n.Munmap(fb.data); err == nil {
+		err = unmapErr
+	}
+	if destroyErr := n.ModeDestroyDumb(fb.Buffer.Handle); err == nil {
+		err = destroyErr
+	}
+	return err
+}
@@ -0,0 +1,559 @@
+package drm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const edidBlockSize = 128
+
+var edidHeader = []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// EDID contains information decoded from an EDID blob.
+type EDID struct {
+	Version, Revision uint8
+
+	Manufacturer string
+	ProductCode  uint16
+	SerialNumber uint32
+
+	ManufactureWeek, ManufactureYear int
+	// ManufactureYear is the model year rather than the year of manufacture
+	ModelYear bool
+
+	Digital bool
+	// Color bit depth per primary of digital displays, zero if undefined.
+	// Only available since EDID 1.4.
+	BitDepth       int
+	VideoInterface EDIDVideoInterface
+
+	WidthCm, HeightCm uint8
+	// Display gamma, zero if undefined
+	Gamma    float64
+	Features EDIDFeatures
+
+	Name, Serial string
+	// Alphanumeric data strings
+	Strings []string
+
+	Chromaticity EDIDChromaticity
+
+	EstablishedTimings []EDIDTiming
+	StandardTimings    []EDIDTiming
+	// Detailed timings from the base block. The first one is the preferred
+	// mode, and has the ModeTypePreferred bit set.
+	DetailedTimings []ModeModeInfo
+	// Display range limits, nil if absent
+	RangeLimits *EDIDRangeLimits
+
+	Extensions      int
+	ExtensionBlocks []EDIDExtension
+
+	// HDR static metadata data block from the CTA-861 extension, nil if
+	// absent
+	HDRStaticMetadata *EDIDHDRStaticMetadata
+
+	// Conformance issues found while decoding. They don't prevent decoding
+	// the rest of the EDID.
+	Warnings []string
+}
+
+// Chromaticity is a CIE 1931 xy color coordinate.
+type Chromaticity struct {
+	X, Y float64
+}
+
+// EDIDChromaticity contains the display's primaries and white point.
+type EDIDChromaticity struct {
+	Red, Green, Blue, White Chromaticity
+}
+
+// EDIDHDRStaticMetadata describes the HDR capabilities of a display. Luminance
+// values are in cd/m², and are zero if unspecified.
+type EDIDHDRStaticMetadata struct {
+	EOTFs                []HDREOTF
+	StaticMetadataType1  bool
+	MaxLuminance         float64
+	MaxFrameAvgLuminance float64
+	MinLuminance         float64
+}
+
+// SupportsEOTF checks whether the display supports an EOTF.
+func (md *EDIDHDRStaticMetadata) SupportsEOTF(eotf HDREOTF) bool {
+	for _, e := range md.EOTFs {
+		if e == eotf {
+			return true
+		}
+	}
+	return false
+}
+
+// EDIDVideoInterface is the interface of a digital display.
+type EDIDVideoInterface uint8
+
+const (
+	EDIDVideoInterfaceUndefined   EDIDVideoInterface = 0
+	EDIDVideoInterfaceDVI         EDIDVideoInterface = 1
+	EDIDVideoInterfaceHDMIA       EDIDVideoInterface = 2
+	EDIDVideoInterfaceHDMIB       EDIDVideoInterface = 3
+	EDIDVideoInterfaceMDDI        EDIDVideoInterface = 4
+	EDIDVideoInterfaceDisplayPort EDIDVideoInterface = 5
+)
+
+func (vi EDIDVideoInterface) String() string {
+	switch vi {
+	case EDIDVideoInterfaceUndefined:
+		return "undefined"
+	case EDIDVideoInterfaceDVI:
+		return "DVI"
+	case EDIDVideoInterfaceHDMIA:
+		return "HDMI-a"
+	case EDIDVideoInterfaceHDMIB:
+		return "HDMI-b"
+	case EDIDVideoInterfaceMDDI:
+		return "MDDI"
+	case EDIDVideoInterfaceDisplayPort:
+		return "DisplayPort"
+	default:
+		return "unknown"
+	}
+}
+
+// EDIDFeatures is a bitmask of display features.
+type EDIDFeatures uint8
+
+const (
+	EDIDFeatureStandby   EDIDFeatures = 1 << 7
+	EDIDFeatureSuspend   EDIDFeatures = 1 << 6
+	EDIDFeatureActiveOff EDIDFeatures = 1 << 5
+	// sRGB is the default color space
+	EDIDFeatureSRGB EDIDFeatures = 1 << 2
+	// The preferred timing is the native resolution and refresh rate. Always
+	// set before EDID 1.4.
+	EDIDFeaturePreferredTimingNative EDIDFeatures = 1 << 1
+	EDIDFeatureContinuousFrequency   EDIDFeatures = 1 << 0
+)
+
+func (f EDIDFeatures) String() string {
+	names := []struct {
+		bit  EDIDFeatures
+		name string
+	}{
+		{EDIDFeatureStandby, "standby"},
+		{EDIDFeatureSuspend, "suspend"},
+		{EDIDFeatureActiveOff, "active-off"},
+		{EDIDFeatureSRGB, "sRGB"},
+		{EDIDFeaturePreferredTimingNative, "preferred-timing-native"},
+		{EDIDFeatureContinuousFrequency, "continuous-frequency"},
+	}
+	var l []string
+	for _, n := range names {
+		if f&n.bit != 0 {
+			l = append(l, n.name)
+		}
+	}
+	return strings.Join(l, ", ")
+}
+
+// EDIDTiming describes a video format by its resolution and refresh rate, as
+// found in established and standard timings.
+type EDIDTiming struct {
+	Width, Height int
+	Refresh       int
+	Interlaced    bool
+}
+
+func (t EDIDTiming) String() string {
+	s := fmt.Sprintf("%vx%v", t.Width, t.Height)
+	if t.Interlaced {
+		s += "i"
+	}
+	return fmt.Sprintf("%v@%v", s, t.Refresh)
+}
+
+// EDIDRangeLimits contains the range of timings supported by the display.
+// Rates are in Hz and kHz, the pixel clock is in MHz and is zero if
+// unspecified.
+type EDIDRangeLimits struct {
+	MinVRate, MaxVRate int
+	MinHRate, MaxHRate int
+	MaxPixelClock      int
+}
+
+// EDIDExtension is an EDID extension block.
+type EDIDExtension struct {
+	Tag uint8
+	// Decoded CTA-861 extension, nil for other extensions and for blocks with
+	// an invalid checksum
+	CTA *EDIDCTAExtension
+}
+
+// Name returns a human-readable name for the extension type.
+func (ext *EDIDExtension) Name() string {
+	switch ext.Tag {
+	case edidExtCTA:
+		return "CTA-861"
+	case 0x10:
+		return "Video Timing Block"
+	case 0x40:
+		return "Display Information"
+	case 0x50:
+		return "Localized String"
+	case 0x60:
+		return "Microdisplay Interface"
+	case 0x70:
+		return "DisplayID"
+	case 0xA7, 0xAF, 0xBF:
+		return "Display Transfer Characteristics"
+	case 0xF0:
+		return "Block Map"
+	case 0xFF:
+		return "Manufacturer Specific"
+	default:
+		return "unknown"
+	}
+}
+
+func (edid *EDID) warnf(format string, v ...interface{}) {
+	edid.Warnings = append(edid.Warnings, fmt.Sprintf(format, v...))
+}
+
+func checkEDIDBlock(b []byte) error {
+	var sum byte
+	for _, v := range b[:edidBlockSize] {
+		sum += v
+	}
+	if sum != 0 {
+		return fmt.Errorf("drm: invalid EDID checksum")
+	}
+	return nil
+}
+
+// ParseEDID decodes an EDID blob, as found in a connector's EDID property.
+//
+// An error is only returned if the base block is unusable. Other issues are
+// reported in EDID.Warnings.
+func ParseEDID(b []byte) (*EDID, error) {
+	if len(b) < edidBlockSize {
+		return nil, fmt.Errorf("drm: EDID too short")
+	}
+	if !bytes.Equal(b[:len(edidHeader)], edidHeader) {
+		return nil, fmt.Errorf("drm: invalid EDID header")
+	}
+	if err := checkEDIDBlock(b); err != nil {
+		return nil, err
+	}
+
+	vendor := binary.BigEndian.Uint16(b[8:10])
+	edid := &EDID{
+		Version:  b[18],
+		Revision: b[19],
+		Manufacturer: string([]byte{
+			byte((vendor>>10)&0x1F) + '@',
+			byte((vendor>>5)&0x1F) + '@',
+			byte(vendor&0x1F) + '@',
+		}),
+		ProductCode:     binary.LittleEndian.Uint16(b[10:12]),
+		SerialNumber:    binary.LittleEndian.Uint32(b[12:16]),
+		ManufactureWeek: int(b[16]),
+		ManufactureYear: int(b[17]) + 1990,
+		Digital:         b[20]&0x80 != 0,
+		WidthCm:         b[21],
+		HeightCm:        b[22],
+		Features:        EDIDFeatures(b[24]) & (0xE7),
+		Extensions:      int(b[126]),
+	}
+	if b[23] != 0xFF {
+		edid.Gamma = float64(b[23])/100 + 1
+	}
+
+	if edid.Version != 1 || edid.Revision > 4 {
+		edid.warnf("unsupported EDID version %v.%v", edid.Version, edid.Revision)
+	}
+	if vendor&0x8000 != 0 || strings.ContainsAny(edid.Manufacturer, "@[\\]^_") {
+		edid.warnf("invalid manufacturer ID 0x%04X", vendor)
+	}
+	switch week := edid.ManufactureWeek; {
+	case week == 0xFF && edid.Revision >= 4:
+		edid.ManufactureWeek = 0
+		edid.ModelYear = true
+	case week > 54:
+		edid.warnf("invalid week of manufacture %v", week)
+	}
+	if edid.Revision < 4 {
+		// Before EDID 1.4, the preferred timing is always native
+		edid.Features |= EDIDFeaturePreferredTimingNative
+	}
+
+	if edid.Digital && edid.Revision >= 4 {
+		if depth := (b[20] >> 4) & 0x7; depth != 0 && depth != 7 {
+			edid.BitDepth = 4 + 2*int(depth)
+		} else if depth == 7 {
+			edid.warnf("reserved color bit depth")
+		}
+		edid.VideoInterface = EDIDVideoInterface(b[20] & 0x0F)
+	}
+
+	// Chromaticity coordinates are 10-bit, the two least significant bits are
+	// packed in bytes 25 and 26
+	chromaticity := func(hi int, lo byte, shift uint) float64 {
+		return float64(uint16(b[hi])<<2|uint16(lo>>shift)&0x3) / 1024
+	}
+	edid.Chromaticity = EDIDChromaticity{
+		Red:   Chromaticity{chromaticity(27, b[25], 6), chromaticity(28, b[25], 4)},
+		Green: Chromaticity{chromaticity(29, b[25], 2), chromaticity(30, b[25], 0)},
+		Blue:  Chromaticity{chromaticity(31, b[26], 6), chromaticity(32, b[26], 4)},
+		White: Chromaticity{chromaticity(33, b[26], 2), chromaticity(34, b[26], 0)},
+	}
+
+	established := uint32(b[35])<<16 | uint32(b[36])<<8 | uint32(b[37])
+	for i, t := range edidEstablishedTimings {
+		if established&(1<<uint(23-i)) != 0 {
+			edid.EstablishedTimings = append(edid.EstablishedTimings, t)
+		}
+	}
+	edid.parseStandardTimings(b[38:54])
+
+	hasName := false
+	for i := 0; i < 4; i++ {
+		desc := b[54+18*i : 54+18*(i+1)]
+		if desc[0] != 0 || desc[1] != 0 {
+			mode := edid.parseDetailedTiming(desc)
+			if i == 0 {
+				mode.Type |= ModeTypePreferred
+			}
+			edid.DetailedTimings = append(edid.DetailedTimings, *mode)
+			continue
+		}
+		if i == 0 && edid.Version == 1 && edid.Revision >= 3 {
+			edid.warnf("the first descriptor must be the preferred detailed timing")
+		}
+		switch desc[3] {
+		case 0xFC:
+			edid.Name = edid.descriptorString(desc)
+			hasName = true
+		case 0xFF:
+			edid.Serial = edid.descriptorString(desc)
+		case 0xFE:
+			edid.Strings = append(edid.Strings, edid.descriptorString(desc))
+		case 0xFD:
+			edid.parseRangeLimits(desc)
+		case 0xFA:
+			edid.parseStandardTimings(desc[5:17])
+		}
+	}
+	if edid.Version == 1 && edid.Revision == 3 {
+		if !hasName {
+			edid.warnf("missing display product name descriptor, required by EDID 1.3")
+		}
+		if edid.RangeLimits == nil {
+			edid.warnf("missing display range limits descriptor, required by EDID 1.3")
+		}
+	} else if edid.Revision >= 4 && edid.Features&EDIDFeatureContinuousFrequency != 0 && edid.RangeLimits == nil {
+		edid.warnf("missing display range limits descriptor, required for continuous frequency displays")
+	}
+	if limits := edid.RangeLimits; limits != nil && len(edid.DetailedTimings) > 0 {
+		mode := &edid.DetailedTimings[0]
+		refresh := mode.RefreshRate()
+		if refresh < float64(limits.MinVRate)-0.5 || refresh > float64(limits.MaxVRate)+0.5 {
+			edid.warnf("preferred timing refresh rate %.2f Hz is outside of the range limits", refresh)
+		}
+		if limits.MaxPixelClock != 0 && int(mode.Clock) > limits.MaxPixelClock*1000 {
+			edid.warnf("preferred timing pixel clock %v kHz is above the range limits", mode.Clock)
+		}
+	}
+
+	n := len(b) / edidBlockSize
+	if len(b)%edidBlockSize != 0 {
+		edid.warnf("EDID size %v isn't a multiple of %v bytes", len(b), edidBlockSize)
+	}
+	if n-1 < edid.Extensions {
+		edid.warnf("EDID announces %v extension blocks but only contains %v", edid.Extensions, n-1)
+	} else if n-1 > edid.Extensions {
+		edid.warnf("EDID contains %v extension blocks but only announces %v", n-1, edid.Extensions)
+	}
+	for i := 1; i <= edid.Extensions && i < n; i++ {
+		ext := b[i*edidBlockSize : (i+1)*edidBlockSize]
+		edid.ExtensionBlocks = append(edid.ExtensionBlocks, EDIDExtension{Tag: ext[0]})
+		// Skip invalid extensions instead of rejecting the whole EDID
+		if checkEDIDBlock(ext) != nil {
+			edid.warnf("extension block %v: invalid checksum", i)
+			continue
+		}
+		if ext[0] == edidExtCTA {
+			cta := parseCTAExtension(edid, i, ext)
+			edid.ExtensionBlocks[i-1].CTA = cta
+		}
+	}
+
+	return edid, nil
+}
+
+var edidEstablishedTimings = []EDIDTiming{
+	{720, 400, 70, false},
+	{720, 400, 88, false},
+	{640, 480, 60, false},
+	{640, 480, 67, false},
+	{640, 480, 72, false},
+	{640, 480, 75, false},
+	{800, 600, 56, false},
+	{800, 600, 60, false},
+	{800, 600, 72, false},
+	{800, 600, 75, false},
+	{832, 624, 75, false},
+	{1024, 768, 87, true},
+	{1024, 768, 60, false},
+	{1024, 768, 70, false},
+	{1024, 768, 75, false},
+	{1280, 1024, 75, false},
+	{1152, 870, 75, false},
+}
+
+func (edid *EDID) parseStandardTimings(b []byte) {
+	for i := 0; i+1 < len(b); i += 2 {
+		if (b[i] == 0x01 && b[i+1] == 0x01) || (b[i] == 0 && b[i+1] == 0) {
+			continue // unused
+		}
+		if b[i] == 0 {
+			edid.warnf("invalid standard timing 0x%02X%02X", b[i], b[i+1])
+			continue
+		}
+
+		w := (int(b[i]) + 31) * 8
+		var h int
+		switch b[i+1] >> 6 {
+		case 0:
+			if edid.Version == 1 && edid.Revision < 3 {
+				h = w
+			} else {
+				h = w * 10 / 16
+			}
+		case 1:
+			h = w * 3 / 4
+		case 2:
+			h = w * 4 / 5
+		case 3:
+			h = w * 9 / 16
+		}
+		edid.StandardTimings = append(edid.StandardTimings, EDIDTiming{
+			Width:   w,
+			Height:  h,
+			Refresh: int(b[i+1]&0x3F) + 60,
+		})
+	}
+}
+
+// parseDetailedTiming decodes a detailed timing descriptor into a mode, the
+// same way the kernel does.
+func (edid *EDID) parseDetailedTiming(d []byte) *ModeModeInfo {
+	hactive := uint16(d[2]) | uint16(d[4]>>4)<<8
+	hblank := uint16(d[3]) | uint16(d[4]&0x0F)<<8
+	vactive := uint16(d[5]) | uint16(d[7]>>4)<<8
+	vblank := uint16(d[6]) | uint16(d[7]&0x0F)<<8
+	hsyncOff := uint16(d[8]) | uint16(d[11]>>6&0x3)<<8
+	hsyncWidth := uint16(d[9]) | uint16(d[11]>>4&0x3)<<8
+	vsyncOff := uint16(d[10]>>4) | uint16(d[11]>>2&0x3)<<4
+	vsyncWidth := uint16(d[10]&0x0F) | uint16(d[11]&0x3)<<4
+
+	mode := &ModeModeInfo{
+		Clock:      uint32(binary.LittleEndian.Uint16(d[0:2])) * 10,
+		HDisplay:   hactive,
+		HSyncStart: hactive + hsyncOff,
+		HSyncEnd:   hactive + hsyncOff + hsyncWidth,
+		HTotal:     hactive + hblank,
+		VDisplay:   vactive,
+		VSyncStart: vactive + vsyncOff,
+		VSyncEnd:   vactive + vsyncOff + vsyncWidth,
+		VTotal:     vactive + vblank,
+		Type:       ModeTypeDriver,
+		Name:       fmt.Sprintf("%vx%v", hactive, vactive),
+	}
+
+	if hsyncOff+hsyncWidth > hblank || vsyncOff+vsyncWidth > vblank {
+		edid.warnf("detailed timing %v: sync pulse extends past the blanking period", mode.Name)
+	}
+	if hactive == 0 || vactive == 0 {
+		edid.warnf("detailed timing %v: invalid size", mode.Name)
+	}
+
+	flags := d[17]
+	if flags&0x80 != 0 {
+		mode.VDisplay *= 2
+		mode.VSyncStart *= 2
+		mode.VSyncEnd *= 2
+		mode.VTotal = mode.VTotal*2 | 1
+		mode.Flags |= ModeFlagInterlace
+		mode.Name += "i"
+	}
+	// The kernel always reads the polarities from bits 1 and 2, whatever the
+	// sync type, and only logs composite sync
+	if flags>>3&0x3 == 0 {
+		edid.warnf("detailed timing %v: composite sync not supported", mode.Name)
+	}
+	if flags&0x02 != 0 {
+		mode.Flags |= ModeFlagPHSync
+	} else {
+		mode.Flags |= ModeFlagNHSync
+	}
+	if flags&0x04 != 0 {
+		mode.Flags |= ModeFlagPVSync
+	} else {
+		mode.Flags |= ModeFlagNVSync
+	}
+	mode.VRefresh = uint32(math.Round(mode.RefreshRate()))
+	return mode
+}
+
+func (edid *EDID) parseRangeLimits(d []byte) {
+	if edid.RangeLimits != nil {
+		edid.warnf("duplicate display range limits descriptor")
+	}
+
+	// Since EDID 1.4, byte 4 contains +255 offset flags
+	var offsets byte
+	if edid.Revision >= 4 {
+		offsets = d[4]
+	}
+	rate := func(v byte, offset bool) int {
+		if offset {
+			return int(v) + 255
+		}
+		return int(v)
+	}
+	limits := &EDIDRangeLimits{
+		MinVRate:      rate(d[5], offsets&0x3 == 0x3),
+		MaxVRate:      rate(d[6], offsets&0x2 != 0),
+		MinHRate:      rate(d[7], offsets&0xC == 0xC),
+		MaxHRate:      rate(d[8], offsets&0x8 != 0),
+		MaxPixelClock: int(d[9]) * 10,
+	}
+	if limits.MinVRate > limits.MaxVRate || limits.MinHRate > limits.MaxHRate {
+		edid.warnf("display range limits: minimum is above maximum")
+	}
+	edid.RangeLimits = limits
+}
+
+// descriptorString decodes a display descriptor string, which must be
+// terminated by a line feed and padded with spaces.
+func (edid *EDID) descriptorString(desc []byte) string {
+	b := desc[5:]
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		for _, c := range b[i+1:] {
+			if c != ' ' {
+				edid.warnf("descriptor string %q isn't padded with spaces", edidString(b))
+				break
+			}
+		}
+	}
+	return edidString(b)
+}
+
+func edidString(b []byte) string {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
@@ -0,0 +1,439 @@
+package drm
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	edidExtCTA = 0x02
+
+	ctaDataBlockAudio             = 1
+	ctaDataBlockVideo             = 2
+	ctaDataBlockVendor            = 3
+	ctaDataBlockSpeakerAllocation = 4
+	ctaDataBlockExtended          = 7
+
+	ctaExtDataBlockVideoCapability   = 0
+	ctaExtDataBlockColorimetry       = 5
+	ctaExtDataBlockHDRStaticMetadata = 6
+	ctaExtDataBlockYCbCr420Video     = 14
+
+	ouiHDMI      = 0x000C03
+	ouiHDMIForum = 0xC45DD8
+)
+
+// EDIDCTAExtension is a CTA-861 extension block, as used by TVs and HDMI
+// displays.
+type EDIDCTAExtension struct {
+	Revision uint8
+
+	Underscan, BasicAudio, YCbCr444, YCbCr422 bool
+	// Number of native detailed timings
+	NativeTimings int
+
+	DataBlocks      []EDIDDataBlock
+	DetailedTimings []ModeModeInfo
+}
+
+// EDIDDataBlock is a CTA-861 data block. Data contains the raw payload, the
+// other fields are only set for the block types they apply to.
+type EDIDDataBlock struct {
+	Tag uint8
+	// Only set for extended tag blocks
+	ExtendedTag uint8
+	Data        []byte
+
+	// Video and YCbCr 4:2:0 video data blocks
+	VideoCodes []EDIDVideoCode
+	// Audio data blocks
+	AudioFormats []EDIDAudioFormat
+	// Speaker allocation data blocks
+	Speakers []string
+	// Vendor-specific data blocks
+	OUI       uint32
+	HDMI      *EDIDHDMI
+	HDMIForum *EDIDHDMIForum
+	// Colorimetry data blocks
+	Colorimetry []string
+	// HDR static metadata data blocks
+	HDRStaticMetadata *EDIDHDRStaticMetadata
+}
+
+// Name returns a human-readable name for the data block type.
+func (db *EDIDDataBlock) Name() string {
+	switch db.Tag {
+	case ctaDataBlockAudio:
+		return "Audio Data Block"
+	case ctaDataBlockVideo:
+		return "Video Data Block"
+	case ctaDataBlockVendor:
+		switch db.OUI {
+		case ouiHDMI:
+			return "Vendor-Specific Data Block (HDMI)"
+		case ouiHDMIForum:
+			return "Vendor-Specific Data Block (HDMI Forum)"
+		}
+		return "Vendor-Specific Data Block"
+	case ctaDataBlockSpeakerAllocation:
+		return "Speaker Allocation Data Block"
+	case 5:
+		return "VESA Display Transfer Characteristic Data Block"
+	case ctaDataBlockExtended:
+		// Handled below
+	default:
+		return "Reserved Data Block"
+	}
+
+	switch db.ExtendedTag {
+	case ctaExtDataBlockVideoCapability:
+		return "Video Capability Data Block"
+	case 1:
+		return "Vendor-Specific Video Data Block"
+	case 2:
+		return "VESA Video Display Device Data Block"
+	case ctaExtDataBlockColorimetry:
+		return "Colorimetry Data Block"
+	case ctaExtDataBlockHDRStaticMetadata:
+		return "HDR Static Metadata Data Block"
+	case 7:
+		return "HDR Dynamic Metadata Data Block"
+	case 13:
+		return "Video Format Preference Data Block"
+	case ctaExtDataBlockYCbCr420Video:
+		return "YCbCr 4:2:0 Video Data Block"
+	case 15:
+		return "YCbCr 4:2:0 Capability Map Data Block"
+	case 17:
+		return "Vendor-Specific Audio Data Block"
+	case 18:
+		return "HDMI Audio Data Block"
+	case 19:
+		return "Room Configuration Data Block"
+	case 20:
+		return "Speaker Location Data Block"
+	case 32:
+		return "InfoFrame Data Block"
+	case 120:
+		return "HDMI Forum EDID Extension Override Data Block"
+	case 121:
+		return "HDMI Forum Sink Capability Data Block"
+	default:
+		return fmt.Sprintf("Reserved Extended Data Block (tag %v)", db.ExtendedTag)
+	}
+}
+
+// EDIDVideoCode is a CTA-861 video identification code (VIC).
+type EDIDVideoCode struct {
+	VIC    uint8
+	Native bool
+}
+
+// Timing returns the video format of the code, or nil if unknown.
+func (vc EDIDVideoCode) Timing() *EDIDTiming {
+	t, ok := ctaVideoCodes[vc.VIC]
+	if !ok {
+		return nil
+	}
+	return &t
+}
+
+// EDIDAudioFormat is a CTA-861 short audio descriptor. Sample rates are in
+// Hz, bit depths are only set for LPCM.
+type EDIDAudioFormat struct {
+	Coding      EDIDAudioCoding
+	Channels    int
+	SampleRates []int
+	BitDepths   []int
+}
+
+// EDIDAudioCoding is a CTA-861 audio format code.
+type EDIDAudioCoding uint8
+
+func (c EDIDAudioCoding) String() string {
+	names := []string{
+		"reserved", "LPCM", "AC-3", "MPEG-1", "MP3", "MPEG-2", "AAC LC", "DTS",
+		"ATRAC", "DSD", "E-AC-3", "DTS-HD", "MLP", "DST", "WMA Pro", "extended",
+	}
+	if int(c) < len(names) {
+		return names[c]
+	}
+	return "unknown"
+}
+
+// EDIDHDMI contains capabilities from the HDMI vendor-specific data block.
+type EDIDHDMI struct {
+	// CEC physical address, e.g. 1.0.0.0
+	PhysicalAddress [4]uint8
+	// Deep color bit depths supported in addition to 8 bits per component
+	DeepColor []int
+	// Maximum TMDS clock in MHz, zero if unspecified
+	MaxTMDSClock int
+}
+
+// EDIDHDMIForum contains capabilities from the HDMI Forum vendor-specific data
+// block, introduced with HDMI 2.0.
+type EDIDHDMIForum struct {
+	Version int
+	// Maximum TMDS character rate in MHz, zero if limited to 340 MHz
+	MaxTMDSCharRate int
+	SCDC            bool
+}
+
+// ctaVideoCodes lists common VICs, see CTA-861-G table 3.
+var ctaVideoCodes = map[uint8]EDIDTiming{
+	1: {640, 480, 60, false}, 2: {720, 480, 60, false}, 3: {720, 480, 60, false},
+	4: {1280, 720, 60, false}, 5: {1920, 1080, 60, true}, 6: {1440, 480, 60, true},
+	7: {1440, 480, 60, true}, 8: {1440, 240, 60, false}, 9: {1440, 240, 60, false},
+	10: {2880, 480, 60, true}, 11: {2880, 480, 60, true}, 12: {2880, 240, 60, false},
+	13: {2880, 240, 60, false}, 14: {1440, 480, 60, false}, 15: {1440, 480, 60, false},
+	16: {1920, 1080, 60, false}, 17: {720, 576, 50, false}, 18: {720, 576, 50, false},
+	19: {1280, 720, 50, false}, 20: {1920, 1080, 50, true}, 21: {1440, 576, 50, true},
+	22: {1440, 576, 50, true}, 23: {1440, 288, 50, false}, 24: {1440, 288, 50, false},
+	25: {2880, 576, 50, true}, 26: {2880, 576, 50, true}, 27: {2880, 288, 50, false},
+	28: {2880, 288, 50, false}, 29: {1440, 576, 50, false}, 30: {1440, 576, 50, false},
+	31: {1920, 1080, 50, false}, 32: {1920, 1080, 24, false}, 33: {1920, 1080, 25, false},
+	34: {1920, 1080, 30, false}, 35: {2880, 480, 60, false}, 36: {2880, 480, 60, false},
+	37: {2880, 576, 50, false}, 38: {2880, 576, 50, false}, 39: {1920, 1080, 50, true},
+	40: {1920, 1080, 100, true}, 41: {1280, 720, 100, false}, 42: {720, 576, 100, false},
+	43: {720, 576, 100, false}, 44: {1440, 576, 100, true}, 45: {1440, 576, 100, true},
+	46: {1920, 1080, 120, true}, 47: {1280, 720, 120, false}, 48: {720, 480, 120, false},
+	49: {720, 480, 120, false}, 50: {1440, 480, 120, true}, 51: {1440, 480, 120, true},
+	52: {720, 576, 200, false}, 53: {720, 576, 200, false}, 54: {1440, 576, 200, true},
+	55: {1440, 576, 200, true}, 56: {720, 480, 240, false}, 57: {720, 480, 240, false},
+	58: {1440, 480, 240, true}, 59: {1440, 480, 240, true}, 60: {1280, 720, 24, false},
+	61: {1280, 720, 25, false}, 62: {1280, 720, 30, false}, 63: {1920, 1080, 120, false},
+	64: {1920, 1080, 100, false},
+	93: {3840, 2160, 24, false}, 94: {3840, 2160, 25, false}, 95: {3840, 2160, 30, false},
+	96: {3840, 2160, 50, false}, 97: {3840, 2160, 60, false}, 98: {4096, 2160, 24, false},
+	99: {4096, 2160, 25, false}, 100: {4096, 2160, 30, false}, 101: {4096, 2160, 50, false},
+	102: {4096, 2160, 60, false}, 103: {3840, 2160, 24, false}, 104: {3840, 2160, 25, false},
+	105: {3840, 2160, 30, false}, 106: {3840, 2160, 50, false}, 107: {3840, 2160, 60, false},
+}
+
+var (
+	ctaSampleRates = []int{32000, 44100, 48000, 88200, 96000, 176400, 192000}
+	ctaSpeakers    = []string{
+		"FL/FR", "LFE1", "FC", "BL/BR", "BC", "FLc/FRc", "RLC/RRC", "FLw/FRw",
+		"TpFL/TpFR", "TpC", "TpFC", "LS/RS", "LFE2", "TpBC", "SiL/SiR", "TpSiL/TpSiR",
+		"TpBL/TpBR", "BtFC", "BtFL/BtFR", "TpLS/TpRS",
+	}
+	ctaColorimetry = []string{
+		"xvYCC601", "xvYCC709", "sYCC601", "opYCC601", "opRGB", "BT2020cYCC", "BT2020YCC", "BT2020RGB",
+	}
+)
+
+func parseCTAExtension(edid *EDID, index int, ext []byte) *EDIDCTAExtension {
+	cta := &EDIDCTAExtension{Revision: ext[1]}
+	if cta.Revision < 1 || cta.Revision > 3 {
+		edid.warnf("extension block %v: unknown CTA-861 revision %v", index, cta.Revision)
+	}
+	if cta.Revision >= 2 {
+		cta.Underscan = ext[3]&0x80 != 0
+		cta.BasicAudio = ext[3]&0x40 != 0
+		cta.YCbCr444 = ext[3]&0x20 != 0
+		cta.YCbCr422 = ext[3]&0x10 != 0
+		cta.NativeTimings = int(ext[3] & 0x0F)
+	}
+
+	// Data blocks are located between byte 4 and the first detailed timing
+	// descriptor
+	end := int(ext[2])
+	if end != 0 && (end < 4 || end > edidBlockSize-1) {
+		edid.warnf("extension block %v: invalid detailed timing offset %v", index, end)
+		end = 4
+	}
+	if end == 0 {
+		// No detailed timings and no data blocks
+		end = 4
+	} else if cta.Revision < 3 && end > 4 {
+		edid.warnf("extension block %v: data blocks require CTA-861 revision 3", index)
+	}
+
+	for off := 4; off < end; {
+		tag := ext[off] >> 5
+		l := int(ext[off] & 0x1F)
+		if off+1+l > end {
+			edid.warnf("extension block %v: data block at offset %v overflows into detailed timings", index, off)
+			break
+		}
+		data := ext[off+1 : off+1+l]
+		off += 1 + l
+
+		db := EDIDDataBlock{Tag: tag, Data: data}
+		if tag == ctaDataBlockExtended {
+			if l == 0 {
+				edid.warnf("extension block %v: empty extended data block", index)
+				continue
+			}
+			db.ExtendedTag = data[0]
+			db.Data = data[1:]
+		}
+		parseCTADataBlock(edid, index, &db)
+		cta.DataBlocks = append(cta.DataBlocks, db)
+	}
+
+	if ext[2] != 0 {
+		for off := int(ext[2]); off+18 <= edidBlockSize-1; off += 18 {
+			desc := ext[off : off+18]
+			if desc[0] == 0 && desc[1] == 0 {
+				break
+			}
+			cta.DetailedTimings = append(cta.DetailedTimings, *edid.parseDetailedTiming(desc))
+		}
+	}
+
+	return cta
+}
+
+func parseCTADataBlock(edid *EDID, index int, db *EDIDDataBlock) {
+	b := db.Data
+	switch {
+	case db.Tag == ctaDataBlockVideo:
+		db.VideoCodes = parseVideoCodes(b)
+	case db.Tag == ctaDataBlockAudio:
+		if len(b)%3 != 0 {
+			edid.warnf("extension block %v: audio data block length %v isn't a multiple of 3", index, len(b))
+		}
+		for i := 0; i+3 <= len(b); i += 3 {
+			af := EDIDAudioFormat{
+				Coding:   EDIDAudioCoding(b[i] >> 3 & 0x0F),
+				Channels: int(b[i]&0x07) + 1,
+			}
+			for j, rate := range ctaSampleRates {
+				if b[i+1]&(1<<uint(j)) != 0 {
+					af.SampleRates = append(af.SampleRates, rate)
+				}
+			}
+			if af.Coding == 1 {
+				for j, depth := range []int{16, 20, 24} {
+					if b[i+2]&(1<<uint(j)) != 0 {
+						af.BitDepths = append(af.BitDepths, depth)
+					}
+				}
+			}
+			db.AudioFormats = append(db.AudioFormats, af)
+		}
+	case db.Tag == ctaDataBlockSpeakerAllocation:
+		if len(b) < 3 {
+			edid.warnf("extension block %v: speaker allocation data block too short", index)
+			return
+		}
+		mask := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		for i, name := range ctaSpeakers {
+			if mask&(1<<uint(i)) != 0 {
+				db.Speakers = append(db.Speakers, name)
+			}
+		}
+	case db.Tag == ctaDataBlockVendor:
+		if len(b) < 3 {
+			edid.warnf("extension block %v: vendor-specific data block too short", index)
+			return
+		}
+		db.OUI = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		switch db.OUI {
+		case ouiHDMI:
+			db.HDMI = parseHDMIBlock(edid, index, b[3:])
+		case ouiHDMIForum:
+			db.HDMIForum = parseHDMIForumBlock(edid, index, b[3:])
+		}
+	case db.Tag == ctaDataBlockExtended && db.ExtendedTag == ctaExtDataBlockYCbCr420Video:
+		db.VideoCodes = parseVideoCodes(b)
+	case db.Tag == ctaDataBlockExtended && db.ExtendedTag == ctaExtDataBlockColorimetry:
+		if len(b) < 2 {
+			edid.warnf("extension block %v: colorimetry data block too short", index)
+			return
+		}
+		for i, name := range ctaColorimetry {
+			if b[0]&(1<<uint(i)) != 0 {
+				db.Colorimetry = append(db.Colorimetry, name)
+			}
+		}
+		if b[1]&0x80 != 0 {
+			db.Colorimetry = append(db.Colorimetry, "DCI-P3")
+		}
+	case db.Tag == ctaDataBlockExtended && db.ExtendedTag == ctaExtDataBlockHDRStaticMetadata:
+		db.HDRStaticMetadata = parseHDRStaticMetadataBlock(b)
+		if db.HDRStaticMetadata == nil {
+			edid.warnf("extension block %v: HDR static metadata data block too short", index)
+		} else if edid.HDRStaticMetadata == nil {
+			edid.HDRStaticMetadata = db.HDRStaticMetadata
+		}
+	}
+}
+
+func parseVideoCodes(b []byte) []EDIDVideoCode {
+	codes := make([]EDIDVideoCode, len(b))
+	for i, v := range b {
+		// VICs 1 to 64 can be flagged as native with the high bit
+		if v&0x80 != 0 && v&0x7F >= 1 && v&0x7F <= 64 {
+			codes[i] = EDIDVideoCode{VIC: v & 0x7F, Native: true}
+		} else {
+			codes[i] = EDIDVideoCode{VIC: v}
+		}
+	}
+	return codes
+}
+
+func parseHDMIBlock(edid *EDID, index int, b []byte) *EDIDHDMI {
+	if len(b) < 2 {
+		edid.warnf("extension block %v: HDMI vendor-specific data block too short", index)
+		return nil
+	}
+	hdmi := &EDIDHDMI{
+		PhysicalAddress: [4]uint8{b[0] >> 4, b[0] & 0x0F, b[1] >> 4, b[1] & 0x0F},
+	}
+	if len(b) > 2 {
+		for i, depth := range []int{30, 36, 48} {
+			if b[2]&(1<<uint(4+i)) != 0 {
+				hdmi.DeepColor = append(hdmi.DeepColor, depth)
+			}
+		}
+	}
+	if len(b) > 3 {
+		hdmi.MaxTMDSClock = 5 * int(b[3])
+	}
+	return hdmi
+}
+
+func parseHDMIForumBlock(edid *EDID, index int, b []byte) *EDIDHDMIForum {
+	if len(b) < 3 {
+		edid.warnf("extension block %v: HDMI Forum vendor-specific data block too short", index)
+		return nil
+	}
+	forum := &EDIDHDMIForum{
+		Version:         int(b[0]),
+		MaxTMDSCharRate: 5 * int(b[1]),
+		SCDC:            b[2]&0x80 != 0,
+	}
+	if forum.MaxTMDSCharRate != 0 && forum.MaxTMDSCharRate <= 340 {
+		edid.warnf("extension block %v: HDMI Forum maximum TMDS character rate %v MHz must be above 340 MHz", index, forum.MaxTMDSCharRate)
+	}
+	return forum
+}
+
+func parseHDRStaticMetadataBlock(b []byte) *EDIDHDRStaticMetadata {
+	if len(b) < 2 {
+		return nil
+	}
+
+	md := &EDIDHDRStaticMetadata{StaticMetadataType1: b[1]&0x01 != 0}
+	for eotf := HDREOTF(0); eotf < 6; eotf++ {
+		if b[0]&(1<<eotf) != 0 {
+			md.EOTFs = append(md.EOTFs, eotf)
+		}
+	}
+
+	// Luminance code values, see CTA-861-G section 7.5.13
+	if len(b) > 2 && b[2] != 0 {
+		md.MaxLuminance = 50 * math.Pow(2, float64(b[2])/32)
+	}
+	if len(b) > 3 && b[3] != 0 {
+		md.MaxFrameAvgLuminance = 50 * math.Pow(2, float64(b[3])/32)
+	}
+	if len(b) > 4 && md.MaxLuminance != 0 {
+		cv := float64(b[4]) / 255
+		md.MinLuminance = md.MaxLuminance * cv * cv / 100
+	}
+	return md
+}
@@ -0,0 +1,165 @@
+package drm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+// newTestEDID builds an EDID 1.4 with a 1080p preferred timing, range limits,
+// a product name and a CTA-861 extension with video, audio and HDMI blocks.
+func newTestEDID() []byte {
+	b := make([]byte, 256)
+	copy(b, []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00})
+	b[8], b[9] = 0x10, 0xAC // DEL
+	b[16], b[17] = 12, 29
+	b[18], b[19] = 1, 4
+	b[20] = 0x80 | 3<<4 | 5 // digital, 10 bits, DisplayPort
+	b[23] = 120
+	b[24] = 0x07
+	b[35] = 0x20              // 640x480@60
+	b[38], b[39] = 0xD1, 0xC0 // 1920x1080@60
+	for i := 40; i < 54; i++ {
+		b[i] = 0x01
+	}
+
+	// 1920x1080@60, 148.5 MHz, positive syncs
+	copy(b[54:], []byte{0x02, 0x3A, 0x80, 0x18, 0x71, 0x38, 0x2D, 0x40, 0x58, 0x2C, 0x45, 0x00, 0, 0, 0, 0, 0, 0x1E})
+	copy(b[72:], []byte{0, 0, 0, 0xFD, 0, 24, 75, 30, 135, 60, 0, 0x0A, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20})
+	copy(b[90:], []byte{0, 0, 0, 0xFC, 0})
+	copy(b[95:], "DELL U2720Q\n ")
+	copy(b[108:], []byte{0, 0, 0, 0x10})
+	b[126] = 1
+	edidChecksum(b[:128])
+
+	ext := b[128:]
+	ext[0], ext[1], ext[3] = 0x02, 3, 0xC1
+	blocks := []byte{
+		2<<5 | 3, 0x90, 0x04, 97, // VICs 16 (native), 4, 97
+		1<<5 | 3, 0x09, 0x07, 0x07, // 2-channel LPCM
+		3<<5 | 5, 0x03, 0x0C, 0x00, 0x10, 0x00, // HDMI, 1.0.0.0
+	}
+	copy(ext[4:], blocks)
+	ext[2] = byte(4 + len(blocks))
+	edidChecksum(ext)
+	return b
+}
+
+func TestParseEDID(t *testing.T) {
+	edid, err := drm.ParseEDID(newTestEDID())
+	if err != nil {
+		t.Fatalf("ParseEDID() = %v", err)
+	}
+	if len(edid.Warnings) > 0 {
+		t.Errorf("ParseEDID() warnings = %q, want none", edid.Warnings)
+	}
+
+	if edid.Manufacturer != "DEL" || edid.Name != "DELL U2720Q" || edid.BitDepth != 10 || edid.VideoInterface != drm.EDIDVideoInterfaceDisplayPort || edid.Gamma != 2.2 {
+		t.Errorf("ParseEDID() = %+v, want a DEL 10-bit DisplayPort display with gamma 2.2", edid)
+	}
+	if want := []drm.EDIDTiming{{640, 480, 60, false}}; !reflect.DeepEqual(edid.EstablishedTimings, want) {
+		t.Errorf("EDID.EstablishedTimings = %v, want %v", edid.EstablishedTimings, want)
+	}
+	if want := []drm.EDIDTiming{{1920, 1080, 60, false}}; !reflect.DeepEqual(edid.StandardTimings, want) {
+		t.Errorf("EDID.StandardTimings = %v, want %v", edid.StandardTimings, want)
+	}
+	if want := (drm.EDIDRangeLimits{24, 75, 30, 135, 600}); edid.RangeLimits == nil || *edid.RangeLimits != want {
+		t.Errorf("EDID.RangeLimits = %+v, want %+v", edid.RangeLimits, want)
+	}
+
+	want := drm.ModeModeInfo{
+		Clock:      148500,
+		HDisplay:   1920,
+		HSyncStart: 2008,
+		HSyncEnd:   2052,
+		HTotal:     2200,
+		VDisplay:   1080,
+		VSyncStart: 1084,
+		VSyncEnd:   1089,
+		VTotal:     1125,
+		VRefresh:   60,
+		Flags:      drm.ModeFlagPHSync | drm.ModeFlagPVSync,
+		Type:       drm.ModeTypePreferred | drm.ModeTypeDriver,
+		Name:       "1920x1080",
+	}
+	if len(edid.DetailedTimings) != 1 || edid.DetailedTimings[0] != want {
+		t.Errorf("EDID.DetailedTimings = %+v, want %+v", edid.DetailedTimings, want)
+	}
+
+	if len(edid.ExtensionBlocks) != 1 || edid.ExtensionBlocks[0].CTA == nil {
+		t.Fatalf("EDID.ExtensionBlocks = %+v, want a CTA-861 extension", edid.ExtensionBlocks)
+	}
+	cta := edid.ExtensionBlocks[0].CTA
+	if !cta.BasicAudio || !cta.Underscan || cta.NativeTimings != 1 || len(cta.DataBlocks) != 3 {
+		t.Fatalf("EDIDCTAExtension = %+v, want basic audio, underscan and 3 data blocks", cta)
+	}
+	wantVICs := []drm.EDIDVideoCode{{16, true}, {4, false}, {97, false}}
+	if vics := cta.DataBlocks[0].VideoCodes; !reflect.DeepEqual(vics, wantVICs) {
+		t.Errorf("EDIDDataBlock.VideoCodes = %v, want %v", vics, wantVICs)
+	}
+	wantAudio := []drm.EDIDAudioFormat{{
+		Coding:      1,
+		Channels:    2,
+		SampleRates: []int{32000, 44100, 48000},
+		BitDepths:   []int{16, 20, 24},
+	}}
+	if audio := cta.DataBlocks[1].AudioFormats; !reflect.DeepEqual(audio, wantAudio) {
+		t.Errorf("EDIDDataBlock.AudioFormats = %+v, want %+v", audio, wantAudio)
+	}
+	if hdmi := cta.DataBlocks[2].HDMI; hdmi == nil || hdmi.PhysicalAddress != [4]uint8{1, 0, 0, 0} {
+		t.Errorf("EDIDDataBlock.HDMI = %+v, want physical address 1.0.0.0", hdmi)
+	}
+}
+
+func TestParseEDID_warnings(t *testing.T) {
+	b := newTestEDID()
+	// Break the extension checksum and the range limits
+	b[255]++
+	b[72+5], b[72+6] = 75, 24
+	edidChecksum(b[:128])
+
+	edid, err := drm.ParseEDID(b)
+	if err != nil {
+		t.Fatalf("ParseEDID() = %v", err)
+	}
+	if edid.ExtensionBlocks[0].CTA != nil {
+		t.Errorf("ParseEDID() decoded an extension with an invalid checksum")
+	}
+	want := []string{
+		"display range limits: minimum is above maximum",
+		"preferred timing refresh rate 60.00 Hz is outside of the range limits",
+		"extension block 1: invalid checksum",
+	}
+	if !reflect.DeepEqual(edid.Warnings, want) {
+		t.Errorf("ParseEDID() warnings = %q, want %q", edid.Warnings, want)
+	}
+}
+
+func TestParseEDID_syncFlags(t *testing.T) {
+	tests := []struct {
+		flags   byte
+		want    uint32
+		warning bool
+	}{
+		{0x1A, drm.ModeFlagPHSync | drm.ModeFlagNVSync, false}, // digital separate
+		{0x10, drm.ModeFlagNHSync | drm.ModeFlagNVSync, false}, // digital composite
+		{0x06, drm.ModeFlagPHSync | drm.ModeFlagPVSync, true},  // analog composite
+	}
+	for _, tc := range tests {
+		b := newTestEDID()
+		b[54+17] = tc.flags
+		edidChecksum(b[:128])
+
+		edid, err := drm.ParseEDID(b)
+		if err != nil {
+			t.Fatalf("ParseEDID() = %v", err)
+		}
+		if got := edid.DetailedTimings[0].Flags; got != tc.want {
+			t.Errorf("flags 0x%02X: ModeModeInfo.Flags = 0x%X, want 0x%X", tc.flags, got, tc.want)
+		}
+		if warning := len(edid.Warnings) > 0; warning != tc.warning {
+			t.Errorf("flags 0x%02X: ParseEDID() warnings = %q", tc.flags, edid.Warnings)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package drm
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the host, used by the kernel for blobs.
+var nativeEndian binary.ByteOrder
+
+func init() {
+	v := uint16(1)
+	if *(*byte)(unsafe.Pointer(&v)) == 1 {
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
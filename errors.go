@@ -0,0 +1,62 @@
+package drm
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+var (
+	// ErrNotFound is returned when an object doesn't exist, e.g. because it
+	// has been removed after a hot-unplug.
+	ErrNotFound = errors.New("drm: object not found")
+	// ErrPermission is returned when the operation requires privileges the
+	// caller doesn't have, e.g. DRM master.
+	ErrPermission = errors.New("drm: permission denied")
+	// ErrDeviceGone is returned when the device has been removed.
+	ErrDeviceGone = errors.New("drm: device gone")
+	// ErrNotSupported is returned when the driver or kernel doesn't support
+	// the operation.
+	ErrNotSupported = errors.New("drm: operation not supported")
+)
+
+// Error is an error returned by an ioctl.
+type Error struct {
+	Op     string   // ioctl name
+	Object ObjectID // zero if the ioctl doesn't operate on an object
+	Errno  syscall.Errno
+}
+
+func newError(req uint32, obj ObjectID, err error) error {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return err
+	}
+	return &Error{Op: ioctlName(req), Object: obj, Errno: errno}
+}
+
+func (err *Error) Error() string {
+	if err.Object != 0 {
+		return fmt.Sprintf("drm: %v on object %v: %v", err.Op, err.Object, err.Errno)
+	}
+	return fmt.Sprintf("drm: %v: %v", err.Op, err.Errno)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Errno
+}
+
+func (err *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return err.Errno == syscall.ENOENT
+	case ErrPermission:
+		return err.Errno == syscall.EACCES || err.Errno == syscall.EPERM
+	case ErrDeviceGone:
+		return err.Errno == syscall.ENODEV
+	case ErrNotSupported:
+		return err.Errno == syscall.EOPNOTSUPP || err.Errno == syscall.ENOTTY
+	default:
+		return false
+	}
+}
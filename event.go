@@ -0,0 +1,129 @@
+package drm
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+type EventType uint32
+
+const (
+	EventVBlank       EventType = 0x01
+	EventFlipComplete EventType = 0x02
+	EventCRTCSequence EventType = 0x03
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventVBlank:
+		return "vblank"
+	case EventFlipComplete:
+		return "flip-complete"
+	case EventCRTCSequence:
+		return "crtc-sequence"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is an event read from a node, either a *VBlankEvent or a
+// *CRTCSequenceEvent.
+type Event interface {
+	EventType() EventType
+}
+
+// VBlankEvent is delivered when a vblank wait or a page-flip completes.
+// Time is a CLOCK_MONOTONIC timestamp if CapTimestampMonotonic is set. CRTC is
+// only filled if CapCRTCInVBlankEvent is set.
+type VBlankEvent struct {
+	Type     EventType
+	UserData uint64
+	Time     time.Duration
+	Sequence uint32
+	CRTC     CRTCID
+}
+
+func (ev *VBlankEvent) EventType() EventType {
+	return ev.Type
+}
+
+// CRTCSequenceEvent is delivered when a sequence queued with
+// Node.CRTCQueueSequence is reached.
+type CRTCSequenceEvent struct {
+	UserData uint64
+	Time     time.Duration
+	Sequence uint64
+}
+
+func (ev *CRTCSequenceEvent) EventType() EventType {
+	return EventCRTCSequence
+}
+
+const (
+	eventHeaderSize       = 8
+	eventVBlankSize       = 32
+	eventCRTCSequenceSize = 32
+
+	// The kernel never returns events larger than this
+	eventBufferSize = 4096
+)
+
+// ReadEvents reads pending events from the node. It blocks until at least one
+// event is available, unless the file descriptor is non-blocking. Unknown
+// events are skipped.
+func (n *Node) ReadEvents() ([]Event, error) {
+	r, ok := n.backend.(io.Reader)
+	if !ok {
+		return nil, fmt.Errorf("drm: backend doesn't deliver events")
+	}
+
+	b := make([]byte, eventBufferSize)
+	l, err := r.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return parseEvents(b[:l])
+}
+
+func parseEvents(b []byte) ([]Event, error) {
+	var events []Event
+	for len(b) > 0 {
+		if len(b) < eventHeaderSize {
+			return nil, fmt.Errorf("drm: truncated event header")
+		}
+		t := EventType(nativeEndian.Uint32(b[0:4]))
+		l := nativeEndian.Uint32(b[4:8])
+		if l < eventHeaderSize || uint64(l) > uint64(len(b)) {
+			return nil, fmt.Errorf("drm: invalid event length %v", l)
+		}
+		data := b[:l]
+		b = b[l:]
+
+		switch t {
+		case EventVBlank, EventFlipComplete:
+			if len(data) < eventVBlankSize {
+				return nil, fmt.Errorf("drm: truncated %v event", t)
+			}
+			sec := nativeEndian.Uint32(data[16:20])
+			usec := nativeEndian.Uint32(data[20:24])
+			events = append(events, &VBlankEvent{
+				Type:     t,
+				UserData: nativeEndian.Uint64(data[8:16]),
+				Time:     time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond,
+				Sequence: nativeEndian.Uint32(data[24:28]),
+				CRTC:     CRTCID(nativeEndian.Uint32(data[28:32])),
+			})
+		case EventCRTCSequence:
+			if len(data) < eventCRTCSequenceSize {
+				return nil, fmt.Errorf("drm: truncated %v event", t)
+			}
+			events = append(events, &CRTCSequenceEvent{
+				UserData: nativeEndian.Uint64(data[8:16]),
+				Time:     time.Duration(int64(nativeEndian.Uint64(data[16:24]))),
+				Sequence: nativeEndian.Uint64(data[24:32]),
+			})
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,50 @@
+package drm
+
+import (
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+type FBFlags uint32
+
+const (
+	FBInterlaced FBFlags = 1 << 0
+	// FBModifiers indicates that ModeFB2.Modifiers is set. Without it, the
+	// driver infers the modifier.
+	FBModifiers FBFlags = 1 << 1
+)
+
+// ModeFB2 describes a framebuffer made of up to 4 planes, as passed to
+// ModeAddFB2.
+type ModeFB2 struct {
+	Width, Height uint32
+	Format        Format
+	Flags         FBFlags
+	Handles       [4]uint32
+	Pitches       [4]uint32
+	Offsets       [4]uint32
+	Modifiers     [4]Modifier
+}
+
+func (n *Node) ModeAddFB2(fb *ModeFB2) (FBID, error) {
+	r := uapi.ModeFBCmd2{
+		Width:       fb.Width,
+		Height:      fb.Height,
+		PixelFormat: uint32(fb.Format),
+		Flags:       uint32(fb.Flags),
+		Handles:     fb.Handles,
+		Pitches:     fb.Pitches,
+		Offsets:     fb.Offsets,
+	}
+	for i, mod := range fb.Modifiers {
+		r.Modifiers[i] = uint64(mod)
+	}
+	if err := modeAddFB2(n.backend, &r); err != nil {
+		return 0, err
+	}
+	return FBID(r.FBID), nil
+}
+
+func (n *Node) ModeRemoveFB(id FBID) error {
+	r := uapi.ModeRemoveFBArg{FBID: uint32(id)}
+	return modeRemoveFB(n.backend, &r)
+}
@@ -0,0 +1,80 @@
+package drm
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+const pollIn = 0x1
+
+// isReadable checks whether a file descriptor is readable, without blocking.
+func isReadable(fd uintptr) (bool, error) {
+	pfd := pollFd{fd: int32(fd), events: pollIn}
+	var ts syscall.Timespec
+	n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&pfd)), 1, uintptr(unsafe.Pointer(&ts)), 0, 0, 0)
+	if errno != 0 {
+		return false, errno
+	}
+	return n > 0, nil
+}
+
+// waitFence waits for a sync_file fence to signal, and closes it. A fence
+// becomes readable once signaled.
+func waitFence(fd int, timeout time.Duration) error {
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	// Non-blocking files are registered with the runtime poller
+	f := os.NewFile(uintptr(fd), "fence")
+	defer f.Close()
+
+	if timeout > 0 {
+		if err := f.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var pollErr error
+	err = conn.Read(func(fd uintptr) bool {
+		var ready bool
+		ready, pollErr = isReadable(fd)
+		return ready || pollErr != nil
+	})
+	if err == nil {
+		err = pollErr
+	}
+	if os.IsTimeout(err) {
+		return fmt.Errorf("drm: timed out waiting for fence")
+	}
+	return err
+}
+
+// newSignalledFence returns a file descriptor which behaves like a signalled
+// sync_file fence: a pipe with a pending byte.
+func newSignalledFence() (int32, error) {
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC); err != nil {
+		return -1, err
+	}
+	_, err := syscall.Write(p[1], []byte{0})
+	syscall.Close(p[1])
+	if err != nil {
+		syscall.Close(p[0])
+		return -1, err
+	}
+	return int32(p[0]), nil
+}
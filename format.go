@@ -0,0 +1,249 @@
+package drm
+
+// FormatChannel describes where a channel is stored: it's a bit field of the
+// little-endian word holding a pixel in a plane.
+type FormatChannel struct {
+	Plane, Shift, Bits uint8
+}
+
+// FormatInfo describes the memory layout of a format.
+//
+// Channels are indexed by FormatChannelRed, FormatChannelGreen,
+// FormatChannelBlue and FormatChannelAlpha for RGB formats, and by
+// FormatChannelY, FormatChannelU, FormatChannelV and FormatChannelAlpha for
+// YUV formats. Channels with zero bits are absent.
+type FormatInfo struct {
+	NumPlanes int
+	// CPP is the number of bytes per pixel in each plane. For packed 4:2:2
+	// formats, two pixels are stored in a word of CPP[0]*BlockWidth bytes, and
+	// the second Y sample is located 16 bits above the first one.
+	CPP        [3]int
+	BlockWidth int
+	// Horizontal and vertical chroma subsampling factors
+	HSub, VSub int
+	YUV        bool
+	// Float is true if channels are IEEE 754 half-precision floats
+	Float    bool
+	Channels [4]FormatChannel
+}
+
+const (
+	FormatChannelRed   = 0
+	FormatChannelGreen = 1
+	FormatChannelBlue  = 2
+	FormatChannelY     = 0
+	FormatChannelU     = 1
+	FormatChannelV     = 2
+	FormatChannelAlpha = 3
+)
+
+// HasAlpha checks whether the format has an alpha channel.
+func (info *FormatInfo) HasAlpha() bool {
+	return info.Channels[FormatChannelAlpha].Bits > 0
+}
+
+// subsampled checks whether a channel is shared by several pixels.
+func (info *FormatInfo) subsampled(ch int) bool {
+	return info.YUV && (ch == FormatChannelU || ch == FormatChannelV) && (info.HSub > 1 || info.VSub > 1)
+}
+
+// newPackedFormatInfo describes a single-plane format from its name, which
+// lists the channels from the most to the least significant bit, like in
+// drm_fourcc.h. X denotes padding.
+func newPackedFormatInfo(yuv bool, channels string, bits ...uint8) *FormatInfo {
+	info := &FormatInfo{NumPlanes: 1, BlockWidth: 1, HSub: 1, VSub: 1, YUV: yuv}
+	var total uint8
+	for _, b := range bits {
+		total += b
+	}
+	info.CPP[0] = int(total) / 8
+
+	shift := total
+	for i, c := range channels {
+		shift -= bits[i]
+		var ch int
+		switch c {
+		case 'R', 'Y':
+			ch = FormatChannelRed
+		case 'G', 'U':
+			ch = FormatChannelGreen
+		case 'B', 'V':
+			ch = FormatChannelBlue
+		case 'A':
+			ch = FormatChannelAlpha
+		default:
+			continue
+		}
+		info.Channels[ch] = FormatChannel{Shift: shift, Bits: bits[i]}
+	}
+	return info
+}
+
+func newRGBFormatInfo(channels string, bits ...uint8) *FormatInfo {
+	return newPackedFormatInfo(false, channels, bits...)
+}
+
+func newFloatFormatInfo(channels string) *FormatInfo {
+	info := newRGBFormatInfo(channels, 16, 16, 16, 16)
+	info.Float = true
+	return info
+}
+
+// newYUV422FormatInfo describes a packed 4:2:2 format, with the positions of
+// the first Y sample and of the U and V samples in bytes.
+func newYUV422FormatInfo(y, u, v uint8) *FormatInfo {
+	return &FormatInfo{
+		NumPlanes:  1,
+		CPP:        [3]int{2},
+		BlockWidth: 2,
+		HSub:       2,
+		VSub:       1,
+		YUV:        true,
+		Channels: [4]FormatChannel{
+			FormatChannelY: {Shift: 8 * y, Bits: 8},
+			FormatChannelU: {Shift: 8 * u, Bits: 8},
+			FormatChannelV: {Shift: 8 * v, Bits: 8},
+		},
+	}
+}
+
+// newSemiPlanarFormatInfo describes a format with a Y plane and an
+// interleaved UV plane. Samples are stored in the most significant bits of
+// words of the specified size.
+func newSemiPlanarFormatInfo(hsub, vsub int, bits uint8, swap bool, wordBits uint8) *FormatInfo {
+	pad := wordBits - bits
+	u, v := pad, wordBits+pad
+	if swap {
+		u, v = v, u
+	}
+	return &FormatInfo{
+		NumPlanes:  2,
+		CPP:        [3]int{int(wordBits) / 8, 2 * int(wordBits) / 8},
+		BlockWidth: 1,
+		HSub:       hsub,
+		VSub:       vsub,
+		YUV:        true,
+		Channels: [4]FormatChannel{
+			FormatChannelY: {Plane: 0, Shift: pad, Bits: bits},
+			FormatChannelU: {Plane: 1, Shift: u, Bits: bits},
+			FormatChannelV: {Plane: 1, Shift: v, Bits: bits},
+		},
+	}
+}
+
+// newPlanarFormatInfo describes a format with Y, U and V planes.
+func newPlanarFormatInfo(hsub, vsub int, swap bool) *FormatInfo {
+	u, v := uint8(1), uint8(2)
+	if swap {
+		u, v = v, u
+	}
+	return &FormatInfo{
+		NumPlanes:  3,
+		CPP:        [3]int{1, 1, 1},
+		BlockWidth: 1,
+		HSub:       hsub,
+		VSub:       vsub,
+		YUV:        true,
+		Channels: [4]FormatChannel{
+			FormatChannelY: {Plane: 0, Bits: 8},
+			FormatChannelU: {Plane: u, Bits: 8},
+			FormatChannelV: {Plane: v, Bits: 8},
+		},
+	}
+}
+
+var formatInfos = map[Format]*FormatInfo{
+	FormatR8:     newRGBFormatInfo("R", 8),
+	FormatR16:    newRGBFormatInfo("R", 16),
+	FormatRG88:   newRGBFormatInfo("RG", 8, 8),
+	FormatGR88:   newRGBFormatInfo("GR", 8, 8),
+	FormatRG1616: newRGBFormatInfo("RG", 16, 16),
+	FormatGR1616: newRGBFormatInfo("GR", 16, 16),
+
+	FormatRGB332: newRGBFormatInfo("RGB", 3, 3, 2),
+	FormatBGR233: newRGBFormatInfo("BGR", 2, 3, 3),
+
+	FormatXRGB4444: newRGBFormatInfo("XRGB", 4, 4, 4, 4),
+	FormatXBGR4444: newRGBFormatInfo("XBGR", 4, 4, 4, 4),
+	FormatRGBX4444: newRGBFormatInfo("RGBX", 4, 4, 4, 4),
+	FormatBGRX4444: newRGBFormatInfo("BGRX", 4, 4, 4, 4),
+	FormatARGB4444: newRGBFormatInfo("ARGB", 4, 4, 4, 4),
+	FormatABGR4444: newRGBFormatInfo("ABGR", 4, 4, 4, 4),
+	FormatRGBA4444: newRGBFormatInfo("RGBA", 4, 4, 4, 4),
+	FormatBGRA4444: newRGBFormatInfo("BGRA", 4, 4, 4, 4),
+
+	FormatXRGB1555: newRGBFormatInfo("XRGB", 1, 5, 5, 5),
+	FormatXBGR1555: newRGBFormatInfo("XBGR", 1, 5, 5, 5),
+	FormatRGBX5551: newRGBFormatInfo("RGBX", 5, 5, 5, 1),
+	FormatBGRX5551: newRGBFormatInfo("BGRX", 5, 5, 5, 1),
+	FormatARGB1555: newRGBFormatInfo("ARGB", 1, 5, 5, 5),
+	FormatABGR1555: newRGBFormatInfo("ABGR", 1, 5, 5, 5),
+	FormatRGBA5551: newRGBFormatInfo("RGBA", 5, 5, 5, 1),
+	FormatBGRA5551: newRGBFormatInfo("BGRA", 5, 5, 5, 1),
+
+	FormatRGB565: newRGBFormatInfo("RGB", 5, 6, 5),
+	FormatBGR565: newRGBFormatInfo("BGR", 5, 6, 5),
+
+	FormatRGB888: newRGBFormatInfo("RGB", 8, 8, 8),
+	FormatBGR888: newRGBFormatInfo("BGR", 8, 8, 8),
+
+	FormatXRGB8888: newRGBFormatInfo("XRGB", 8, 8, 8, 8),
+	FormatXBGR8888: newRGBFormatInfo("XBGR", 8, 8, 8, 8),
+	FormatRGBX8888: newRGBFormatInfo("RGBX", 8, 8, 8, 8),
+	FormatBGRX8888: newRGBFormatInfo("BGRX", 8, 8, 8, 8),
+	FormatARGB8888: newRGBFormatInfo("ARGB", 8, 8, 8, 8),
+	FormatABGR8888: newRGBFormatInfo("ABGR", 8, 8, 8, 8),
+	FormatRGBA8888: newRGBFormatInfo("RGBA", 8, 8, 8, 8),
+	FormatBGRA8888: newRGBFormatInfo("BGRA", 8, 8, 8, 8),
+
+	FormatXRGB2101010: newRGBFormatInfo("XRGB", 2, 10, 10, 10),
+	FormatXBGR2101010: newRGBFormatInfo("XBGR", 2, 10, 10, 10),
+	FormatRGBX1010102: newRGBFormatInfo("RGBX", 10, 10, 10, 2),
+	FormatBGRX1010102: newRGBFormatInfo("BGRX", 10, 10, 10, 2),
+	FormatARGB2101010: newRGBFormatInfo("ARGB", 2, 10, 10, 10),
+	FormatABGR2101010: newRGBFormatInfo("ABGR", 2, 10, 10, 10),
+	FormatRGBA1010102: newRGBFormatInfo("RGBA", 10, 10, 10, 2),
+	FormatBGRA1010102: newRGBFormatInfo("BGRA", 10, 10, 10, 2),
+
+	FormatXRGB16161616F: newFloatFormatInfo("XRGB"),
+	FormatXBGR16161616F: newFloatFormatInfo("XBGR"),
+	FormatARGB16161616F: newFloatFormatInfo("ARGB"),
+	FormatABGR16161616F: newFloatFormatInfo("ABGR"),
+
+	FormatYUYV: newYUV422FormatInfo(0, 1, 3),
+	FormatYVYU: newYUV422FormatInfo(0, 3, 1),
+	FormatUYVY: newYUV422FormatInfo(1, 0, 2),
+	FormatVYUY: newYUV422FormatInfo(1, 2, 0),
+
+	FormatAYUV:     newPackedFormatInfo(true, "AYUV", 8, 8, 8, 8),
+	FormatXYUV8888: newPackedFormatInfo(true, "XYUV", 8, 8, 8, 8),
+	FormatVUY888:   newPackedFormatInfo(true, "VUY", 8, 8, 8),
+
+	FormatNV12: newSemiPlanarFormatInfo(2, 2, 8, false, 8),
+	FormatNV21: newSemiPlanarFormatInfo(2, 2, 8, true, 8),
+	FormatNV16: newSemiPlanarFormatInfo(2, 1, 8, false, 8),
+	FormatNV61: newSemiPlanarFormatInfo(2, 1, 8, true, 8),
+	FormatNV24: newSemiPlanarFormatInfo(1, 1, 8, false, 8),
+	FormatNV42: newSemiPlanarFormatInfo(1, 1, 8, true, 8),
+	FormatP010: newSemiPlanarFormatInfo(2, 2, 10, false, 16),
+	FormatP012: newSemiPlanarFormatInfo(2, 2, 12, false, 16),
+	FormatP016: newSemiPlanarFormatInfo(2, 2, 16, false, 16),
+	FormatP210: newSemiPlanarFormatInfo(2, 1, 10, false, 16),
+
+	FormatYUV410: newPlanarFormatInfo(4, 4, false),
+	FormatYVU410: newPlanarFormatInfo(4, 4, true),
+	FormatYUV411: newPlanarFormatInfo(4, 1, false),
+	FormatYVU411: newPlanarFormatInfo(4, 1, true),
+	FormatYUV420: newPlanarFormatInfo(2, 2, false),
+	FormatYVU420: newPlanarFormatInfo(2, 2, true),
+	FormatYUV422: newPlanarFormatInfo(2, 1, false),
+	FormatYVU422: newPlanarFormatInfo(2, 1, true),
+	FormatYUV444: newPlanarFormatInfo(1, 1, false),
+	FormatYVU444: newPlanarFormatInfo(1, 1, true),
+}
+
+// Info returns the memory layout of a format, or nil if unknown. The returned
+// value must not be modified.
+func (f Format) Info() *FormatInfo {
+	return formatInfos[f]
+}
@@ -1,3 +1,3 @@
 module git.sr.ht/~emersion/go-drm
 
-go 1.12
+go 1.13
@@ -0,0 +1,171 @@
+package drm
+
+import (
+	"fmt"
+	"math"
+)
+
+// HDREOTF is an electro-optical transfer function, as defined in CTA-861.
+type HDREOTF uint8
+
+const (
+	HDREOTFTraditionalSDR HDREOTF = 0
+	HDREOTFTraditionalHDR HDREOTF = 1
+	HDREOTFST2084         HDREOTF = 2 // SMPTE ST 2084, also known as PQ
+	HDREOTFHLG            HDREOTF = 3 // BT.2100 Hybrid Log-Gamma
+)
+
+func (eotf HDREOTF) String() string {
+	switch eotf {
+	case HDREOTFTraditionalSDR:
+		return "SDR"
+	case HDREOTFTraditionalHDR:
+		return "HDR"
+	case HDREOTFST2084:
+		return "ST2084"
+	case HDREOTFHLG:
+		return "HLG"
+	default:
+		return fmt.Sprintf("EOTF(%d)", uint8(eotf))
+	}
+}
+
+// HDRChromaticity is a CIE 1931 xy color coordinate in units of 0.00002.
+type HDRChromaticity struct {
+	X, Y uint16
+}
+
+func newHDRChromaticity(c Chromaticity) HDRChromaticity {
+	conv := func(v float64) uint16 {
+		return uint16(math.Round(math.Max(0, math.Min(1, v)) * 50000))
+	}
+	return HDRChromaticity{conv(c.X), conv(c.Y)}
+}
+
+// HDROutputMetadata is the HDMI static metadata type 1, as set in a
+// connector's HDR_OUTPUT_METADATA property.
+type HDROutputMetadata struct {
+	EOTF HDREOTF
+	// Red, green and blue primaries of the mastering display
+	DisplayPrimaries [3]HDRChromaticity
+	WhitePoint       HDRChromaticity
+	// Mastering display luminance range, the maximum is in units of 1 cd/m²
+	// and the minimum in units of 0.0001 cd/m²
+	MaxDisplayMasteringLuminance uint16
+	MinDisplayMasteringLuminance uint16
+	// Maximum content and frame-average light levels, in cd/m²
+	MaxCLL, MaxFALL uint16
+}
+
+const (
+	hdrStaticMetadataType1  = 0
+	hdrOutputMetadataSize   = 32
+	hdrMetadataInfoframeOff = 4
+)
+
+// ParseHDROutputMetadata decodes a HDR_OUTPUT_METADATA blob, a
+// struct hdr_output_metadata.
+func ParseHDROutputMetadata(b []byte) (*HDROutputMetadata, error) {
+	const blobName = "HDR_OUTPUT_METADATA"
+	if len(b) != hdrOutputMetadataSize {
+		return nil, &BlobError{blobName, "size", fmt.Sprintf("got %v bytes, want %v", len(b), hdrOutputMetadataSize)}
+	}
+	if t := nativeEndian.Uint32(b[0:4]); t != hdrStaticMetadataType1 {
+		return nil, &BlobError{blobName, "metadata_type", fmt.Sprintf("unsupported type %v", t)}
+	}
+
+	b = b[hdrMetadataInfoframeOff:]
+	if b[1] != hdrStaticMetadataType1 {
+		return nil, &BlobError{blobName, "hdmi_metadata_type1.metadata_type", fmt.Sprintf("unsupported type %v", b[1])}
+	}
+
+	u16 := func(off int) uint16 {
+		return nativeEndian.Uint16(b[off : off+2])
+	}
+	md := &HDROutputMetadata{EOTF: HDREOTF(b[0])}
+	for i := range md.DisplayPrimaries {
+		md.DisplayPrimaries[i] = HDRChromaticity{u16(2 + 4*i), u16(4 + 4*i)}
+	}
+	md.WhitePoint = HDRChromaticity{u16(14), u16(16)}
+	md.MaxDisplayMasteringLuminance = u16(18)
+	md.MinDisplayMasteringLuminance = u16(20)
+	md.MaxCLL = u16(22)
+	md.MaxFALL = u16(24)
+	return md, nil
+}
+
+// Bytes encodes the metadata into a HDR_OUTPUT_METADATA blob.
+func (md *HDROutputMetadata) Bytes() []byte {
+	b := make([]byte, hdrOutputMetadataSize)
+	nativeEndian.PutUint32(b[0:4], hdrStaticMetadataType1)
+
+	frame := b[hdrMetadataInfoframeOff:]
+	put := func(off int, v uint16) {
+		nativeEndian.PutUint16(frame[off:off+2], v)
+	}
+	frame[0] = byte(md.EOTF)
+	frame[1] = hdrStaticMetadataType1
+	for i, c := range md.DisplayPrimaries {
+		put(2+4*i, c.X)
+		put(4+4*i, c.Y)
+	}
+	put(14, md.WhitePoint.X)
+	put(16, md.WhitePoint.Y)
+	put(18, md.MaxDisplayMasteringLuminance)
+	put(20, md.MinDisplayMasteringLuminance)
+	put(22, md.MaxCLL)
+	put(24, md.MaxFALL)
+	return b
+}
+
+func newLuminance(v, unit float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(math.MaxUint16, v/unit))))
+}
+
+// NewHDROutputMetadata creates HDR metadata for an EOTF, with defaults
+// derived from the display's EDID: the mastering display primaries, white
+// point and luminance range are the display's, and MaxCLL and MaxFALL are set
+// to the display's maximum and maximum frame-average luminance.
+//
+// An error is returned if the EDID doesn't advertise support for the EOTF.
+func NewHDROutputMetadata(edid *EDID, eotf HDREOTF) (*HDROutputMetadata, error) {
+	hdr := edid.HDRStaticMetadata
+	if hdr == nil {
+		return nil, fmt.Errorf("drm: EDID has no HDR static metadata block")
+	}
+	if !hdr.StaticMetadataType1 {
+		return nil, fmt.Errorf("drm: display doesn't support static metadata type 1")
+	}
+	if !hdr.SupportsEOTF(eotf) {
+		return nil, fmt.Errorf("drm: display doesn't support EOTF %v", eotf)
+	}
+
+	c := &edid.Chromaticity
+	return &HDROutputMetadata{
+		EOTF: eotf,
+		DisplayPrimaries: [3]HDRChromaticity{
+			newHDRChromaticity(c.Red),
+			newHDRChromaticity(c.Green),
+			newHDRChromaticity(c.Blue),
+		},
+		WhitePoint:                   newHDRChromaticity(c.White),
+		MaxDisplayMasteringLuminance: newLuminance(hdr.MaxLuminance, 1),
+		MinDisplayMasteringLuminance: newLuminance(hdr.MinLuminance, 0.0001),
+		MaxCLL:                       newLuminance(hdr.MaxLuminance, 1),
+		MaxFALL:                      newLuminance(hdr.MaxFrameAvgLuminance, 1),
+	}, nil
+}
+
+// ModeSetConnectorHDROutputMetadata sets the connector's HDR_OUTPUT_METADATA
+// property with a legacy property update. A nil metadata resets the property.
+func (n *Node) ModeSetConnectorHDROutputMetadata(id ConnectorID, md *HDROutputMetadata) error {
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if md != nil {
+		b = md.Bytes()
+	}
+	return n.setBlobProperty(id, props, "HDR_OUTPUT_METADATA", b)
+}
@@ -0,0 +1,94 @@
+package drm_test
+
+import (
+	"math"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func edidChecksum(block []byte) {
+	var sum byte
+	for _, v := range block[:127] {
+		sum += v
+	}
+	block[127] = -sum
+}
+
+// newTestHDREDID builds an EDID with sRGB primaries and a CTA-861 extension
+// advertising SDR, PQ and HLG with 400 cd/m² peak luminance.
+func newTestHDREDID() []byte {
+	b := make([]byte, 256)
+	copy(b, []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00})
+	b[18], b[19] = 1, 4
+
+	// 10-bit chromaticity coordinates: red, green, blue, white
+	coords := []uint16{655, 338, 307, 614, 154, 61, 320, 337}
+	for i, v := range coords {
+		b[27+i] = byte(v >> 2)
+		b[25+i/4] |= byte(v&0x3) << uint(6-2*(i%4))
+	}
+	b[126] = 1
+	edidChecksum(b[:128])
+
+	ext := b[128:]
+	ext[0], ext[1] = 0x02, 3
+	block := []byte{7<<5 | 6, 6, 0x0D, 0x01, 96, 64, 16}
+	copy(ext[4:], block)
+	ext[2] = byte(4 + len(block))
+	edidChecksum(ext)
+	return b
+}
+
+func TestNewHDROutputMetadata(t *testing.T) {
+	edid, err := drm.ParseEDID(newTestHDREDID())
+	if err != nil {
+		t.Fatalf("ParseEDID() = %v", err)
+	}
+	hdr := edid.HDRStaticMetadata
+	if hdr == nil {
+		t.Fatalf("ParseEDID() didn't decode the HDR static metadata block")
+	}
+	if !hdr.SupportsEOTF(drm.HDREOTFST2084) || !hdr.SupportsEOTF(drm.HDREOTFHLG) || hdr.SupportsEOTF(drm.HDREOTFTraditionalHDR) {
+		t.Errorf("HDRStaticMetadata.EOTFs = %v, want SDR, ST2084 and HLG", hdr.EOTFs)
+	}
+	if hdr.MaxLuminance != 400 || hdr.MaxFrameAvgLuminance != 200 {
+		t.Errorf("HDRStaticMetadata = %+v, want 400 cd/m² max and 200 cd/m² average", hdr)
+	}
+
+	md, err := drm.NewHDROutputMetadata(edid, drm.HDREOTFST2084)
+	if err != nil {
+		t.Fatalf("NewHDROutputMetadata() = %v", err)
+	}
+	minLum := uint16(math.Round(400 * (16.0 / 255) * (16.0 / 255) / 100 / 0.0001))
+	want := drm.HDROutputMetadata{
+		EOTF: drm.HDREOTFST2084,
+		DisplayPrimaries: [3]drm.HDRChromaticity{
+			{31982, 16504}, {14990, 29980}, {7520, 2979},
+		},
+		WhitePoint:                   drm.HDRChromaticity{15625, 16455},
+		MaxDisplayMasteringLuminance: 400,
+		MinDisplayMasteringLuminance: minLum,
+		MaxCLL:                       400,
+		MaxFALL:                      200,
+	}
+	if *md != want {
+		t.Errorf("NewHDROutputMetadata() = %+v, want %+v", *md, want)
+	}
+
+	b := md.Bytes()
+	if len(b) != 32 {
+		t.Fatalf("HDROutputMetadata.Bytes() = %v bytes, want 32", len(b))
+	}
+	parsed, err := drm.ParseHDROutputMetadata(b)
+	if err != nil {
+		t.Fatalf("ParseHDROutputMetadata() = %v", err)
+	}
+	if *parsed != *md {
+		t.Errorf("ParseHDROutputMetadata() = %+v, want %+v", *parsed, *md)
+	}
+
+	if _, err := drm.NewHDROutputMetadata(edid, drm.HDREOTFTraditionalHDR); err == nil {
+		t.Errorf("NewHDROutputMetadata() succeeded with an unsupported EOTF")
+	}
+}
@@ -0,0 +1,349 @@
+package drm
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Image is a draw.Image over memory in a DRM format, e.g. a mapped dumb
+// buffer. Alpha is premultiplied, like in image.RGBA. Formats without an alpha
+// channel are always opaque.
+//
+// Supported formats are FormatXRGB8888, FormatARGB8888, FormatXBGR8888,
+// FormatRGB565, FormatXRGB2101010 and FormatRGB888.
+type Image struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*BytesPerPixel].
+	Pix []byte
+	// Stride is the Pix stride (in bytes) between vertically adjacent pixels,
+	// i.e. the pitch of the buffer.
+	Stride int
+	// Rect is the image's bounds.
+	Rect   image.Rectangle
+	Format Format
+}
+
+var _ draw.Image = (*Image)(nil)
+
+// imageBytesPerPixel returns the pixel size of a format supported by Image.
+func imageBytesPerPixel(format Format) (int, bool) {
+	switch format {
+	case FormatXRGB8888, FormatARGB8888, FormatXBGR8888, FormatXRGB2101010:
+		return 4, true
+	case FormatRGB888:
+		return 3, true
+	case FormatRGB565:
+		return 2, true
+	default:
+		return 0, false
+	}
+}
+
+// NewImage creates an image over a buffer containing height rows of pitch
+// bytes. The buffer isn't copied.
+func NewImage(b []byte, width, height, pitch int, format Format) (*Image, error) {
+	bpp, ok := imageBytesPerPixel(format)
+	if !ok {
+		return nil, fmt.Errorf("drm: unsupported image format %v", format)
+	}
+	if width < 0 || height < 0 || pitch < width*bpp {
+		return nil, fmt.Errorf("drm: invalid image size %vx%v with pitch %v", width, height, pitch)
+	}
+	if height > 0 && len(b) < (height-1)*pitch+width*bpp {
+		return nil, fmt.Errorf("drm: image buffer too small: got %v bytes", len(b))
+	}
+	return &Image{
+		Pix:    b,
+		Stride: pitch,
+		Rect:   image.Rect(0, 0, width, height),
+		Format: format,
+	}, nil
+}
+
+// MapDumbImage maps a dumb buffer and returns it as an image. The format must
+// match the buffer's BPP. The mapping must be released by passing the image's
+// Pix to Munmap.
+func (n *Node) MapDumbImage(buf *DumbBuffer, format Format) (*Image, error) {
+	bpp, ok := imageBytesPerPixel(format)
+	if !ok {
+		return nil, fmt.Errorf("drm: unsupported image format %v", format)
+	}
+	if uint32(bpp*8) != buf.BPP {
+		return nil, fmt.Errorf("drm: format %v doesn't match dumb buffer BPP %v", format, buf.BPP)
+	}
+
+	b, err := n.MapDumb(buf)
+	if err != nil {
+		return nil, err
+	}
+	img, err := NewImage(b, int(buf.Width), int(buf.Height), int(buf.Pitch), format)
+	if err != nil {
+		n.Munmap(b)
+		return nil, err
+	}
+	return img, nil
+}
+
+func (img *Image) bytesPerPixel() int {
+	bpp, _ := imageBytesPerPixel(img.Format)
+	return bpp
+}
+
+func (img *Image) ColorModel() color.Model {
+	if img.Format == FormatXRGB2101010 {
+		return color.RGBA64Model
+	}
+	return color.RGBAModel
+}
+
+func (img *Image) Bounds() image.Rectangle {
+	return img.Rect
+}
+
+// Opaque checks whether the image is fully opaque. Only FormatARGB8888 has an
+// alpha channel, its pixels aren't scanned.
+func (img *Image) Opaque() bool {
+	return img.Format != FormatARGB8888
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (img *Image) PixOffset(x, y int) int {
+	return (y-img.Rect.Min.Y)*img.Stride + (x-img.Rect.Min.X)*img.bytesPerPixel()
+}
+
+func (img *Image) At(x, y int) color.Color {
+	c := img.RGBA64At(x, y)
+	if img.Format == FormatXRGB2101010 {
+		return c
+	}
+	return color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+}
+
+func (img *Image) RGBA64At(x, y int) color.RGBA64 {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return color.RGBA64{}
+	}
+	return img.load(img.Pix[img.PixOffset(x, y):])
+}
+
+func (img *Image) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return
+	}
+	img.store(img.Pix[img.PixOffset(x, y):], color.RGBA64Model.Convert(c).(color.RGBA64))
+}
+
+func (img *Image) SetRGBA64(x, y int, c color.RGBA64) {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return
+	}
+	img.store(img.Pix[img.PixOffset(x, y):], c)
+}
+
+// SubImage returns an image representing the portion of the image visible
+// through r. The returned value shares pixels with the original image.
+func (img *Image) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(img.Rect)
+	if r.Empty() {
+		return &Image{Format: img.Format}
+	}
+	return &Image{
+		Pix:    img.Pix[img.PixOffset(r.Min.X, r.Min.Y):],
+		Stride: img.Stride,
+		Rect:   r,
+		Format: img.Format,
+	}
+}
+
+func expand8(v uint8) uint16 {
+	return uint16(v) * 0x101
+}
+
+// expand scales a value with the specified number of bits to 16 bits.
+func expand(v uint32, bits uint) uint16 {
+	return uint16(v * 0xFFFF / (1<<bits - 1))
+}
+
+// load decodes a pixel. DRM formats are little-endian.
+func (img *Image) load(p []byte) color.RGBA64 {
+	switch img.Format {
+	case FormatXRGB8888, FormatRGB888:
+		return color.RGBA64{expand8(p[2]), expand8(p[1]), expand8(p[0]), 0xFFFF}
+	case FormatARGB8888:
+		return color.RGBA64{expand8(p[2]), expand8(p[1]), expand8(p[0]), expand8(p[3])}
+	case FormatXBGR8888:
+		return color.RGBA64{expand8(p[0]), expand8(p[1]), expand8(p[2]), 0xFFFF}
+	case FormatRGB565:
+		v := uint32(p[0]) | uint32(p[1])<<8
+		return color.RGBA64{expand(v>>11, 5), expand((v>>5)&0x3F, 6), expand(v&0x1F, 5), 0xFFFF}
+	case FormatXRGB2101010:
+		v := uint32(p[0]) | uint32(p[1])<<8 | uint32(p[2])<<16 | uint32(p[3])<<24
+		return color.RGBA64{expand((v>>20)&0x3FF, 10), expand((v>>10)&0x3FF, 10), expand(v&0x3FF, 10), 0xFFFF}
+	default:
+		panic(fmt.Sprintf("drm: unsupported image format %v", img.Format))
+	}
+}
+
+// store encodes a pixel. Formats without an alpha channel drop it, which
+// composites premultiplied colors over black.
+func (img *Image) store(p []byte, c color.RGBA64) {
+	switch img.Format {
+	case FormatXRGB8888:
+		p[0], p[1], p[2], p[3] = uint8(c.B>>8), uint8(c.G>>8), uint8(c.R>>8), 0xFF
+	case FormatARGB8888:
+		p[0], p[1], p[2], p[3] = uint8(c.B>>8), uint8(c.G>>8), uint8(c.R>>8), uint8(c.A>>8)
+	case FormatXBGR8888:
+		p[0], p[1], p[2], p[3] = uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), 0xFF
+	case FormatRGB888:
+		p[0], p[1], p[2] = uint8(c.B>>8), uint8(c.G>>8), uint8(c.R>>8)
+	case FormatRGB565:
+		v := uint16(c.R>>11)<<11 | uint16(c.G>>10)<<5 | uint16(c.B>>11)
+		p[0], p[1] = uint8(v), uint8(v>>8)
+	case FormatXRGB2101010:
+		v := 0x3<<30 | uint32(c.R>>6)<<20 | uint32(c.G>>6)<<10 | uint32(c.B>>6)
+		p[0], p[1], p[2], p[3] = uint8(v), uint8(v>>8), uint8(v>>16), uint8(v>>24)
+	default:
+		panic(fmt.Sprintf("drm: unsupported image format %v", img.Format))
+	}
+}
+
+// Draw is like draw.Draw with the image as destination. It has fast paths for
+// *image.RGBA sources, and falls back to draw.Draw otherwise.
+//
+// draw.Draw and draw.DrawMask don't know about Image and always go through
+// its per-pixel methods: callers must call Draw and DrawMask directly to use
+// the fast paths.
+func (img *Image) Draw(r image.Rectangle, src image.Image, sp image.Point, op draw.Op) {
+	s, ok := src.(*image.RGBA)
+	if !ok {
+		draw.Draw(img, r, src, sp, op)
+		return
+	}
+
+	orig := r.Min
+	r = r.Intersect(img.Rect)
+	r = r.Intersect(s.Rect.Add(orig.Sub(sp)))
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(r.Min.Sub(orig))
+
+	w, bpp := r.Dx(), img.bytesPerPixel()
+	for y := 0; y < r.Dy(); y++ {
+		spix := s.Pix[s.PixOffset(sp.X, sp.Y+y):][:4*w]
+		dpix := img.Pix[img.PixOffset(r.Min.X, r.Min.Y+y):][:bpp*w]
+		if op == draw.Over {
+			drawRowOver(img, dpix, spix)
+		} else {
+			drawRowSrc(img, dpix, spix)
+		}
+	}
+}
+
+// DrawMask is like draw.DrawMask with the image as destination. It has a fast
+// path for *image.Uniform sources with an *image.Alpha mask, as used to draw
+// text, and falls back to Draw or draw.DrawMask otherwise.
+func (img *Image) DrawMask(r image.Rectangle, src image.Image, sp image.Point, mask image.Image, mp image.Point, op draw.Op) {
+	if mask == nil {
+		img.Draw(r, src, sp, op)
+		return
+	}
+	s, ok := src.(*image.Uniform)
+	m, mok := mask.(*image.Alpha)
+	if !ok || !mok {
+		draw.DrawMask(img, r, src, sp, mask, mp, op)
+		return
+	}
+
+	orig := r.Min
+	r = r.Intersect(img.Rect)
+	r = r.Intersect(m.Rect.Add(orig.Sub(mp)))
+	if r.Empty() {
+		return
+	}
+	mp = mp.Add(r.Min.Sub(orig))
+
+	sr, sg, sb, sa := s.RGBA()
+	w, bpp := r.Dx(), img.bytesPerPixel()
+	for y := 0; y < r.Dy(); y++ {
+		mpix := m.Pix[m.PixOffset(mp.X, mp.Y+y):][:w]
+		dpix := img.Pix[img.PixOffset(r.Min.X, r.Min.Y+y):][:bpp*w]
+		for i, ma := range mpix {
+			d := dpix[i*bpp:]
+			// Same arithmetic as draw.DrawMask
+			a := uint32(ma) * 0x101
+			if op == draw.Src {
+				img.store(d, color.RGBA64{
+					R: uint16(sr * a / 0xFFFF),
+					G: uint16(sg * a / 0xFFFF),
+					B: uint16(sb * a / 0xFFFF),
+					A: uint16(sa * a / 0xFFFF),
+				})
+				continue
+			}
+			if a == 0 {
+				continue
+			}
+			dc := img.load(d)
+			da := 0xFFFF - sa*a/0xFFFF
+			img.store(d, color.RGBA64{
+				R: uint16((uint32(dc.R)*da + sr*a) / 0xFFFF),
+				G: uint16((uint32(dc.G)*da + sg*a) / 0xFFFF),
+				B: uint16((uint32(dc.B)*da + sb*a) / 0xFFFF),
+				A: uint16((uint32(dc.A)*da + sa*a) / 0xFFFF),
+			})
+		}
+	}
+}
+
+func drawRowSrc(img *Image, dpix, spix []byte) {
+	switch img.Format {
+	case FormatXBGR8888:
+		// Same memory layout as image.RGBA, the alpha byte is ignored
+		copy(dpix, spix)
+	case FormatXRGB8888, FormatARGB8888:
+		for i := 0; i < len(spix); i += 4 {
+			d, s := dpix[i:i+4:i+4], spix[i:i+4:i+4]
+			d[0], d[1], d[2], d[3] = s[2], s[1], s[0], s[3]
+		}
+	case FormatRGB888:
+		for i, j := 0, 0; i < len(spix); i, j = i+4, j+3 {
+			d, s := dpix[j:j+3:j+3], spix[i:i+4:i+4]
+			d[0], d[1], d[2] = s[2], s[1], s[0]
+		}
+	default:
+		bpp := img.bytesPerPixel()
+		for i, j := 0, 0; i < len(spix); i, j = i+4, j+bpp {
+			s := spix[i : i+4 : i+4]
+			img.store(dpix[j:], color.RGBA64{expand8(s[0]), expand8(s[1]), expand8(s[2]), expand8(s[3])})
+		}
+	}
+}
+
+func drawRowOver(img *Image, dpix, spix []byte) {
+	bpp := img.bytesPerPixel()
+	for i, j := 0, 0; i < len(spix); i, j = i+4, j+bpp {
+		s := spix[i : i+4 : i+4]
+		sc := color.RGBA64{expand8(s[0]), expand8(s[1]), expand8(s[2]), expand8(s[3])}
+		switch s[3] {
+		case 0:
+			continue
+		case 0xFF:
+			img.store(dpix[j:], sc)
+			continue
+		}
+
+		// Porter-Duff over with premultiplied alpha
+		dc := img.load(dpix[j:])
+		a := uint32(0xFFFF - sc.A)
+		img.store(dpix[j:], color.RGBA64{
+			R: sc.R + uint16(uint32(dc.R)*a/0xFFFF),
+			G: sc.G + uint16(uint32(dc.G)*a/0xFFFF),
+			B: sc.B + uint16(uint32(dc.B)*a/0xFFFF),
+			A: sc.A + uint16(uint32(dc.A)*a/0xFFFF),
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package drm_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func TestImage(t *testing.T) {
+	const width, height, pitch = 5, 3, 32
+
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			src.SetRGBA(x, y, color.RGBA{uint8(x * 60), uint8(y * 120), 0xFF, 0xFF})
+		}
+	}
+
+	formats := []struct {
+		format drm.Format
+		// Number of significant bits per channel
+		bits uint
+		// Memory representation of pure red
+		red []byte
+	}{
+		{drm.FormatXRGB8888, 8, []byte{0x00, 0x00, 0xFF, 0xFF}},
+		{drm.FormatARGB8888, 8, []byte{0x00, 0x00, 0xFF, 0xFF}},
+		{drm.FormatXBGR8888, 8, []byte{0xFF, 0x00, 0x00, 0xFF}},
+		{drm.FormatRGB888, 8, []byte{0x00, 0x00, 0xFF}},
+		{drm.FormatRGB565, 5, []byte{0x00, 0xF8}},
+		{drm.FormatXRGB2101010, 8, []byte{0x00, 0x00, 0xF0, 0xFF}},
+	}
+	for _, tc := range formats {
+		b := make([]byte, pitch*height)
+		for i := range b {
+			b[i] = 0xAA
+		}
+		img, err := drm.NewImage(b, width, height, pitch, tc.format)
+		if err != nil {
+			t.Fatalf("NewImage(%v) = %v", tc.format, err)
+		}
+
+		img.Draw(img.Bounds(), src, image.Point{}, draw.Src)
+
+		// Compare with the generic draw.Draw path
+		ref := make([]byte, len(b))
+		copy(ref, b)
+		refImg, _ := drm.NewImage(ref, width, height, pitch, tc.format)
+		draw.Draw(refImg, refImg.Bounds(), src, image.Point{}, draw.Src)
+
+		tolerance := uint32(0xFFFF >> tc.bits)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				want := src.At(x, y)
+				if !colorsClose(img.At(x, y), want, tolerance) {
+					t.Errorf("%v: At(%v, %v) = %v, want %v", tc.format, x, y, img.At(x, y), want)
+				}
+				if img.At(x, y) != refImg.At(x, y) {
+					t.Errorf("%v: fast path At(%v, %v) = %v, generic path = %v", tc.format, x, y, img.At(x, y), refImg.At(x, y))
+				}
+			}
+			// The padding at the end of the row must be left untouched
+			if v := b[y*pitch+pitch-1]; v != 0xAA {
+				t.Errorf("%v: padding of row %v overwritten: %#x", tc.format, y, v)
+			}
+		}
+
+		img.Set(0, 0, color.RGBA{0xFF, 0, 0, 0xFF})
+		if got := b[:len(tc.red)]; string(got) != string(tc.red) {
+			t.Errorf("%v: red pixel = %x, want %x", tc.format, got, tc.red)
+		}
+	}
+}
+
+func TestImage_over(t *testing.T) {
+	img, err := drm.NewImage(make([]byte, 4), 1, 1, 4, drm.FormatXRGB8888)
+	if err != nil {
+		t.Fatalf("NewImage() = %v", err)
+	}
+	img.Set(0, 0, color.RGBA{0, 0, 0xFF, 0xFF})
+
+	src := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	src.SetRGBA(0, 0, color.RGBA{0x80, 0, 0, 0x80})
+	img.Draw(img.Bounds(), src, image.Point{}, draw.Over)
+
+	want := color.RGBA{0x80, 0, 0x7F, 0xFF}
+	if !colorsClose(img.At(0, 0), want, 0x101) {
+		t.Errorf("At(0, 0) = %v, want %v", img.At(0, 0), want)
+	}
+}
+
+func TestImage_drawMask(t *testing.T) {
+	const width, height, pitch = 6, 4, 32
+
+	mask := image.NewAlpha(image.Rect(0, 0, 4, 3))
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i * 23)
+	}
+	src := image.NewUniform(color.RGBA{0x80, 0x40, 0x20, 0xC0})
+
+	formats := []drm.Format{
+		drm.FormatXRGB8888,
+		drm.FormatARGB8888,
+		drm.FormatXBGR8888,
+		drm.FormatRGB888,
+		drm.FormatRGB565,
+		drm.FormatXRGB2101010,
+	}
+	for _, format := range formats {
+		for _, op := range []draw.Op{draw.Over, draw.Src} {
+			b := make([]byte, pitch*height)
+			for i := range b {
+				b[i] = uint8(i * 7)
+			}
+			ref := append([]byte(nil), b...)
+			img, err := drm.NewImage(b, width, height, pitch, format)
+			if err != nil {
+				t.Fatalf("NewImage(%v) = %v", format, err)
+			}
+			refImg, _ := drm.NewImage(ref, width, height, pitch, format)
+
+			// Clipped by the mask on the left and by the image on the right
+			r := image.Rect(3, 1, 8, 4)
+			mp := image.Pt(-1, 0)
+			img.DrawMask(r, src, image.Point{}, mask, mp, op)
+			draw.DrawMask(refImg, r, src, image.Point{}, mask, mp, op)
+
+			if string(b) != string(ref) {
+				t.Errorf("%v, op %v: fast path = %x, generic path = %x", format, op, b, ref)
+			}
+		}
+	}
+}
+
+func BenchmarkImage_DrawMask(b *testing.B) {
+	const width, height = 640, 480
+
+	img, err := drm.NewImage(make([]byte, width*height*4), width, height, width*4, drm.FormatXRGB8888)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mask := image.NewAlpha(img.Bounds())
+	for i := range mask.Pix {
+		mask.Pix[i] = uint8(i)
+	}
+	src := image.NewUniform(color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+
+	b.Run("Image.DrawMask", func(b *testing.B) {
+		b.SetBytes(width * height)
+		for i := 0; i < b.N; i++ {
+			img.DrawMask(img.Bounds(), src, image.Point{}, mask, image.Point{}, draw.Over)
+		}
+	})
+	b.Run("draw.DrawMask", func(b *testing.B) {
+		b.SetBytes(width * height)
+		for i := 0; i < b.N; i++ {
+			draw.DrawMask(img, img.Bounds(), src, image.Point{}, mask, image.Point{}, draw.Over)
+		}
+	})
+}
+
+func colorsClose(a, b color.Color, tolerance uint32) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	for _, d := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}, {a1, a2}} {
+		if d[0] > d[1]+tolerance || d[1] > d[0]+tolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package uapi
+
+const (
+	iocNRBits   = 8
+	iocTypeBits = 8
+
+	iocNRShift   = 0
+	iocTypeShift = iocNRShift + iocNRBits
+	iocSizeShift = iocTypeShift + iocTypeBits
+)
+
+const drmIoctlBase = 'd'
+
+// iocLayout describes how ioctl request numbers are encoded, which depends on
+// the architecture.
+type iocLayout struct {
+	sizeBits          uint
+	none, read, write uintptr
+}
+
+var (
+	// iocGeneric uses 2 direction bits and 14 size bits.
+	iocGeneric = iocLayout{sizeBits: 14, none: 0, write: 1, read: 2}
+	// iocDir3 uses 3 direction bits and 13 size bits, on the BSDs, MIPS and
+	// PowerPC.
+	iocDir3 = iocLayout{sizeBits: 13, none: 1, read: 2, write: 4}
+)
+
+func (l iocLayout) ioc(dir, typ, nr, size uintptr) uint32 {
+	if size >= 1<<l.sizeBits {
+		panic("uapi: ioctl argument too large")
+	}
+	dirShift := iocSizeShift + l.sizeBits
+	return uint32(dir<<dirShift | typ<<iocTypeShift | nr<<iocNRShift | size<<iocSizeShift)
+}
+
+func (l iocLayout) size(req uint32) int {
+	return int(req >> iocSizeShift & (1<<l.sizeBits - 1))
+}
+
+func iow(nr, size uintptr) uint32 {
+	return iocNative.ioc(iocNative.write, drmIoctlBase, nr, size)
+}
+
+func iowr(nr, size uintptr) uint32 {
+	return iocNative.ioc(iocNative.read|iocNative.write, drmIoctlBase, nr, size)
+}
+
+// IocSize returns the size of the argument of an ioctl request.
+func IocSize(req uint32) int {
+	return iocNative.size(req)
+}
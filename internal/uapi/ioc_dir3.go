@@ -0,0 +1,6 @@
+//go:build dragonfly || freebsd || netbsd || openbsd || (linux && mips) || (linux && mipsle) || (linux && mips64) || (linux && mips64le) || (linux && ppc64) || (linux && ppc64le)
+// +build dragonfly freebsd netbsd openbsd linux,mips linux,mipsle linux,mips64 linux,mips64le linux,ppc64 linux,ppc64le
+
+package uapi
+
+var iocNative = iocDir3
@@ -0,0 +1,99 @@
+package uapi
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+func TestIoc(t *testing.T) {
+	// Values from the kernel headers
+	tests := []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"generic _IO", iocGeneric.ioc(iocGeneric.none, 'd', 0x1E, 0), 0x0000641E},
+		{"generic _IOW", iocGeneric.ioc(iocGeneric.write, 'd', 0x0D, 16), 0x4010640D},
+		{"generic _IOWR", iocGeneric.ioc(iocGeneric.read|iocGeneric.write, 'd', 0xA1, 0x68), 0xC06864A1},
+		{"generic _IOWR 386", iocGeneric.ioc(iocGeneric.read|iocGeneric.write, 'd', 0x00, 0x24), 0xC0246400},
+		{"dir3 _IO", iocDir3.ioc(iocDir3.none, 'd', 0x1E, 0), 0x2000641E},
+		{"dir3 _IOW", iocDir3.ioc(iocDir3.write, 'd', 0x0D, 16), 0x8010640D},
+		{"dir3 _IOWR", iocDir3.ioc(iocDir3.read|iocDir3.write, 'd', 0xA1, 0x68), 0xC06864A1},
+	}
+	for _, tc := range tests {
+		if tc.got != tc.want {
+			t.Errorf("%v = 0x%X, want 0x%X", tc.name, tc.got, tc.want)
+		}
+	}
+
+	if size := iocGeneric.size(0xC06864A1); size != 0x68 {
+		t.Errorf("generic size = 0x%X, want 0x68", size)
+	}
+	if size := iocDir3.size(0x9FFF6400); size != 0x1FFF {
+		t.Errorf("dir3 size = 0x%X, want 0x1FFF", size)
+	}
+}
+
+func TestIoctlNumbers(t *testing.T) {
+	// Argument sizes from the kernel headers on 64-bit architectures. Native
+	// pointers and longs are 4 bytes on 32-bit architectures, and 64-bit
+	// integers are 4-byte aligned on 386.
+	tests := []struct {
+		name    string
+		got     uint32
+		write   bool // _IOW instead of _IOWR
+		nr      uintptr
+		size    uintptr
+		size32  uintptr
+		size386 uintptr
+	}{
+		{"VERSION", IoctlVersion, false, 0x00, 0x40, 0x24, 0},
+		{"GET_UNIQUE", IoctlGetUnique, false, 0x01, 0x10, 0x08, 0},
+		{"SET_VERSION", IoctlSetVersion, false, 0x07, 0x10, 0, 0},
+		{"GET_CAP", IoctlGetCap, false, 0x0C, 0x10, 0, 0},
+		{"SET_CLIENT_CAP", IoctlSetClientCap, true, 0x0D, 0x10, 0, 0},
+		{"WAIT_VBLANK", IoctlWaitVBlank, false, 0x3A, 0x18, 0x10, 0},
+		{"CRTC_GET_SEQUENCE", IoctlCRTCGetSequence, false, 0x3B, 0x18, 0, 0},
+		{"CRTC_QUEUE_SEQUENCE", IoctlCRTCQueueSequence, false, 0x3C, 0x18, 0, 0},
+		{"MODE_GETRESOURCES", IoctlModeGetResources, false, 0xA0, 0x40, 0, 0},
+		{"MODE_GETCRTC", IoctlModeGetCRTC, false, 0xA1, 0x68, 0, 0},
+		{"MODE_SETCRTC", IoctlModeSetCRTC, false, 0xA2, 0x68, 0, 0},
+		{"MODE_GETGAMMA", IoctlModeGetGamma, false, 0xA4, 0x20, 0, 0},
+		{"MODE_SETGAMMA", IoctlModeSetGamma, false, 0xA5, 0x20, 0, 0},
+		{"MODE_GETENCODER", IoctlModeGetEncoder, false, 0xA6, 0x14, 0, 0},
+		{"MODE_GETCONNECTOR", IoctlModeGetConnector, false, 0xA7, 0x50, 0, 0},
+		{"MODE_GETPROPERTY", IoctlModeGetProperty, false, 0xAA, 0x40, 0, 0},
+		{"MODE_GETPROPBLOB", IoctlModeGetBlob, false, 0xAC, 0x10, 0, 0},
+		{"MODE_RMFB", IoctlModeRemoveFB, false, 0xAF, 0x04, 0, 0},
+		{"MODE_PAGE_FLIP", IoctlModePageFlip, false, 0xB0, 0x18, 0, 0},
+		{"MODE_CREATE_DUMB", IoctlModeCreateDumb, false, 0xB2, 0x20, 0, 0},
+		{"MODE_MAP_DUMB", IoctlModeMapDumb, false, 0xB3, 0x10, 0, 0},
+		{"MODE_DESTROY_DUMB", IoctlModeDestroyDumb, false, 0xB4, 0x04, 0, 0},
+		{"MODE_GETPLANERESOURCES", IoctlModeGetPlaneResources, false, 0xB5, 0x10, 0, 0x0C},
+		{"MODE_GETPLANE", IoctlModeGetPlane, false, 0xB6, 0x20, 0, 0},
+		{"MODE_SETPLANE", IoctlModeSetPlane, false, 0xB7, 0x30, 0, 0},
+		{"MODE_ADDFB2", IoctlModeAddFB2, false, 0xB8, 0x68, 0, 0x64},
+		{"MODE_OBJ_GETPROPERTIES", IoctlModeObjectGetProperties, false, 0xB9, 0x20, 0, 0x1C},
+		{"MODE_OBJ_SETPROPERTY", IoctlModeObjectSetProperty, false, 0xBA, 0x18, 0, 0x14},
+		{"MODE_ATOMIC", IoctlModeAtomic, false, 0xBC, 0x38, 0, 0},
+		{"MODE_CREATEPROPBLOB", IoctlModeCreateBlob, false, 0xBD, 0x10, 0, 0},
+		{"MODE_DESTROYPROPBLOB", IoctlModeDestroyBlob, false, 0xBE, 0x04, 0, 0},
+	}
+	for _, tc := range tests {
+		size := tc.size
+		switch {
+		case runtime.GOARCH == "386" && tc.size386 != 0:
+			size = tc.size386
+		case unsafe.Sizeof(uintptr(0)) == 4 && tc.size32 != 0:
+			size = tc.size32
+		}
+		dir := iocNative.read | iocNative.write
+		if tc.write {
+			dir = iocNative.write
+		}
+		if want := iocNative.ioc(dir, 'd', tc.nr, size); tc.got != want {
+			t.Errorf("%v = 0x%X, want 0x%X", tc.name, tc.got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !386
+// +build !386
+
+package uapi
+
+// 64-bit integers are 8-byte aligned in C, but Go aligns them to 4 bytes on
+// some 32-bit architectures: add the trailing padding explicitly.
+
+type ModePlaneResourcesResp struct {
+	Planes    Ptr
+	PlanesLen uint32
+	_         uint32
+}
+
+type ModeObjectGetPropertiesResp struct {
+	PropIDs    Ptr
+	PropValues Ptr
+	PropsLen   uint32
+
+	ID   uint32
+	Type uint32
+	_    uint32
+}
+
+type ModeObjectSetPropertyArg struct {
+	Value   uint64
+	PropID  uint32
+	ObjID   uint32
+	ObjType uint32
+	_       uint32
+}
+
+type ModeFBCmd2 struct {
+	FBID          uint32
+	Width, Height uint32
+	PixelFormat   uint32
+	Flags         uint32
+	Handles       [4]uint32
+	Pitches       [4]uint32
+	Offsets       [4]uint32
+	_             uint32
+	Modifiers     [4]uint64
+}
@@ -0,0 +1,301 @@
+//go:build linux || dragonfly || freebsd || netbsd || openbsd
+// +build linux dragonfly freebsd netbsd openbsd
+
+// Package uapi contains the kernel DRM ioctl interface: request numbers and
+// argument structures.
+package uapi
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	IoctlVersion      = iowr(0x00, unsafe.Sizeof(VersionResp{}))
+	IoctlGetUnique    = iowr(0x01, unsafe.Sizeof(UniqueResp{}))
+	IoctlSetVersion   = iowr(0x07, unsafe.Sizeof(SetVersionArg{}))
+	IoctlGetCap       = iowr(0x0C, unsafe.Sizeof(GetCapArg{}))
+	IoctlSetClientCap = iow(0x0D, unsafe.Sizeof(SetCapArg{}))
+
+	IoctlWaitVBlank        = iowr(0x3A, unsafe.Sizeof(WaitVBlankArg{}))
+	IoctlCRTCGetSequence   = iowr(0x3B, unsafe.Sizeof(CRTCGetSequenceArg{}))
+	IoctlCRTCQueueSequence = iowr(0x3C, unsafe.Sizeof(CRTCQueueSequenceArg{}))
+
+	IoctlModeGetResources        = iowr(0xA0, unsafe.Sizeof(ModeCardResp{}))
+	IoctlModeGetCRTC             = iowr(0xA1, unsafe.Sizeof(ModeCRTCResp{}))
+	IoctlModeSetCRTC             = iowr(0xA2, unsafe.Sizeof(ModeCRTCResp{}))
+	IoctlModeGetGamma            = iowr(0xA4, unsafe.Sizeof(ModeCRTCLUT{}))
+	IoctlModeSetGamma            = iowr(0xA5, unsafe.Sizeof(ModeCRTCLUT{}))
+	IoctlModeGetEncoder          = iowr(0xA6, unsafe.Sizeof(ModeEncoderResp{}))
+	IoctlModeGetConnector        = iowr(0xA7, unsafe.Sizeof(ModeConnectorResp{}))
+	IoctlModeGetProperty         = iowr(0xAA, unsafe.Sizeof(ModeGetPropertyResp{}))
+	IoctlModeGetBlob             = iowr(0xAC, unsafe.Sizeof(ModeGetBlobResp{}))
+	IoctlModeRemoveFB            = iowr(0xAF, unsafe.Sizeof(ModeRemoveFBArg{}))
+	IoctlModePageFlip            = iowr(0xB0, unsafe.Sizeof(ModeCRTCPageFlipArg{}))
+	IoctlModeCreateDumb          = iowr(0xB2, unsafe.Sizeof(ModeCreateDumbArg{}))
+	IoctlModeMapDumb             = iowr(0xB3, unsafe.Sizeof(ModeMapDumbArg{}))
+	IoctlModeDestroyDumb         = iowr(0xB4, unsafe.Sizeof(ModeDestroyDumbArg{}))
+	IoctlModeGetPlaneResources   = iowr(0xB5, unsafe.Sizeof(ModePlaneResourcesResp{}))
+	IoctlModeGetPlane            = iowr(0xB6, unsafe.Sizeof(ModePlaneResp{}))
+	IoctlModeSetPlane            = iowr(0xB7, unsafe.Sizeof(ModeSetPlaneArg{}))
+	IoctlModeAddFB2              = iowr(0xB8, unsafe.Sizeof(ModeFBCmd2{}))
+	IoctlModeObjectGetProperties = iowr(0xB9, unsafe.Sizeof(ModeObjectGetPropertiesResp{}))
+	IoctlModeObjectSetProperty   = iowr(0xBA, unsafe.Sizeof(ModeObjectSetPropertyArg{}))
+	IoctlModeAtomic              = iowr(0xBC, unsafe.Sizeof(ModeAtomicArg{}))
+	IoctlModeCreateBlob          = iowr(0xBD, unsafe.Sizeof(ModeCreateBlobArg{}))
+	IoctlModeDestroyBlob         = iowr(0xBE, unsafe.Sizeof(ModeDestroyBlobArg{}))
+)
+
+func Ioctl(fd uintptr, nr uint32, ptr unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(nr), uintptr(ptr))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Ptr is a user pointer stored in a __u64 field. The garbage collector
+// doesn't see it: the caller must keep the memory alive with runtime.KeepAlive
+// until the ioctl returns, unless it's used afterwards anyway.
+type Ptr uint64
+
+func NewPtr(p unsafe.Pointer) Ptr {
+	return Ptr(uintptr(p))
+}
+
+func (v Ptr) Pointer() unsafe.Pointer {
+	p := uintptr(v)
+	return *(*unsafe.Pointer)(unsafe.Pointer(&p))
+}
+
+// VersionResp uses native pointers and size_t, unlike the other structures
+// which use __u64 for pointers.
+type VersionResp struct {
+	Major, Minor, Patch int32
+	NameLen             uint
+	Name                *byte
+	DateLen             uint
+	Date                *byte
+	DescLen             uint
+	Desc                *byte
+}
+
+// UniqueResp uses a native pointer and size_t, like VersionResp.
+type UniqueResp struct {
+	UniqueLen uint
+	Unique    *byte
+}
+
+type SetVersionArg struct {
+	DIMajor, DIMinor int32
+	DDMajor, DDMinor int32
+}
+
+type GetCapArg struct {
+	Cap uint64
+	Ret uint64
+}
+
+type SetCapArg struct {
+	Cap uint64
+	Val uint64
+}
+
+// WaitVBlankArg is union drm_wait_vblank. Signal is also used as the reply's
+// tval_sec field.
+type WaitVBlankArg struct {
+	Type     uint32
+	Sequence uint32
+	Signal   uint
+	TvalUsec int
+}
+
+type CRTCGetSequenceArg struct {
+	CRTCID     uint32
+	Active     uint32
+	Sequence   uint64
+	SequenceNs int64
+}
+
+type CRTCQueueSequenceArg struct {
+	CRTCID   uint32
+	Flags    uint32
+	Sequence uint64
+	UserData uint64
+}
+
+type ModeCardResp struct {
+	FBs, CRTCs, Connectors, Encoders             Ptr
+	FBsLen, CRTCsLen, ConnectorsLen, EncodersLen uint32
+	MinWidth, MaxWidth, MinHeight, MaxHeight     uint32
+}
+
+type ModeModeInfo struct {
+	Clock                                         uint32
+	HDisplay, HSyncStart, HSyncEnd, HTotal, HSkew uint16
+	VDisplay, VSyncStart, VSyncEnd, VTotal, VScan uint16
+
+	VRefresh uint32
+
+	Flags uint32
+	Type  uint32
+	Name  [32]byte
+}
+
+type ModeCRTCResp struct {
+	// For IoctlModeSetCRTC
+	SetConnectors    Ptr
+	SetConnectorsLen uint32
+
+	ID uint32
+	FB uint32
+
+	X, Y uint32
+
+	GammaSize uint32
+	ModeValid uint32
+	Mode      ModeModeInfo
+}
+
+type ModeCRTCLUT struct {
+	CRTCID    uint32
+	GammaSize uint32
+
+	Red, Green, Blue Ptr
+}
+
+type ModeEncoderResp struct {
+	ID   uint32
+	Type uint32
+
+	CRTC uint32
+
+	PossibleCRTCs, PossibleClones uint32
+}
+
+type ModeConnectorResp struct {
+	Encoders   Ptr
+	Modes      Ptr
+	PropIDs    Ptr
+	PropValues Ptr
+
+	ModesLen    uint32
+	PropsLen    uint32
+	EncodersLen uint32
+
+	Encoder uint32
+	ID      uint32
+	Type    uint32
+	TypeID  uint32
+
+	Status              uint32
+	PhyWidth, PhyHeight uint32
+	Subpixel            uint32
+
+	_ uint32
+}
+
+type ModePlaneResp struct {
+	ID uint32
+
+	CRTC uint32
+	FB   uint32
+
+	PossibleCRTCs uint32
+	GammaSize     uint32
+
+	FormatsLen uint32
+	Formats    Ptr
+}
+
+type ModeSetPlaneArg struct {
+	PlaneID uint32
+	CRTCID  uint32
+	FBID    uint32
+	Flags   uint32
+
+	CRTCX, CRTCY int32
+	CRTCW, CRTCH uint32
+
+	// Source values are 16.16 fixed point, the height comes before the
+	// width
+	SrcX, SrcY uint32
+	SrcH, SrcW uint32
+}
+
+type ModePropertyEnum struct {
+	Value uint64
+	Name  [32]byte
+}
+
+type ModeGetPropertyResp struct {
+	Values    Ptr // values and blob lengths
+	EnumBlobs Ptr // enum items and blob IDs
+
+	ID    uint32
+	Flags uint32
+	Name  [32]byte
+
+	ValuesLen, EnumBlobsLen uint32
+}
+
+type ModeGetBlobResp struct {
+	ID   uint32
+	Size uint32
+	Data Ptr
+}
+
+type ModeCreateBlobArg struct {
+	Data   Ptr
+	Length uint32
+	BlobID uint32
+}
+
+type ModeDestroyBlobArg struct {
+	BlobID uint32
+}
+
+// ModeRemoveFBArg is a plain unsigned int in the kernel.
+type ModeRemoveFBArg struct {
+	FBID uint32
+}
+
+// ModeCRTCPageFlipArg is struct drm_mode_crtc_page_flip_target. Sequence is
+// reserved unless a target flag is set.
+type ModeCRTCPageFlipArg struct {
+	CRTCID   uint32
+	FBID     uint32
+	Flags    uint32
+	Sequence uint32
+	UserData uint64
+}
+
+type ModeCreateDumbArg struct {
+	Height, Width uint32
+	BPP           uint32
+	Flags         uint32
+	Handle        uint32
+	Pitch         uint32
+	Size          uint64
+}
+
+type ModeMapDumbArg struct {
+	Handle uint32
+	_      uint32
+	Offset uint64
+}
+
+type ModeDestroyDumbArg struct {
+	Handle uint32
+}
+
+type ModeAtomicArg struct {
+	Flags      uint32
+	CountObjs  uint32
+	Objs       Ptr
+	CountProps Ptr
+	Props      Ptr
+	PropValues Ptr
+	Reserved   uint64
+	UserData   uint64
+}
@@ -1,223 +1,192 @@
-//+build linux dragonfly freebsd netbsd openbsd
-//+build amd64 arm64
-
 package drm
 
 import (
 	"syscall"
 	"unsafe"
-)
 
-const (
-	ioctlVersion      = 0xC0406400
-	ioctlGetCap       = 0xC010640C
-	ioctlSetClientCap = 0x4010640D
-
-	ioctlModeGetResources        = 0xC04064A0
-	ioctlModeGetCRTC             = 0xC06864A1
-	ioctlModeGetEncoder          = 0xC01464A6
-	ioctlModeGetConnector        = 0xC05064A7
-	ioctlModeGetPlaneResources   = 0xC01064B5
-	ioctlModeGetPlane            = 0xC02064B6
-	ioctlModeObjectGetProperties = 0xC02064B9
-	ioctlModeGetProperty         = 0xC04064AA
-	ioctlModeGetBlob             = 0xC01064AC
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
 )
 
-func ioctl(fd uintptr, nr int, ptr unsafe.Pointer) error {
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(nr), uintptr(ptr))
-	if errno != 0 {
-		return errno
-	}
-	return nil
+// Backend performs ioctls on behalf of a Node. The argument points to the
+// kernel's structure for the request.
+//
+// The default backend issues the ioctls on a file descriptor. Other backends
+// can be used to fake a DRM device, see the drmtest package. Backends
+// delivering events also implement io.Reader, and backends supporting memory
+// mappings implement Mapper.
+//
+// Request numbers and argument structures are internal to this module, so
+// only in-module fakes such as drmtest can decode requests. External
+// implementations can only forward calls to another backend, e.g. to count,
+// delay or fail them in tests.
+type Backend interface {
+	Ioctl(req uint32, arg unsafe.Pointer) error
 }
 
-func allocBytes(ptr **byte, len uint64) []byte {
-	b := make([]byte, len)
-	*ptr = (*byte)(unsafe.Pointer(&b[0]))
-	return b
+// Mapper maps buffer memory, at an offset returned by the kernel for the
+// buffer.
+type Mapper interface {
+	Mmap(offset int64, length int) ([]byte, error)
+	Munmap(b []byte) error
 }
 
-type versionResp struct {
-	major, minor, patch int32
-	nameLen             uint64
-	name                *byte
-	dateLen             uint64
-	date                *byte
-	descLen             uint64
-	desc                *byte
-}
+type fdBackend uintptr
 
-func version(fd uintptr, v *versionResp) error {
-	return ioctl(fd, ioctlVersion, unsafe.Pointer(v))
+func (fd fdBackend) Ioctl(req uint32, arg unsafe.Pointer) error {
+	return uapi.Ioctl(uintptr(fd), req, arg)
 }
 
-type getCapArg struct {
-	cap uint64
-	ret uint64
+func (fd fdBackend) Read(b []byte) (int, error) {
+	n, err := syscall.Read(int(fd), b)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
 }
 
-func getCap(fd uintptr, cap uint64) (uint64, error) {
-	arg := getCapArg{cap: cap}
-	err := ioctl(fd, ioctlGetCap, unsafe.Pointer(&arg))
-	return arg.ret, err
+func (fd fdBackend) Mmap(offset int64, length int) ([]byte, error) {
+	return syscall.Mmap(int(fd), offset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
 }
 
-type setCapArg struct {
-	cap uint64
-	val uint64
+func (fd fdBackend) Munmap(b []byte) error {
+	return syscall.Munmap(b)
 }
 
-func setClientCap(fd uintptr, cap, val uint64) error {
-	arg := setCapArg{cap: cap, val: val}
-	return ioctl(fd, ioctlSetClientCap, unsafe.Pointer(&arg))
+// ioctl issues an ioctl, wrapping errors into an *Error. obj is the object
+// the ioctl operates on, if any.
+func ioctl(b Backend, req uint32, obj ObjectID, arg unsafe.Pointer) error {
+	return newError(req, obj, b.Ioctl(req, arg))
 }
 
-type modeCardResp struct {
-	fbs, crtcs, connectors, encoders             *uint32
-	fbsLen, crtcsLen, connectorsLen, encodersLen uint32
-	minWidth, maxWidth, minHeight, maxHeight     uint32
+func allocBytes(ptr **byte, len uint) []byte {
+	b := make([]byte, len)
+	*ptr = (*byte)(unsafe.Pointer(&b[0]))
+	return b
 }
 
-func modeGetResources(fd uintptr, r *modeCardResp) error {
-	return ioctl(fd, ioctlModeGetResources, unsafe.Pointer(r))
+func version(b Backend, v *uapi.VersionResp) error {
+	return ioctl(b, uapi.IoctlVersion, 0, unsafe.Pointer(v))
 }
 
-type modeModeInfo struct {
-	clock                                         uint32
-	hDisplay, hSyncStart, hSyncEnd, hTotal, hSkew uint16
-	vDisplay, vSyncStart, vSyncEnd, vTotal, vScan uint16
-
-	vRefresh uint32
-
-	flags uint32
-	typ   uint32
-	name  [32]byte
+func getUnique(b Backend, r *uapi.UniqueResp) error {
+	return ioctl(b, uapi.IoctlGetUnique, 0, unsafe.Pointer(r))
 }
 
-type modeCRTCResp struct {
-	// For ioctlModeSetCRTC
-	setConnectors    *uint32
-	setConnectorsLen uint32
-
-	id uint32
-	fb uint32
-
-	x, y uint32
-
-	gammaSize uint32
-	modeValid uint32
-	mode      modeModeInfo
+func setVersion(b Backend, r *uapi.SetVersionArg) error {
+	return ioctl(b, uapi.IoctlSetVersion, 0, unsafe.Pointer(r))
 }
 
-func modeGetCRTC(fd uintptr, r *modeCRTCResp) error {
-	return ioctl(fd, ioctlModeGetCRTC, unsafe.Pointer(r))
+func getCap(b Backend, cap uint64) (uint64, error) {
+	arg := uapi.GetCapArg{Cap: cap}
+	err := ioctl(b, uapi.IoctlGetCap, 0, unsafe.Pointer(&arg))
+	return arg.Ret, err
 }
 
-type modeEncoderResp struct {
-	id  uint32
-	typ uint32
+func setClientCap(b Backend, cap, val uint64) error {
+	arg := uapi.SetCapArg{Cap: cap, Val: val}
+	return ioctl(b, uapi.IoctlSetClientCap, 0, unsafe.Pointer(&arg))
+}
 
-	crtc uint32
+func waitVBlank(b Backend, r *uapi.WaitVBlankArg) error {
+	return ioctl(b, uapi.IoctlWaitVBlank, 0, unsafe.Pointer(r))
+}
 
-	possibleCRTCs, possibleClones uint32
+func crtcGetSequence(b Backend, r *uapi.CRTCGetSequenceArg) error {
+	return ioctl(b, uapi.IoctlCRTCGetSequence, ObjectID(r.CRTCID), unsafe.Pointer(r))
 }
 
-func modeGetEncoder(fd uintptr, r *modeEncoderResp) error {
-	return ioctl(fd, ioctlModeGetEncoder, unsafe.Pointer(r))
+func crtcQueueSequence(b Backend, r *uapi.CRTCQueueSequenceArg) error {
+	return ioctl(b, uapi.IoctlCRTCQueueSequence, ObjectID(r.CRTCID), unsafe.Pointer(r))
 }
 
-type modeConnectorResp struct {
-	encoders   *uint32
-	modes      *modeModeInfo
-	propIDs    *uint32
-	propValues *uint64
+func modeGetResources(b Backend, r *uapi.ModeCardResp) error {
+	return ioctl(b, uapi.IoctlModeGetResources, 0, unsafe.Pointer(r))
+}
 
-	modesLen    uint32
-	propsLen    uint32
-	encodersLen uint32
+func modeGetCRTC(b Backend, r *uapi.ModeCRTCResp) error {
+	return ioctl(b, uapi.IoctlModeGetCRTC, ObjectID(r.ID), unsafe.Pointer(r))
+}
 
-	encoder uint32
-	id      uint32
-	typ     uint32
-	typeID  uint32
+func modeSetCRTC(b Backend, r *uapi.ModeCRTCResp) error {
+	return ioctl(b, uapi.IoctlModeSetCRTC, ObjectID(r.ID), unsafe.Pointer(r))
+}
 
-	status              uint32
-	phyWidth, phyHeight uint32
-	subpixel            uint32
+func modeGetEncoder(b Backend, r *uapi.ModeEncoderResp) error {
+	return ioctl(b, uapi.IoctlModeGetEncoder, ObjectID(r.ID), unsafe.Pointer(r))
+}
 
-	_ uint32
+func modeGetConnector(b Backend, r *uapi.ModeConnectorResp) error {
+	return ioctl(b, uapi.IoctlModeGetConnector, ObjectID(r.ID), unsafe.Pointer(r))
 }
 
-func modeGetConnector(fd uintptr, r *modeConnectorResp) error {
-	return ioctl(fd, ioctlModeGetConnector, unsafe.Pointer(r))
+func modeGetPlaneResources(b Backend, r *uapi.ModePlaneResourcesResp) error {
+	return ioctl(b, uapi.IoctlModeGetPlaneResources, 0, unsafe.Pointer(r))
 }
 
-type modePlaneResourcesResp struct {
-	planes    *uint32
-	planesLen uint32
+func modeGetPlane(b Backend, r *uapi.ModePlaneResp) error {
+	return ioctl(b, uapi.IoctlModeGetPlane, ObjectID(r.ID), unsafe.Pointer(r))
 }
 
-func modeGetPlaneResources(fd uintptr, r *modePlaneResourcesResp) error {
-	return ioctl(fd, ioctlModeGetPlaneResources, unsafe.Pointer(r))
+func modeObjectGetProperties(b Backend, r *uapi.ModeObjectGetPropertiesResp) error {
+	return ioctl(b, uapi.IoctlModeObjectGetProperties, ObjectID(r.ID), unsafe.Pointer(r))
 }
 
-type modePlaneResp struct {
-	id uint32
+func modeGetProperty(b Backend, r *uapi.ModeGetPropertyResp) error {
+	return ioctl(b, uapi.IoctlModeGetProperty, ObjectID(r.ID), unsafe.Pointer(r))
+}
 
-	crtc uint32
-	fb   uint32
+func modeGetBlob(b Backend, r *uapi.ModeGetBlobResp) error {
+	return ioctl(b, uapi.IoctlModeGetBlob, ObjectID(r.ID), unsafe.Pointer(r))
+}
 
-	possibleCRTCs uint32
-	gammaSize     uint32
+func modeGetGamma(b Backend, r *uapi.ModeCRTCLUT) error {
+	return ioctl(b, uapi.IoctlModeGetGamma, ObjectID(r.CRTCID), unsafe.Pointer(r))
+}
 
-	formatsLen uint32
-	formats    *uint32
+func modeSetGamma(b Backend, r *uapi.ModeCRTCLUT) error {
+	return ioctl(b, uapi.IoctlModeSetGamma, ObjectID(r.CRTCID), unsafe.Pointer(r))
 }
 
-func modeGetPlane(fd uintptr, r *modePlaneResp) error {
-	return ioctl(fd, ioctlModeGetPlane, unsafe.Pointer(r))
+func modeObjectSetProperty(b Backend, r *uapi.ModeObjectSetPropertyArg) error {
+	return ioctl(b, uapi.IoctlModeObjectSetProperty, ObjectID(r.ObjID), unsafe.Pointer(r))
 }
 
-type modeObjectGetPropertiesResp struct {
-	propIDs    *uint32
-	propValues *uint64
-	propsLen   uint32
+func modeCreateBlob(b Backend, r *uapi.ModeCreateBlobArg) error {
+	return ioctl(b, uapi.IoctlModeCreateBlob, 0, unsafe.Pointer(r))
+}
 
-	id  uint32
-	typ uint32
+func modeDestroyBlob(b Backend, r *uapi.ModeDestroyBlobArg) error {
+	return ioctl(b, uapi.IoctlModeDestroyBlob, ObjectID(r.BlobID), unsafe.Pointer(r))
 }
 
-func modeObjectGetProperties(fd uintptr, r *modeObjectGetPropertiesResp) error {
-	return ioctl(fd, ioctlModeObjectGetProperties, unsafe.Pointer(r))
+func modeCreateDumb(b Backend, r *uapi.ModeCreateDumbArg) error {
+	return ioctl(b, uapi.IoctlModeCreateDumb, 0, unsafe.Pointer(r))
 }
 
-type modePropertyEnum struct {
-	value uint64
-	name  [32]byte
+func modeMapDumb(b Backend, r *uapi.ModeMapDumbArg) error {
+	return ioctl(b, uapi.IoctlModeMapDumb, 0, unsafe.Pointer(r))
 }
 
-type modeGetPropertyResp struct {
-	values    uintptr // values and blob lengths
-	enumBlobs uintptr // enum items and blob IDs
+func modeDestroyDumb(b Backend, r *uapi.ModeDestroyDumbArg) error {
+	return ioctl(b, uapi.IoctlModeDestroyDumb, 0, unsafe.Pointer(r))
+}
 
-	id    uint32
-	flags uint32
-	name  [32]byte
+func modeAddFB2(b Backend, r *uapi.ModeFBCmd2) error {
+	return ioctl(b, uapi.IoctlModeAddFB2, 0, unsafe.Pointer(r))
+}
 
-	valuesLen, enumBlobsLen uint32
+func modeRemoveFB(b Backend, r *uapi.ModeRemoveFBArg) error {
+	return ioctl(b, uapi.IoctlModeRemoveFB, ObjectID(r.FBID), unsafe.Pointer(r))
 }
 
-func modeGetProperty(fd uintptr, r *modeGetPropertyResp) error {
-	return ioctl(fd, ioctlModeGetProperty, unsafe.Pointer(r))
+func modePageFlip(b Backend, r *uapi.ModeCRTCPageFlipArg) error {
+	return ioctl(b, uapi.IoctlModePageFlip, ObjectID(r.CRTCID), unsafe.Pointer(r))
 }
 
-type modeGetBlobResp struct {
-	id   uint32
-	size uint32
-	data *byte
+func modeSetPlane(b Backend, r *uapi.ModeSetPlaneArg) error {
+	return ioctl(b, uapi.IoctlModeSetPlane, ObjectID(r.PlaneID), unsafe.Pointer(r))
 }
 
-func modeGetBlob(fd uintptr, r *modeGetBlobResp) error {
-	return ioctl(fd, ioctlModeGetBlob, unsafe.Pointer(r))
+func modeAtomic(b Backend, r *uapi.ModeAtomicArg) error {
+	return ioctl(b, uapi.IoctlModeAtomic, 0, unsafe.Pointer(r))
 }
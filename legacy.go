@@ -0,0 +1,88 @@
+package drm
+
+import (
+	"runtime"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+// ModeSetCRTC sets the mode of a CRTC, the connectors it drives and the
+// framebuffer scanned out by its primary plane, with a legacy, non-atomic
+// update. A nil mode disables the CRTC.
+func (n *Node) ModeSetCRTC(id CRTCID, fb FBID, x, y uint32, conns []ConnectorID, mode *ModeModeInfo) error {
+	r := uapi.ModeCRTCResp{
+		ID:               uint32(id),
+		FB:               uint32(fb),
+		X:                x,
+		Y:                y,
+		SetConnectorsLen: uint32(len(conns)),
+	}
+	if len(conns) > 0 {
+		r.SetConnectors = uapi.NewPtr(unsafe.Pointer(&conns[0]))
+	}
+	if mode != nil {
+		r.ModeValid = 1
+		r.Mode = mode.uapi()
+	}
+	err := modeSetCRTC(n.backend, &r)
+	runtime.KeepAlive(conns)
+	return err
+}
+
+type PageFlipFlags uint32
+
+const (
+	PageFlipEvent PageFlipFlags = 0x01
+	PageFlipAsync PageFlipFlags = 0x02
+	// Flip at an absolute or relative vblank sequence, requires
+	// CapPageFlipTarget
+	PageFlipTargetAbsolute PageFlipFlags = 0x04
+	PageFlipTargetRelative PageFlipFlags = 0x08
+)
+
+// ModePageFlip schedules a flip of the CRTC's primary plane to another
+// framebuffer with a legacy, non-atomic update. target is only used with the
+// PageFlipTarget flags. userData is passed back in the flip-complete event.
+func (n *Node) ModePageFlip(id CRTCID, fb FBID, flags PageFlipFlags, target uint32, userData uint64) error {
+	r := uapi.ModeCRTCPageFlipArg{
+		CRTCID:   uint32(id),
+		FBID:     uint32(fb),
+		Flags:    uint32(flags),
+		Sequence: target,
+		UserData: userData,
+	}
+	return modePageFlip(n.backend, &r)
+}
+
+// ModeSetPlane describes the configuration of a plane, as passed to
+// Node.ModeSetPlane. Source coordinates are 16.16 fixed point.
+type ModeSetPlane struct {
+	Plane PlaneID
+	CRTC  CRTCID
+	FB    FBID
+
+	CRTCX, CRTCY int32
+	CRTCW, CRTCH uint32
+
+	SrcX, SrcY, SrcW, SrcH uint32
+}
+
+// ModeSetPlane configures a plane with a legacy, non-atomic update. A zero FB
+// disables the plane.
+func (n *Node) ModeSetPlane(p *ModeSetPlane) error {
+	r := uapi.ModeSetPlaneArg{
+		PlaneID: uint32(p.Plane),
+		CRTCID:  uint32(p.CRTC),
+		FBID:    uint32(p.FB),
+		CRTCX:   p.CRTCX,
+		CRTCY:   p.CRTCY,
+		CRTCW:   p.CRTCW,
+		CRTCH:   p.CRTCH,
+		SrcX:    p.SrcX,
+		SrcY:    p.SrcY,
+		SrcW:    p.SrcW,
+		SrcH:    p.SrcH,
+	}
+	return modeSetPlane(n.backend, &r)
+}
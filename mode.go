@@ -0,0 +1,50 @@
+package drm
+
+// Mode types, as found in ModeModeInfo.Type.
+const (
+	ModeTypePreferred = 1 << 3
+	ModeTypeUserDef   = 1 << 5
+	ModeTypeDriver    = 1 << 6
+)
+
+// Mode flags, as found in ModeModeInfo.Flags.
+const (
+	ModeFlagPHSync    = 1 << 0
+	ModeFlagNHSync    = 1 << 1
+	ModeFlagPVSync    = 1 << 2
+	ModeFlagNVSync    = 1 << 3
+	ModeFlagInterlace = 1 << 4
+	ModeFlagDblScan   = 1 << 5
+	ModeFlagCSync     = 1 << 6
+	ModeFlagPCSync    = 1 << 7
+	ModeFlagNCSync    = 1 << 8
+	ModeFlagHSkew     = 1 << 9
+	ModeFlagDblClk    = 1 << 12
+	ModeFlagClkDiv2   = 1 << 13
+
+	// Stereo 3D layout, only set if the stereo 3D client cap is enabled
+	ModeFlag3DMask = 0x1F << 14
+	// Picture aspect ratio, only set if the aspect ratio client cap is
+	// enabled
+	ModeFlagPicAspectMask = 0x0F << 19
+)
+
+// RefreshRate computes the vertical refresh rate of the mode in Hz from its
+// timings. VRefresh is rounded to an integer, which isn't precise enough for
+// modes like 59.94 Hz.
+func (mode *ModeModeInfo) RefreshRate() float64 {
+	if mode.HTotal == 0 || mode.VTotal == 0 {
+		return 0
+	}
+	rate := float64(mode.Clock) * 1000 / (float64(mode.HTotal) * float64(mode.VTotal))
+	if mode.Flags&ModeFlagInterlace != 0 {
+		rate *= 2
+	}
+	if mode.Flags&ModeFlagDblScan != 0 {
+		rate /= 2
+	}
+	if mode.VScan > 1 {
+		rate /= float64(mode.VScan)
+	}
+	return rate
+}
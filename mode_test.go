@@ -0,0 +1,25 @@
+package drm_test
+
+import (
+	"math"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func TestModeModeInfo_RefreshRate(t *testing.T) {
+	tests := []struct {
+		mode drm.ModeModeInfo
+		want float64
+	}{
+		{drm.ModeModeInfo{Clock: 148500, HTotal: 2200, VTotal: 1125}, 60},
+		{drm.ModeModeInfo{Clock: 148352, HTotal: 2200, VTotal: 1125}, 59.94},
+		{drm.ModeModeInfo{Clock: 74250, HTotal: 2200, VTotal: 1125, Flags: drm.ModeFlagInterlace}, 60},
+		{drm.ModeModeInfo{}, 0},
+	}
+	for _, tc := range tests {
+		if got := tc.mode.RefreshRate(); math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("RefreshRate(%+v) = %v, want %v", tc.mode, got, tc.want)
+		}
+	}
+}
@@ -2,15 +2,68 @@ package drm
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
 	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
 )
 
 type Node struct {
-	fd uintptr
+	fd      uintptr
+	file    *os.File
+	backend Backend
 }
 
+var _ io.Closer = (*Node)(nil)
+
+// NewNode creates a node for a DRM device file descriptor. The caller retains
+// ownership of the file descriptor.
 func NewNode(fd uintptr) *Node {
-	return &Node{fd}
+	return &Node{fd: fd, backend: fdBackend(fd)}
+}
+
+// NewNodeWithBackend creates a node issuing ioctls through the provided
+// backend instead of a file descriptor.
+func NewNodeWithBackend(b Backend) *Node {
+	return &Node{fd: ^uintptr(0), backend: b}
+}
+
+// Open opens a DRM device file. The returned node must be closed by the
+// caller.
+func Open(path string) (*Node, error) {
+	// os.OpenFile sets O_CLOEXEC
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{fd: f.Fd(), file: f, backend: fdBackend(f.Fd())}, nil
+}
+
+// File returns the node's file. It's nil if the node hasn't been created with
+// Open.
+func (n *Node) File() *os.File {
+	return n.file
+}
+
+// Close closes the node. If the node has been created with Open, the file is
+// closed. If the node has been created with NewNodeWithBackend and the backend
+// implements io.Closer, the backend is closed. Otherwise, this is a no-op.
+func (n *Node) Close() error {
+	if n.file != nil {
+		return n.file.Close()
+	}
+	if c, ok := n.backend.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Type returns the type of the node, computed from the device minor number.
+func (n *Node) Type() (NodeType, error) {
+	return n.getType()
 }
 
 type Version struct {
@@ -19,23 +72,23 @@ type Version struct {
 }
 
 func (n *Node) Version() (*Version, error) {
-	var v versionResp
-	if err := version(n.fd, &v); err != nil {
+	var v uapi.VersionResp
+	if err := version(n.backend, &v); err != nil {
 		return nil, err
 	}
 
-	name := allocBytes(&v.name, v.nameLen)
-	date := allocBytes(&v.date, v.dateLen)
-	desc := allocBytes(&v.desc, v.descLen)
+	name := allocBytes(&v.Name, v.NameLen)
+	date := allocBytes(&v.Date, v.DateLen)
+	desc := allocBytes(&v.Desc, v.DescLen)
 
-	if err := version(n.fd, &v); err != nil {
+	if err := version(n.backend, &v); err != nil {
 		return nil, err
 	}
 
 	return &Version{
-		Major: v.major,
-		Minor: v.minor,
-		Patch: v.patch,
+		Major: v.Major,
+		Minor: v.Minor,
+		Patch: v.Patch,
 		Name:  string(name),
 		Date:  string(date),
 		Desc:  string(desc),
@@ -43,8 +96,10 @@ func (n *Node) Version() (*Version, error) {
 }
 
 type PCIDevice struct {
-	Vendor, Device       uint32
-	SubVendor, SubDevice uint32
+	Vendor    uint32 `json:"vendor"`
+	Device    uint32 `json:"device"`
+	SubVendor uint32 `json:"subsystem_vendor"`
+	SubDevice uint32 `json:"subsystem_device"`
 }
 
 func (d *PCIDevice) BusType() BusType {
@@ -68,11 +123,11 @@ func (n *Node) GetDevice() (Device, error) {
 }
 
 func (n *Node) GetCap(cap Cap) (uint64, error) {
-	return getCap(n.fd, uint64(cap))
+	return getCap(n.backend, uint64(cap))
 }
 
 func (n *Node) SetClientCap(cap ClientCap, val uint64) error {
-	return setClientCap(n.fd, uint64(cap), val)
+	return setClientCap(n.backend, uint64(cap), val)
 }
 
 type ModeCard struct {
@@ -85,8 +140,8 @@ type ModeCard struct {
 
 func (n *Node) ModeGetResources() (*ModeCard, error) {
 	for {
-		var r modeCardResp
-		if err := modeGetResources(n.fd, &r); err != nil {
+		var r uapi.ModeCardResp
+		if err := modeGetResources(n.backend, &r); err != nil {
 			return nil, err
 		}
 		count := r
@@ -95,28 +150,28 @@ func (n *Node) ModeGetResources() (*ModeCard, error) {
 		var crtcs []CRTCID
 		var connectors []ConnectorID
 		var encoders []EncoderID
-		if r.fbsLen > 0 {
-			fbs = make([]FBID, r.fbsLen)
-			r.fbs = (*uint32)(unsafe.Pointer(&fbs[0]))
+		if r.FBsLen > 0 {
+			fbs = make([]FBID, r.FBsLen)
+			r.FBs = uapi.NewPtr(unsafe.Pointer(&fbs[0]))
 		}
-		if r.crtcsLen > 0 {
-			crtcs = make([]CRTCID, r.crtcsLen)
-			r.crtcs = (*uint32)(unsafe.Pointer(&crtcs[0]))
+		if r.CRTCsLen > 0 {
+			crtcs = make([]CRTCID, r.CRTCsLen)
+			r.CRTCs = uapi.NewPtr(unsafe.Pointer(&crtcs[0]))
 		}
-		if r.connectorsLen > 0 {
-			connectors = make([]ConnectorID, r.connectorsLen)
-			r.connectors = (*uint32)(unsafe.Pointer(&connectors[0]))
+		if r.ConnectorsLen > 0 {
+			connectors = make([]ConnectorID, r.ConnectorsLen)
+			r.Connectors = uapi.NewPtr(unsafe.Pointer(&connectors[0]))
 		}
-		if r.encodersLen > 0 {
-			encoders = make([]EncoderID, r.encodersLen)
-			r.encoders = (*uint32)(unsafe.Pointer(&encoders[0]))
+		if r.EncodersLen > 0 {
+			encoders = make([]EncoderID, r.EncodersLen)
+			r.Encoders = uapi.NewPtr(unsafe.Pointer(&encoders[0]))
 		}
 
-		if err := modeGetResources(n.fd, &r); err != nil {
+		if err := modeGetResources(n.backend, &r); err != nil {
 			return nil, err
 		}
 
-		if r.fbsLen != count.fbsLen || r.crtcsLen != count.crtcsLen || r.connectorsLen != count.connectorsLen || r.encodersLen != count.encodersLen {
+		if r.FBsLen != count.FBsLen || r.CRTCsLen != count.CRTCsLen || r.ConnectorsLen != count.ConnectorsLen || r.EncodersLen != count.EncodersLen {
 			continue
 		}
 
@@ -125,10 +180,10 @@ func (n *Node) ModeGetResources() (*ModeCard, error) {
 			CRTCs:      crtcs,
 			Connectors: connectors,
 			Encoders:   encoders,
-			MinWidth:   r.minWidth,
-			MaxWidth:   r.maxWidth,
-			MinHeight:  r.minHeight,
-			MaxHeight:  r.maxHeight,
+			MinWidth:   r.MinWidth,
+			MaxWidth:   r.MaxWidth,
+			MinHeight:  r.MinHeight,
+			MaxHeight:  r.MaxHeight,
 		}, nil
 	}
 }
@@ -154,27 +209,48 @@ type ModeModeInfo struct {
 	Name  string
 }
 
-func newModeModeInfo(info *modeModeInfo) *ModeModeInfo {
+func newModeModeInfo(info *uapi.ModeModeInfo) *ModeModeInfo {
 	return &ModeModeInfo{
-		Clock:      info.clock,
-		HDisplay:   info.hDisplay,
-		HSyncStart: info.hSyncStart,
-		HSyncEnd:   info.hSyncEnd,
-		HTotal:     info.hTotal,
-		HSkew:      info.hSkew,
-		VDisplay:   info.vDisplay,
-		VSyncStart: info.vSyncStart,
-		VSyncEnd:   info.vSyncEnd,
-		VTotal:     info.vTotal,
-		VScan:      info.vScan,
-		VRefresh:   info.vRefresh,
-		Flags:      info.flags,
-		Type:       info.typ,
-		Name:       newString(info.name[:]),
+		Clock:      info.Clock,
+		HDisplay:   info.HDisplay,
+		HSyncStart: info.HSyncStart,
+		HSyncEnd:   info.HSyncEnd,
+		HTotal:     info.HTotal,
+		HSkew:      info.HSkew,
+		VDisplay:   info.VDisplay,
+		VSyncStart: info.VSyncStart,
+		VSyncEnd:   info.VSyncEnd,
+		VTotal:     info.VTotal,
+		VScan:      info.VScan,
+		VRefresh:   info.VRefresh,
+		Flags:      info.Flags,
+		Type:       info.Type,
+		Name:       newString(info.Name[:]),
+	}
+}
+
+func (mode *ModeModeInfo) uapi() uapi.ModeModeInfo {
+	info := uapi.ModeModeInfo{
+		Clock:      mode.Clock,
+		HDisplay:   mode.HDisplay,
+		HSyncStart: mode.HSyncStart,
+		HSyncEnd:   mode.HSyncEnd,
+		HTotal:     mode.HTotal,
+		HSkew:      mode.HSkew,
+		VDisplay:   mode.VDisplay,
+		VSyncStart: mode.VSyncStart,
+		VSyncEnd:   mode.VSyncEnd,
+		VTotal:     mode.VTotal,
+		VScan:      mode.VScan,
+		VRefresh:   mode.VRefresh,
+		Flags:      mode.Flags,
+		Type:       mode.Type,
 	}
+	copy(info.Name[:len(info.Name)-1], mode.Name)
+	return info
 }
 
-func newModeModeInfoList(infos []modeModeInfo) []ModeModeInfo {
+func newModeModeInfoList(infos []uapi.ModeModeInfo) []ModeModeInfo {
 	l := make([]ModeModeInfo, len(infos))
 	for i, info := range infos {
 		l[i] = *newModeModeInfo(&info)
@@ -191,22 +267,22 @@ type ModeCRTC struct {
 }
 
 func (n *Node) ModeGetCRTC(id CRTCID) (*ModeCRTC, error) {
-	r := modeCRTCResp{id: uint32(id)}
-	if err := modeGetCRTC(n.fd, &r); err != nil {
+	r := uapi.ModeCRTCResp{ID: uint32(id)}
+	if err := modeGetCRTC(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	var mode *ModeModeInfo
-	if r.modeValid != 0 {
-		mode = newModeModeInfo(&r.mode)
+	if r.ModeValid != 0 {
+		mode = newModeModeInfo(&r.Mode)
 	}
 
 	return &ModeCRTC{
-		ID:        CRTCID(r.id),
-		FB:        FBID(r.fb),
-		X:         r.x,
-		Y:         r.y,
-		GammaSize: r.gammaSize,
+		ID:        CRTCID(r.ID),
+		FB:        FBID(r.FB),
+		X:         r.X,
+		Y:         r.Y,
+		GammaSize: r.GammaSize,
 		Mode:      mode,
 	}, nil
 }
@@ -219,17 +295,17 @@ type ModeEncoder struct {
 }
 
 func (n *Node) ModeGetEncoder(id EncoderID) (*ModeEncoder, error) {
-	r := modeEncoderResp{id: uint32(id)}
-	if err := modeGetEncoder(n.fd, &r); err != nil {
+	r := uapi.ModeEncoderResp{ID: uint32(id)}
+	if err := modeGetEncoder(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	return &ModeEncoder{
-		ID:             EncoderID(r.id),
-		Type:           EncoderType(r.typ),
-		CRTC:           CRTCID(r.crtc),
-		PossibleCRTCs:  r.possibleCRTCs,
-		PossibleClones: r.possibleClones,
+		ID:             EncoderID(r.ID),
+		Type:           EncoderType(r.Type),
+		CRTC:           CRTCID(r.CRTC),
+		PossibleCRTCs:  r.PossibleCRTCs,
+		PossibleClones: r.PossibleClones,
 	}, nil
 }
 
@@ -240,74 +316,96 @@ type ModeConnector struct {
 	Encoder EncoderID
 	ID      ConnectorID
 	Type    ConnectorType
+	TypeID  uint32
 
 	Status              ConnectorStatus
 	PhyWidth, PhyHeight uint32 // mm
 	Subpixel            Subpixel
+
+	Properties map[PropertyID]uint64
+}
+
+// Name returns the connector name, as used by the kernel (e.g. "HDMI-A-1").
+func (conn *ModeConnector) Name() string {
+	return fmt.Sprintf("%s-%d", conn.Type.kernelName(), conn.TypeID)
 }
 
 func (n *Node) ModeGetConnector(id ConnectorID) (*ModeConnector, error) {
 	for {
-		r := modeConnectorResp{id: uint32(id)}
-		if err := modeGetConnector(n.fd, &r); err != nil {
+		r := uapi.ModeConnectorResp{ID: uint32(id)}
+		if err := modeGetConnector(n.backend, &r); err != nil {
 			return nil, err
 		}
 		count := r
 
 		var encoders []EncoderID
-		var modes []modeModeInfo
-		if r.modesLen > 0 {
-			modes = make([]modeModeInfo, r.modesLen)
-			r.modes = (*modeModeInfo)(unsafe.Pointer(&modes[0]))
+		var modes []uapi.ModeModeInfo
+		var propIDs []PropertyID
+		var propValues []uint64
+		if r.ModesLen > 0 {
+			modes = make([]uapi.ModeModeInfo, r.ModesLen)
+			r.Modes = uapi.NewPtr(unsafe.Pointer(&modes[0]))
 		}
-		if r.encodersLen > 0 {
-			encoders = make([]EncoderID, r.encodersLen)
-			r.encoders = (*uint32)(unsafe.Pointer(&encoders[0]))
+		if r.EncodersLen > 0 {
+			encoders = make([]EncoderID, r.EncodersLen)
+			r.Encoders = uapi.NewPtr(unsafe.Pointer(&encoders[0]))
 		}
 
-		r.propsLen = 0 // don't retrieve properties
+		if r.PropsLen > 0 {
+			propIDs = make([]PropertyID, r.PropsLen)
+			r.PropIDs = uapi.NewPtr(unsafe.Pointer(&propIDs[0]))
+			propValues = make([]uint64, r.PropsLen)
+			r.PropValues = uapi.NewPtr(unsafe.Pointer(&propValues[0]))
+		}
 
-		if err := modeGetConnector(n.fd, &r); err != nil {
+		if err := modeGetConnector(n.backend, &r); err != nil {
 			return nil, err
 		}
 
-		if r.modesLen != count.modesLen || r.encodersLen != count.encodersLen {
+		if r.ModesLen != count.ModesLen || r.EncodersLen != count.EncodersLen || r.PropsLen != count.PropsLen {
 			continue
 		}
 
+		props := make(map[PropertyID]uint64, r.PropsLen)
+		for i := 0; i < int(r.PropsLen); i++ {
+			props[propIDs[i]] = propValues[i]
+		}
+
 		return &ModeConnector{
 			PossibleEncoders: encoders,
 			Modes:            newModeModeInfoList(modes),
-			Encoder:          EncoderID(r.encoder),
-			ID:               ConnectorID(r.id),
-			Type:             ConnectorType(r.typ),
-			Status:           ConnectorStatus(r.status),
-			PhyWidth:         r.phyWidth,
-			PhyHeight:        r.phyHeight,
-			Subpixel:         Subpixel(r.subpixel),
+			Encoder:          EncoderID(r.Encoder),
+			ID:               ConnectorID(r.ID),
+			Type:             ConnectorType(r.Type),
+			TypeID:           r.TypeID,
+			Status:           ConnectorStatus(r.Status),
+			PhyWidth:         r.PhyWidth,
+			PhyHeight:        r.PhyHeight,
+			Subpixel:         Subpixel(r.Subpixel),
+			Properties:       props,
 		}, nil
 	}
 }
 
 func (n *Node) ModeGetPlaneResources() ([]PlaneID, error) {
 	for {
-		var r modePlaneResourcesResp
-		if err := modeGetPlaneResources(n.fd, &r); err != nil {
+		var r uapi.ModePlaneResourcesResp
+		if err := modeGetPlaneResources(n.backend, &r); err != nil {
 			return nil, err
 		}
 		count := r
 
 		var planes []PlaneID
-		if r.planesLen > 0 {
-			planes = make([]PlaneID, r.planesLen)
-			r.planes = (*uint32)(unsafe.Pointer(&planes[0]))
+		if r.PlanesLen > 0 {
+			planes = make([]PlaneID, r.PlanesLen)
+			r.Planes = uapi.NewPtr(unsafe.Pointer(&planes[0]))
 		}
 
-		if err := modeGetPlaneResources(n.fd, &r); err != nil {
+		if err := modeGetPlaneResources(n.backend, &r); err != nil {
 			return nil, err
 		}
 
-		if r.planesLen != count.planesLen {
+		if r.PlanesLen != count.PlanesLen {
 			continue
 		}
 
@@ -329,32 +427,32 @@ type ModePlane struct {
 
 func (n *Node) ModeGetPlane(id PlaneID) (*ModePlane, error) {
 	for {
-		r := modePlaneResp{id: uint32(id)}
-		if err := modeGetPlane(n.fd, &r); err != nil {
+		r := uapi.ModePlaneResp{ID: uint32(id)}
+		if err := modeGetPlane(n.backend, &r); err != nil {
 			return nil, err
 		}
 		count := r
 
 		var formats []Format
-		if r.formatsLen > 0 {
-			formats = make([]Format, r.formatsLen)
-			r.formats = (*uint32)(unsafe.Pointer(&formats[0]))
+		if r.FormatsLen > 0 {
+			formats = make([]Format, r.FormatsLen)
+			r.Formats = uapi.NewPtr(unsafe.Pointer(&formats[0]))
 		}
 
-		if err := modeGetPlane(n.fd, &r); err != nil {
+		if err := modeGetPlane(n.backend, &r); err != nil {
 			return nil, err
 		}
 
-		if r.formatsLen != count.formatsLen {
+		if r.FormatsLen != count.FormatsLen {
 			continue
 		}
 
 		return &ModePlane{
-			ID:            PlaneID(r.id),
-			CRTC:          CRTCID(r.crtc),
-			FB:            FBID(r.fb),
-			PossibleCRTCs: r.possibleCRTCs,
-			GammaSize:     r.gammaSize,
+			ID:            PlaneID(r.ID),
+			CRTC:          CRTCID(r.CRTC),
+			FB:            FBID(r.FB),
+			PossibleCRTCs: r.PossibleCRTCs,
+			GammaSize:     r.GammaSize,
 			Formats:       formats,
 		}, nil
 	}
@@ -362,34 +460,34 @@ func (n *Node) ModeGetPlane(id PlaneID) (*ModePlane, error) {
 
 func (n *Node) ModeObjectGetProperties(id AnyID) (map[PropertyID]uint64, error) {
 	for {
-		r := modeObjectGetPropertiesResp{
-			id:  uint32(id.Object()),
-			typ: uint32(id.Type()),
+		r := uapi.ModeObjectGetPropertiesResp{
+			ID:   uint32(id.Object()),
+			Type: uint32(id.Type()),
 		}
-		if err := modeObjectGetProperties(n.fd, &r); err != nil {
+		if err := modeObjectGetProperties(n.backend, &r); err != nil {
 			return nil, err
 		}
 		count := r
 
 		var propIDs []PropertyID
 		var propValues []uint64
-		if r.propsLen > 0 {
-			propIDs = make([]PropertyID, r.propsLen)
-			r.propIDs = (*uint32)(unsafe.Pointer(&propIDs[0]))
-			propValues = make([]uint64, r.propsLen)
-			r.propValues = (*uint64)(unsafe.Pointer(&propValues[0]))
+		if r.PropsLen > 0 {
+			propIDs = make([]PropertyID, r.PropsLen)
+			r.PropIDs = uapi.NewPtr(unsafe.Pointer(&propIDs[0]))
+			propValues = make([]uint64, r.PropsLen)
+			r.PropValues = uapi.NewPtr(unsafe.Pointer(&propValues[0]))
 		}
 
-		if err := modeObjectGetProperties(n.fd, &r); err != nil {
+		if err := modeObjectGetProperties(n.backend, &r); err != nil {
 			return nil, err
 		}
 
-		if r.propsLen != count.propsLen {
+		if r.PropsLen != count.PropsLen {
 			continue
 		}
 
-		m := make(map[PropertyID]uint64, r.propsLen)
-		for i := 0; i < int(r.propsLen); i++ {
+		m := make(map[PropertyID]uint64, r.PropsLen)
+		for i := 0; i < int(r.PropsLen); i++ {
 			m[propIDs[i]] = propValues[i]
 		}
 		return m, nil
@@ -397,50 +495,50 @@ func (n *Node) ModeObjectGetProperties(id AnyID) (map[PropertyID]uint64, error)
 }
 
 func (n *Node) ModeGetProperty(id PropertyID) (*ModeProperty, error) {
-	r := modeGetPropertyResp{id: uint32(id)}
-	if err := modeGetProperty(n.fd, &r); err != nil {
+	r := uapi.ModeGetPropertyResp{ID: uint32(id)}
+	if err := modeGetProperty(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	var values []uint64
-	if r.valuesLen > 0 {
-		values = make([]uint64, r.valuesLen)
-		r.values = (uintptr)(unsafe.Pointer(&values[0]))
+	if r.ValuesLen > 0 {
+		values = make([]uint64, r.ValuesLen)
+		r.Values = uapi.NewPtr(unsafe.Pointer(&values[0]))
 	}
 
-	var enums []modePropertyEnum
+	var enums []uapi.ModePropertyEnum
 	var blobSizes []uint32
 	var blobIDs []BlobID
-	switch t := newPropertyType(r.flags); t {
+	switch t := newPropertyType(r.Flags); t {
 	case PropertyEnum, PropertyBitmask:
-		if r.enumBlobsLen > 0 {
-			enums = make([]modePropertyEnum, r.enumBlobsLen)
-			r.enumBlobs = (uintptr)(unsafe.Pointer(&enums[0]))
+		if r.EnumBlobsLen > 0 {
+			enums = make([]uapi.ModePropertyEnum, r.EnumBlobsLen)
+			r.EnumBlobs = uapi.NewPtr(unsafe.Pointer(&enums[0]))
 		}
 	case PropertyBlob:
-		if r.valuesLen > 0 {
+		if r.ValuesLen > 0 {
 			panic("drm: modeGetPropertyResp.valuesLen > 0 for blob property")
 		}
-		if r.enumBlobsLen > 0 {
-			blobSizes = make([]uint32, r.enumBlobsLen)
-			r.values = (uintptr)(unsafe.Pointer(&blobSizes[0]))
-			blobIDs = make([]BlobID, r.enumBlobsLen)
-			r.enumBlobs = (uintptr)(unsafe.Pointer(&blobIDs[0]))
+		if r.EnumBlobsLen > 0 {
+			blobSizes = make([]uint32, r.EnumBlobsLen)
+			r.Values = uapi.NewPtr(unsafe.Pointer(&blobSizes[0]))
+			blobIDs = make([]BlobID, r.EnumBlobsLen)
+			r.EnumBlobs = uapi.NewPtr(unsafe.Pointer(&blobIDs[0]))
 		}
 	default:
-		if r.enumBlobsLen > 0 {
+		if r.EnumBlobsLen > 0 {
 			panic(fmt.Sprintf("drm: enumBlobsLen > 0 for %s property", t))
 		}
 	}
 
-	if err := modeGetProperty(n.fd, &r); err != nil {
+	if err := modeGetProperty(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	return &ModeProperty{
-		ID:     PropertyID(r.id),
-		Name:   newString(r.name[:]),
-		flags:  r.flags,
+		ID:     PropertyID(r.ID),
+		Name:   newString(r.Name[:]),
+		flags:  r.Flags,
 		values: values,
 		enums:  newModePropertyEnumList(enums),
 		blobs:  newModePropertyBlobList(blobIDs, blobSizes),
@@ -448,20 +546,87 @@ func (n *Node) ModeGetProperty(id PropertyID) (*ModeProperty, error) {
 }
 
 func (n *Node) ModeGetBlob(id BlobID) ([]byte, error) {
-	r := modeGetBlobResp{id: uint32(id)}
-	if err := modeGetBlob(n.fd, &r); err != nil {
+	r := uapi.ModeGetBlobResp{ID: uint32(id)}
+	if err := modeGetBlob(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	var data []byte
-	if r.size > 0 {
-		data = make([]byte, r.size)
-		r.data = (*byte)(unsafe.Pointer(&data[0]))
+	if r.Size > 0 {
+		data = make([]byte, r.Size)
+		r.Data = uapi.NewPtr(unsafe.Pointer(&data[0]))
 	}
 
-	if err := modeGetBlob(n.fd, &r); err != nil {
+	if err := modeGetBlob(n.backend, &r); err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
+
+// ModeObjectSetProperty sets an object's property with a legacy, non-atomic
+// update.
+func (n *Node) ModeObjectSetProperty(id AnyID, prop PropertyID, value uint64) error {
+	r := uapi.ModeObjectSetPropertyArg{
+		Value:   value,
+		PropID:  uint32(prop),
+		ObjID:   uint32(id.Object()),
+		ObjType: uint32(id.Type()),
+	}
+	return modeObjectSetProperty(n.backend, &r)
+}
+
+// ModeCreateBlob creates a property blob. It's destroyed when the node is
+// closed, or with ModeDestroyBlob.
+func (n *Node) ModeCreateBlob(data []byte) (BlobID, error) {
+	r := uapi.ModeCreateBlobArg{Length: uint32(len(data))}
+	if len(data) > 0 {
+		r.Data = uapi.NewPtr(unsafe.Pointer(&data[0]))
+	}
+	err := modeCreateBlob(n.backend, &r)
+	runtime.KeepAlive(data)
+	if err != nil {
+		return 0, err
+	}
+	return BlobID(r.BlobID), nil
+}
+
+// ModeDestroyBlob destroys a property blob. Properties referencing it keep it
+// alive.
+func (n *Node) ModeDestroyBlob(id BlobID) error {
+	r := uapi.ModeDestroyBlobArg{BlobID: uint32(id)}
+	return modeDestroyBlob(n.backend, &r)
+}
+
+type modeObjectProperty struct {
+	*ModeProperty
+	Value uint64
+}
+
+func (n *Node) modeObjectGetPropertiesByName(id AnyID) (map[string]modeObjectProperty, error) {
+	values, err := n.ModeObjectGetProperties(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]modeObjectProperty, len(values))
+	for _, propID := range sortedPropertyIDs(values) {
+		prop, err := n.ModeGetProperty(propID)
+		if err != nil {
+			return nil, err
+		}
+		m[prop.Name] = modeObjectProperty{prop, values[propID]}
+	}
+	return m, nil
+}
+
+// sortedPropertyIDs returns the property IDs in a stable order, so that the
+// sequence of ioctls doesn't depend on map iteration order.
+func sortedPropertyIDs(values map[PropertyID]uint64) []PropertyID {
+	ids := make([]PropertyID, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
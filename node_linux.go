@@ -2,10 +2,19 @@ package drm
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
-func (n *Node) getDevice() (Device, error) {
+func (n *Node) stat() (*syscall.Stat_t, error) {
+	if _, ok := n.backend.(fdBackend); !ok {
+		return nil, fmt.Errorf("drm: node isn't backed by a device file")
+	}
+
 	var stat syscall.Stat_t
 	if err := syscall.Fstat(int(n.fd), &stat); err != nil {
 		return nil, err
@@ -14,16 +23,163 @@ func (n *Node) getDevice() (Device, error) {
 	if !isDRM(&stat) {
 		return nil, fmt.Errorf("drm: not a DRM device")
 	}
+	return &stat, nil
+}
 
-	bus, err := getSubsystemType(stat.Rdev)
+func (n *Node) getType() (NodeType, error) {
+	stat, err := n.stat()
+	if err != nil {
+		return 0, err
+	}
+	return getMinorType(minor(uint64(stat.Rdev)))
+}
+
+func (n *Node) getDevice() (Device, error) {
+	stat, err := n.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	bus, err := getSubsystemType(uint64(stat.Rdev))
 	if err != nil {
 		return nil, err
 	}
 
 	switch bus {
 	case BusPCI:
-		return getPCIDevice(stat.Rdev)
+		return getPCIDevice(uint64(stat.Rdev))
 	default:
 		return &unknownDevice{bus}, nil
 	}
 }
+
+// nodePaths returns the paths matching a node pattern, sorted by minor
+// number.
+func nodePaths(pattern string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	num := func(path string) int {
+		i := len(path)
+		for i > 0 && path[i-1] >= '0' && path[i-1] <= '9' {
+			i--
+		}
+		n, _ := strconv.Atoi(path[i:])
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return num(paths[i]) < num(paths[j])
+	})
+	return paths, nil
+}
+
+func openFirst(pattern string, usable func(n *Node) bool) (*Node, error) {
+	paths, err := nodePaths(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		n, err := Open(path)
+		if err != nil {
+			continue
+		}
+		if usable(n) {
+			return n, nil
+		}
+		n.Close()
+	}
+
+	return nil, fmt.Errorf("drm: no usable node matching %v", pattern)
+}
+
+// OpenPrimary opens the first primary node supporting KMS.
+func OpenPrimary() (*Node, error) {
+	return openFirst(NodePatternPrimary, func(n *Node) bool {
+		_, err := n.ModeGetResources()
+		return err == nil
+	})
+}
+
+// OpenRender opens the first render node.
+func OpenRender() (*Node, error) {
+	return openFirst(NodePatternRender, func(n *Node) bool {
+		_, err := n.Version()
+		return err == nil
+	})
+}
+
+// devicePath returns the sysfs path of a node's parent device.
+func devicePath(dev uint64) (string, error) {
+	return filepath.EvalSymlinks(getPCIPath(dev))
+}
+
+func siblingNodePath(dev uint64, t NodeType, prefix string) (string, error) {
+	p, err := devicePath(dev)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(p + "/drm")
+	if err != nil {
+		return "", err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return filepath.Join(DirName, name), nil
+		}
+	}
+	return "", fmt.Errorf("drm: no %v node found for device %v", t, p)
+}
+
+func (n *Node) siblingNodePath(t NodeType, prefix string) (string, error) {
+	stat, err := n.stat()
+	if err != nil {
+		return "", err
+	}
+	return siblingNodePath(uint64(stat.Rdev), t, prefix)
+}
+
+// RenderNodePath returns the path to the render node of the node's device.
+func (n *Node) RenderNodePath() (string, error) {
+	return n.siblingNodePath(NodeRender, "renderD")
+}
+
+// PrimaryNodePath returns the path to the primary node of the node's device.
+func (n *Node) PrimaryNodePath() (string, error) {
+	return n.siblingNodePath(NodePrimary, "card")
+}
+
+func sameDevice(dev, other uint64) (bool, error) {
+	p, err := devicePath(dev)
+	if err != nil {
+		return false, err
+	}
+	otherPath, err := devicePath(other)
+	if err != nil {
+		return false, err
+	}
+	return p == otherPath, nil
+}
+
+// SameDevice checks whether two nodes belong to the same device.
+func (n *Node) SameDevice(other *Node) (bool, error) {
+	stat, err := n.stat()
+	if err != nil {
+		return false, err
+	}
+	otherStat, err := other.stat()
+	if err != nil {
+		return false, err
+	}
+	return sameDevice(uint64(stat.Rdev), uint64(otherStat.Rdev))
+}
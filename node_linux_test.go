@@ -0,0 +1,115 @@
+package drm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeDev(maj, min uint32) uint64 {
+	return uint64(maj)<<8 | uint64(min&0xff) | uint64(min&^0xff)<<12
+}
+
+// newFakeSysfs creates a sysfs tree with two devices: the first one has a
+// primary and a render node, the second one only has a primary node. The
+// returned function restores the real sysfs.
+func newFakeSysfs(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "drm-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := sysfsCharDir
+	sysfsCharDir = filepath.Join(dir, "char")
+	restore := func() {
+		sysfsCharDir = prev
+		os.RemoveAll(dir)
+	}
+
+	nodes := []struct {
+		device string
+		name   string
+		minor  uint32
+	}{
+		{"0000:00:02.0", "card0", 0},
+		{"0000:00:02.0", "renderD128", 128},
+		{"0000:01:00.0", "card1", 1},
+	}
+	for _, node := range nodes {
+		nodeDir := filepath.Join(dir, "devices", node.device, "drm", node.name)
+		charPath := filepath.Join(sysfsCharDir, fmt.Sprintf("%d:%d", drmMajor, node.minor))
+		err := os.MkdirAll(nodeDir, 0755)
+		if err == nil {
+			err = os.MkdirAll(sysfsCharDir, 0755)
+		}
+		if err == nil {
+			err = os.Symlink("../..", filepath.Join(nodeDir, "device"))
+		}
+		if err == nil {
+			err = os.Symlink(nodeDir, charPath)
+		}
+		if err != nil {
+			restore()
+			t.Fatal(err)
+		}
+	}
+	return restore
+}
+
+func TestSiblingNodePath(t *testing.T) {
+	defer newFakeSysfs(t)()
+
+	tests := []struct {
+		dev    uint64
+		t      NodeType
+		prefix string
+		want   string
+	}{
+		{makeDev(drmMajor, 0), NodeRender, "renderD", "/dev/dri/renderD128"},
+		{makeDev(drmMajor, 128), NodePrimary, "card", "/dev/dri/card0"},
+		{makeDev(drmMajor, 1), NodePrimary, "card", "/dev/dri/card1"},
+		{makeDev(drmMajor, 1), NodeRender, "renderD", ""},
+	}
+	for _, tc := range tests {
+		got, err := siblingNodePath(tc.dev, tc.t, tc.prefix)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("siblingNodePath(%v:%v, %v) = %q, want an error", major(tc.dev), minor(tc.dev), tc.t, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("siblingNodePath(%v:%v, %v) = %v", major(tc.dev), minor(tc.dev), tc.t, err)
+		} else if got != tc.want {
+			t.Errorf("siblingNodePath(%v:%v, %v) = %q, want %q", major(tc.dev), minor(tc.dev), tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestSameDevice(t *testing.T) {
+	defer newFakeSysfs(t)()
+
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{0, 128, true},
+		{128, 0, true},
+		{0, 0, true},
+		{0, 1, false},
+		{128, 1, false},
+	}
+	for _, tc := range tests {
+		got, err := sameDevice(makeDev(drmMajor, tc.a), makeDev(drmMajor, tc.b))
+		if err != nil {
+			t.Errorf("sameDevice(%v, %v) = %v", tc.a, tc.b, err)
+		} else if got != tc.want {
+			t.Errorf("sameDevice(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	if _, err := sameDevice(makeDev(drmMajor, 0), makeDev(drmMajor, 2)); err == nil {
+		t.Errorf("sameDevice() with a missing device succeeded")
+	}
+}
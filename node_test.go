@@ -1,6 +1,8 @@
 package drm_test
 
 import (
+	"testing"
+
 	"git.sr.ht/~emersion/go-drm"
 )
 
@@ -15,3 +17,10 @@ var (
 	_ drm.AnyID = drm.BlobID(0)
 	_ drm.AnyID = drm.PlaneID(0)
 )
+
+func TestModeConnector_Name(t *testing.T) {
+	conn := drm.ModeConnector{Type: drm.ConnectorHDMIA, TypeID: 1}
+	if name := conn.Name(); name != "HDMI-A-1" {
+		t.Errorf("Name() = %q, want %q", name, "HDMI-A-1")
+	}
+}
@@ -0,0 +1,170 @@
+package drm
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// Pattern is a test pattern, which can be drawn with FillPattern. Patterns are
+// computed in floating point, so that the full precision of 10-bit and
+// 16-bit formats is exercised.
+type Pattern interface {
+	// fillRow computes a row of RGB pixels of an image of the specified size.
+	fillRow(row []pixel, y, width, height int)
+}
+
+// SMPTEBars is the SMPTE color bars pattern, as generated by modetest.
+type SMPTEBars struct{}
+
+func rgb8(r, g, b uint8) pixel {
+	return pixel{float32(r) / 0xFF, float32(g) / 0xFF, float32(b) / 0xFF, 1}
+}
+
+var (
+	smpteTop = [...]pixel{
+		rgb8(192, 192, 192), // grey
+		rgb8(192, 192, 0),   // yellow
+		rgb8(0, 192, 192),   // cyan
+		rgb8(0, 192, 0),     // green
+		rgb8(192, 0, 192),   // magenta
+		rgb8(192, 0, 0),     // red
+		rgb8(0, 0, 192),     // blue
+	}
+	smpteMiddle = [...]pixel{
+		rgb8(0, 0, 192),     // blue
+		rgb8(19, 19, 19),    // black
+		rgb8(192, 0, 192),   // magenta
+		rgb8(19, 19, 19),    // black
+		rgb8(0, 192, 192),   // cyan
+		rgb8(19, 19, 19),    // black
+		rgb8(192, 192, 192), // grey
+	}
+	smpteBottom = [...]pixel{
+		rgb8(0, 33, 76),     // in-phase
+		rgb8(255, 255, 255), // super white
+		rgb8(50, 0, 106),    // quadrature
+		rgb8(19, 19, 19),    // black
+		rgb8(9, 9, 9),       // 3.5%
+		rgb8(19, 19, 19),    // 7.5%
+		rgb8(29, 29, 29),    // 11.5%
+		rgb8(19, 19, 19),    // black
+	}
+)
+
+func (SMPTEBars) fillRow(row []pixel, y, width, height int) {
+	switch {
+	case y < height*6/9:
+		for x := range row {
+			row[x] = smpteTop[x*7/width]
+		}
+	case y < height*7/9:
+		for x := range row {
+			row[x] = smpteMiddle[x*7/width]
+		}
+	default:
+		// Four wide bars, then three narrow PLUGE bars and black
+		wide, narrow := width*5/7, width/7
+		for x := range row {
+			switch {
+			case x < wide:
+				row[x] = smpteBottom[x*4/wide]
+			case x < wide+3*(narrow/3) && narrow >= 3:
+				row[x] = smpteBottom[4+(x-wide)/(narrow/3)]
+			default:
+				row[x] = smpteBottom[7]
+			}
+		}
+	}
+}
+
+// PlainColor fills the whole image with a single color.
+type PlainColor struct {
+	Color color.Color
+}
+
+func (p PlainColor) fillRow(row []pixel, y, width, height int) {
+	r, g, b, a := p.Color.RGBA()
+	px := pixel{float32(r) / 0xFFFF, float32(g) / 0xFFFF, float32(b) / 0xFFFF, float32(a) / 0xFFFF}
+	for x := range row {
+		row[x] = px
+	}
+}
+
+// Gradient draws four horizontal bands with red, green, blue and grey ramps
+// from black on the left to full intensity on the right. It reveals banding
+// and the effective depth of a pipeline.
+type Gradient struct{}
+
+func (Gradient) fillRow(row []pixel, y, width, height int) {
+	band := y * 4 / height
+	for x := range row {
+		v := float32(0)
+		if width > 1 {
+			v = float32(x) / float32(width-1)
+		}
+		px := pixel{0, 0, 0, 1}
+		if band == 3 {
+			px[0], px[1], px[2] = v, v, v
+		} else {
+			px[band] = v
+		}
+		row[x] = px
+	}
+}
+
+// Checkerboard draws black and white tiles, with a red vertical marker moving
+// horizontally by a quarter of a tile each frame. Tearing shows up as a break
+// in the marker.
+type Checkerboard struct {
+	// Size of the tiles in pixels, 32 if zero
+	TileSize int
+	// Frame number, which determines the marker position
+	Frame int
+}
+
+func (c Checkerboard) fillRow(row []pixel, y, width, height int) {
+	size := c.TileSize
+	if size <= 0 {
+		size = 32
+	}
+	step := size / 4
+	if step == 0 {
+		step = 1
+	}
+	marker := (c.Frame * step) % width
+	if marker < 0 {
+		marker += width
+	}
+
+	for x := range row {
+		switch {
+		case x >= marker && x < marker+size:
+			row[x] = pixel{1, 0, 0, 1}
+		case (x/size+y/size)%2 == 0:
+			row[x] = pixel{1, 1, 1, 1}
+		default:
+			row[x] = pixel{0, 0, 0, 1}
+		}
+	}
+}
+
+// FillPattern draws a test pattern into a pixel buffer. YUV formats use the
+// buffer's ColorEncoding and ColorRange.
+func FillPattern(buf *PixelBuffer, p Pattern) error {
+	info := buf.Format.Info()
+	if info == nil {
+		return fmt.Errorf("drm: unsupported format %v", buf.Format)
+	}
+	if buf.Width <= 0 || buf.Height <= 0 {
+		return fmt.Errorf("drm: invalid pixel buffer size %vx%v", buf.Width, buf.Height)
+	}
+	if err := buf.check(info); err != nil {
+		return err
+	}
+
+	w := newPixelWriter(buf, info)
+	w.write(false, 0, func(row []pixel, y int) {
+		p.fillRow(row, y, buf.Width, buf.Height)
+	})
+	return nil
+}
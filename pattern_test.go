@@ -0,0 +1,112 @@
+package drm_test
+
+import (
+	"image/color"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func fillPattern(t *testing.T, format drm.Format, width, height int, p drm.Pattern) *drm.PixelBuffer {
+	buf, err := drm.NewPixelBuffer(format, width, height)
+	if err != nil {
+		t.Fatalf("NewPixelBuffer() = %v", err)
+	}
+	if err := drm.FillPattern(buf, p); err != nil {
+		t.Fatalf("FillPattern() = %v", err)
+	}
+	return buf
+}
+
+// rgbAt returns the 0xRRGGBB value of an XRGB8888 pixel.
+func rgbAt(buf *drm.PixelBuffer, x, y int) uint32 {
+	b := buf.Planes[0][y*buf.Pitches[0]+4*x:]
+	return uint32(b[2])<<16 | uint32(b[1])<<8 | uint32(b[0])
+}
+
+func TestFillPattern_smpte(t *testing.T) {
+	const width, height = 140, 90
+	buf := fillPattern(t, drm.FormatXRGB8888, width, height, drm.SMPTEBars{})
+
+	want := []struct {
+		x, y int
+		rgb  uint32
+	}{
+		{0, 0, 0xC0C0C0},
+		{width / 7, 0, 0xC0C000},
+		{width - 1, 0, 0x0000C0},
+		{0, height * 6 / 9, 0x0000C0},
+		{width / 7, height * 6 / 9, 0x131313},
+		{0, height - 1, 0x00214C},
+		{width / 4, height - 1, 0xFFFFFF},
+		{width - 1, height - 1, 0x131313},
+	}
+	for _, w := range want {
+		if got := rgbAt(buf, w.x, w.y); got != w.rgb {
+			t.Errorf("pixel at (%v, %v) = %06X, want %06X", w.x, w.y, got, w.rgb)
+		}
+	}
+
+	// YUV buffers must round-trip to the same bars
+	nv12 := fillPattern(t, drm.FormatNV12, width, height, drm.SMPTEBars{})
+	back := convert(t, nv12, drm.FormatXRGB8888, 0, 0)
+	for _, w := range want {
+		got := rgbAt(back, w.x, w.y)
+		for shift := uint(0); shift < 24; shift += 8 {
+			d := int(got>>shift&0xFF) - int(w.rgb>>shift&0xFF)
+			if d < -3 || d > 3 {
+				t.Errorf("NV12 pixel at (%v, %v) = %06X, want %06X", w.x, w.y, got, w.rgb)
+				break
+			}
+		}
+	}
+}
+
+func TestFillPattern_gradient(t *testing.T) {
+	const width = 1024
+	buf := fillPattern(t, drm.FormatXRGB2101010, width, 4, drm.Gradient{})
+
+	// The red ramp must use the full 10-bit precision
+	seen := make(map[uint32]bool)
+	for x := 0; x < width; x++ {
+		b := buf.Planes[0][4*x:]
+		v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+		seen[(v>>20)&0x3FF] = true
+		if x == width-1 && (v>>20)&0x3FF != 0x3FF {
+			t.Errorf("last red value = %#x, want 0x3FF", (v>>20)&0x3FF)
+		}
+	}
+	if len(seen) != width {
+		t.Errorf("red ramp has %v distinct values, want %v", len(seen), width)
+	}
+}
+
+func TestFillPattern_checkerboard(t *testing.T) {
+	const width, height, size = 128, 64, 16
+
+	markerAt := func(frame int) int {
+		buf := fillPattern(t, drm.FormatXRGB8888, width, height, drm.Checkerboard{TileSize: size, Frame: frame})
+		for x := 0; x < width; x++ {
+			if rgbAt(buf, x, height-1) == 0xFF0000 {
+				return x
+			}
+		}
+		return -1
+	}
+	if x0, x1 := markerAt(0), markerAt(1); x0 != 0 || x1 != size/4 {
+		t.Errorf("marker positions = %v, %v, want 0, %v", x0, x1, size/4)
+	}
+
+	buf := fillPattern(t, drm.FormatXRGB8888, width, height, drm.Checkerboard{TileSize: size, Frame: 8})
+	if got := rgbAt(buf, 0, 0); got != 0xFFFFFF {
+		t.Errorf("pixel at (0, 0) = %06X, want white", got)
+	}
+	if got := rgbAt(buf, 0, size); got != 0x000000 {
+		t.Errorf("pixel at (0, %v) = %06X, want black", size, got)
+	}
+
+	plain := fillPattern(t, drm.FormatRGB565, 3, 3, drm.PlainColor{color.RGBA{0, 0xFF, 0, 0xFF}})
+	if got := plain.Planes[0][8:10]; got[0] != 0xE0 || got[1] != 0x07 {
+		t.Errorf("plain green = %x, want e007", got)
+	}
+}
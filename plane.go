@@ -0,0 +1,161 @@
+package drm
+
+import (
+	"fmt"
+)
+
+// ModePlaneInfo contains a plane and its capabilities, resolved from the
+// plane's properties.
+type ModePlaneInfo struct {
+	ModePlane
+
+	Type PlaneType
+
+	HasZPos          bool
+	ZPos             uint64
+	ZPosMin, ZPosMax uint64
+	ZPosImmutable    bool
+
+	Rotation           Rotation
+	SupportedRotations Rotation
+
+	HasAlpha bool
+
+	BlendModes     []BlendMode
+	ColorEncodings []ColorEncoding
+	ColorRanges    []ColorRange
+	ScalingFilters []ScalingFilter
+
+	// InFormats contains the supported format and modifier pairs. If the
+	// plane doesn't expose IN_FORMATS, formats use ModifierInvalid.
+	InFormats *FormatModifierSet
+}
+
+// ModeGetPlaneInfo retrieves a plane and its properties. It enables
+// ClientCapUniversalPlanes, since the plane type is only exposed with it.
+func (n *Node) ModeGetPlaneInfo(id PlaneID) (*ModePlaneInfo, error) {
+	if err := n.SetClientCap(ClientCapUniversalPlanes, 1); err != nil {
+		return nil, err
+	}
+
+	plane, err := n.ModeGetPlane(id)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := n.modeObjectGetPropertiesByName(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ModePlaneInfo{ModePlane: *plane}
+
+	if prop, ok := props["type"]; ok {
+		info.Type = PlaneType(prop.Value)
+	}
+
+	if prop, ok := props["zpos"]; ok {
+		info.HasZPos = true
+		info.ZPos = prop.Value
+		info.ZPosImmutable = prop.Immutable()
+		if low, high, ok := prop.Range(); ok {
+			info.ZPosMin, info.ZPosMax = low, high
+		}
+	}
+
+	if prop, ok := props["rotation"]; ok {
+		info.Rotation = Rotation(prop.Value)
+		enums, _ := prop.Enums()
+		for _, e := range enums {
+			info.SupportedRotations |= Rotation(1 << e.Value)
+		}
+	}
+
+	_, info.HasAlpha = props["alpha"]
+
+	if prop, ok := props["pixel blend mode"]; ok {
+		enums, _ := prop.Enums()
+		for _, e := range enums {
+			if m, ok := parseBlendMode(e.Name); ok {
+				info.BlendModes = append(info.BlendModes, m)
+			}
+		}
+	}
+	if prop, ok := props["COLOR_ENCODING"]; ok {
+		enums, _ := prop.Enums()
+		for _, e := range enums {
+			if enc, ok := parseColorEncoding(e.Name); ok {
+				info.ColorEncodings = append(info.ColorEncodings, enc)
+			}
+		}
+	}
+	if prop, ok := props["COLOR_RANGE"]; ok {
+		enums, _ := prop.Enums()
+		for _, e := range enums {
+			if r, ok := parseColorRange(e.Name); ok {
+				info.ColorRanges = append(info.ColorRanges, r)
+			}
+		}
+	}
+	if prop, ok := props["SCALING_FILTER"]; ok {
+		enums, _ := prop.Enums()
+		for _, e := range enums {
+			if f, ok := parseScalingFilter(e.Name); ok {
+				info.ScalingFilters = append(info.ScalingFilters, f)
+			}
+		}
+	}
+
+	if prop, ok := props["IN_FORMATS"]; ok && prop.Value != 0 {
+		b, err := n.ModeGetBlob(BlobID(prop.Value))
+		if err != nil {
+			return nil, err
+		}
+		info.InFormats, err = ParseFormatModifierSet(b)
+		if err != nil {
+			return nil, fmt.Errorf("drm: failed to parse IN_FORMATS of plane %v: %v", id, err)
+		}
+	} else {
+		info.InFormats = NewFormatModifierSet(map[Modifier][]Format{
+			ModifierInvalid: plane.Formats,
+		})
+	}
+
+	return info, nil
+}
+
+func parseBlendMode(name string) (BlendMode, bool) {
+	for _, m := range []BlendMode{BlendModeNone, BlendModePremultiplied, BlendModeCoverage} {
+		if m.String() == name {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func parseColorEncoding(name string) (ColorEncoding, bool) {
+	for _, enc := range []ColorEncoding{ColorEncodingBT601, ColorEncodingBT709, ColorEncodingBT2020} {
+		if enc.String() == name {
+			return enc, true
+		}
+	}
+	return 0, false
+}
+
+func parseColorRange(name string) (ColorRange, bool) {
+	for _, r := range []ColorRange{ColorRangeLimited, ColorRangeFull} {
+		if r.String() == name {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+func parseScalingFilter(name string) (ScalingFilter, bool) {
+	for _, f := range []ScalingFilter{ScalingFilterDefault, ScalingFilterNearestNeighbor} {
+		if f.String() == name {
+			return f, true
+		}
+	}
+	return 0, false
+}
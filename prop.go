@@ -1,5 +1,9 @@
 package drm
 
+import (
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
 const (
 	propertyPending   uint32 = 1 << 0 // deprecated
 	propertyImmutable uint32 = 1 << 2
@@ -51,14 +55,14 @@ type ModePropertyEnum struct {
 	Value uint64
 }
 
-func newModePropertyEnum(e modePropertyEnum) ModePropertyEnum {
+func newModePropertyEnum(e uapi.ModePropertyEnum) ModePropertyEnum {
 	return ModePropertyEnum{
-		Name:  newString(e.name[:]),
-		Value: e.value,
+		Name:  newString(e.Name[:]),
+		Value: e.Value,
 	}
 }
 
-func newModePropertyEnumList(enums []modePropertyEnum) []ModePropertyEnum {
+func newModePropertyEnumList(enums []uapi.ModePropertyEnum) []ModePropertyEnum {
 	l := make([]ModePropertyEnum, len(enums))
 	for i, e := range enums {
 		l[i] = newModePropertyEnum(e)
@@ -0,0 +1,171 @@
+package drm
+
+import (
+	"fmt"
+)
+
+// CRTCsFromMask converts a bitmask of CRTC indices, as found in
+// ModeEncoder.PossibleCRTCs and ModePlane.PossibleCRTCs, to a list of CRTC
+// IDs.
+func (card *ModeCard) CRTCsFromMask(mask uint32) []CRTCID {
+	var l []CRTCID
+	for i, id := range card.CRTCs {
+		if i < 32 && mask&(1<<uint(i)) != 0 {
+			l = append(l, id)
+		}
+	}
+	return l
+}
+
+// EncodersFromMask converts a bitmask of encoder indices, as found in
+// ModeEncoder.PossibleClones, to a list of encoder IDs.
+func (card *ModeCard) EncodersFromMask(mask uint32) []EncoderID {
+	var l []EncoderID
+	for i, id := range card.Encoders {
+		if i < 32 && mask&(1<<uint(i)) != 0 {
+			l = append(l, id)
+		}
+	}
+	return l
+}
+
+// Route describes which encoder and CRTC drive a connector.
+type Route struct {
+	Connector ConnectorID
+	Encoder   EncoderID
+	CRTC      CRTCID
+}
+
+type routeCandidate struct {
+	encoder   EncoderID
+	crtc      CRTCID
+	preserved bool
+}
+
+type routeSolver struct {
+	conns      []ConnectorID
+	candidates [][]routeCandidate
+
+	cur                   []*routeCandidate
+	usedEncoders          map[EncoderID]bool
+	usedCRTCs             map[CRTCID]bool
+	best                  []*routeCandidate
+	bestRouted, bestScore int
+}
+
+func (s *routeSolver) solve(i, routed, score int) {
+	if i == len(s.conns) {
+		if routed > s.bestRouted || (routed == s.bestRouted && score > s.bestScore) {
+			s.best = append(s.best[:0], s.cur...)
+			s.bestRouted, s.bestScore = routed, score
+		}
+		return
+	}
+	// Not enough connectors left to beat the best solution
+	if routed+len(s.conns)-i < s.bestRouted {
+		return
+	}
+
+	for j := range s.candidates[i] {
+		c := &s.candidates[i][j]
+		if s.usedEncoders[c.encoder] || s.usedCRTCs[c.crtc] {
+			continue
+		}
+		s.usedEncoders[c.encoder] = true
+		s.usedCRTCs[c.crtc] = true
+		s.cur[i] = c
+		inc := 0
+		if c.preserved {
+			inc = 1
+		}
+		s.solve(i+1, routed+1, score+inc)
+		s.cur[i] = nil
+		delete(s.usedEncoders, c.encoder)
+		delete(s.usedCRTCs, c.crtc)
+	}
+
+	s.solve(i+1, routed, score)
+}
+
+// SolveRoutes finds an encoder and CRTC for each connector, such that no
+// encoder or CRTC is used twice. Routes currently in use are preferred, to
+// avoid unnecessary modesets. The returned routes are in the same order as
+// conns.
+func SolveRoutes(card *ModeCard, encoders []*ModeEncoder, conns []*ModeConnector) ([]Route, error) {
+	encoderByID := make(map[EncoderID]*ModeEncoder, len(encoders))
+	for _, enc := range encoders {
+		encoderByID[enc.ID] = enc
+	}
+
+	s := routeSolver{
+		conns:        make([]ConnectorID, len(conns)),
+		candidates:   make([][]routeCandidate, len(conns)),
+		cur:          make([]*routeCandidate, len(conns)),
+		usedEncoders: make(map[EncoderID]bool),
+		usedCRTCs:    make(map[CRTCID]bool),
+		bestRouted:   -1,
+	}
+	for i, conn := range conns {
+		s.conns[i] = conn.ID
+		for _, encID := range conn.PossibleEncoders {
+			enc, ok := encoderByID[encID]
+			if !ok {
+				return nil, fmt.Errorf("drm: unknown encoder %v for connector %v", encID, conn.ID)
+			}
+			for _, crtc := range card.CRTCsFromMask(enc.PossibleCRTCs) {
+				c := routeCandidate{
+					encoder:   encID,
+					crtc:      crtc,
+					preserved: conn.Encoder == encID && enc.CRTC == crtc,
+				}
+				if c.preserved {
+					// Try the current route first
+					s.candidates[i] = append([]routeCandidate{c}, s.candidates[i]...)
+				} else {
+					s.candidates[i] = append(s.candidates[i], c)
+				}
+			}
+		}
+	}
+
+	s.solve(0, 0, 0)
+
+	routes := make([]Route, len(conns))
+	var unrouted []ConnectorID
+	for i, c := range s.best {
+		if c == nil {
+			unrouted = append(unrouted, s.conns[i])
+			continue
+		}
+		routes[i] = Route{Connector: s.conns[i], Encoder: c.encoder, CRTC: c.crtc}
+	}
+	if len(unrouted) > 0 {
+		return nil, fmt.Errorf("drm: no CRTC/encoder assignment for connectors %v", unrouted)
+	}
+	return routes, nil
+}
+
+// SolveRoutes fetches the current KMS state and finds a route for each of the
+// connectors. See SolveRoutes.
+func (n *Node) SolveRoutes(connIDs []ConnectorID) ([]Route, error) {
+	card, err := n.ModeGetResources()
+	if err != nil {
+		return nil, err
+	}
+
+	encoders := make([]*ModeEncoder, len(card.Encoders))
+	for i, id := range card.Encoders {
+		if encoders[i], err = n.ModeGetEncoder(id); err != nil {
+			return nil, err
+		}
+	}
+
+	conns := make([]*ModeConnector, len(connIDs))
+	for i, id := range connIDs {
+		if conns[i], err = n.ModeGetConnector(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return SolveRoutes(card, encoders, conns)
+}
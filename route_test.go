@@ -0,0 +1,40 @@
+package drm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.sr.ht/~emersion/go-drm"
+)
+
+func TestSolveRoutes(t *testing.T) {
+	card := &drm.ModeCard{
+		CRTCs:    []drm.CRTCID{10, 11},
+		Encoders: []drm.EncoderID{20, 21},
+	}
+	encoders := []*drm.ModeEncoder{
+		{ID: 20, PossibleCRTCs: 0x3, CRTC: 11},
+		{ID: 21, PossibleCRTCs: 0x1},
+	}
+	conns := []*drm.ModeConnector{
+		{ID: 30, PossibleEncoders: []drm.EncoderID{20}, Encoder: 20},
+		{ID: 31, PossibleEncoders: []drm.EncoderID{21}},
+	}
+
+	routes, err := drm.SolveRoutes(card, encoders, conns)
+	if err != nil {
+		t.Fatalf("SolveRoutes() = %v", err)
+	}
+	want := []drm.Route{
+		{Connector: 30, Encoder: 20, CRTC: 11},
+		{Connector: 31, Encoder: 21, CRTC: 10},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("SolveRoutes() = %v, want %v", routes, want)
+	}
+
+	conns = append(conns, &drm.ModeConnector{ID: 32, PossibleEncoders: []drm.EncoderID{21}})
+	if _, err := drm.SolveRoutes(card, encoders, conns); err == nil {
+		t.Errorf("SolveRoutes() = nil, want error")
+	}
+}
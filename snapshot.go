@@ -0,0 +1,366 @@
+package drm
+
+// Snapshot contains the whole KMS state of a device. It can be marshaled to
+// and unmarshaled from JSON.
+type Snapshot struct {
+	Version    *Version          `json:"version"`
+	Device     *SnapshotDevice   `json:"device,omitempty"`
+	Caps       map[string]uint64 `json:"caps"`
+	ClientCaps map[string]bool   `json:"client_caps"`
+
+	MinWidth  uint32 `json:"min_width"`
+	MaxWidth  uint32 `json:"max_width"`
+	MinHeight uint32 `json:"min_height"`
+	MaxHeight uint32 `json:"max_height"`
+
+	FBs        []FBID              `json:"fbs"`
+	CRTCs      []SnapshotCRTC      `json:"crtcs"`
+	Encoders   []SnapshotEncoder   `json:"encoders"`
+	Connectors []SnapshotConnector `json:"connectors"`
+	Planes     []SnapshotPlane     `json:"planes"`
+}
+
+// SnapshotDevice describes the device backing a node. BusID isn't filled by
+// Node.Snapshot.
+type SnapshotDevice struct {
+	BusType BusType    `json:"bus_type"`
+	BusID   string     `json:"bus_id,omitempty"`
+	PCI     *PCIDevice `json:"pci,omitempty"`
+}
+
+type SnapshotCRTC struct {
+	ID         CRTCID                      `json:"id"`
+	FB         FBID                        `json:"fb"`
+	X          uint32                      `json:"x"`
+	Y          uint32                      `json:"y"`
+	GammaSize  uint32                      `json:"gamma_size"`
+	Mode       *ModeModeInfo               `json:"mode"`
+	Properties map[string]SnapshotProperty `json:"properties"`
+}
+
+type SnapshotEncoder struct {
+	ID             EncoderID   `json:"id"`
+	Type           EncoderType `json:"type"`
+	CRTC           CRTCID      `json:"crtc"`
+	PossibleCRTCs  uint32      `json:"possible_crtcs"`
+	PossibleClones uint32      `json:"possible_clones"`
+}
+
+type SnapshotConnector struct {
+	ID         ConnectorID                 `json:"id"`
+	Name       string                      `json:"name"`
+	Type       ConnectorType               `json:"type"`
+	TypeID     uint32                      `json:"type_id"`
+	Status     ConnectorStatus             `json:"status"`
+	PhyWidth   uint32                      `json:"phy_width"`
+	PhyHeight  uint32                      `json:"phy_height"`
+	Subpixel   Subpixel                    `json:"subpixel"`
+	Encoder    EncoderID                   `json:"encoder"`
+	Encoders   []EncoderID                 `json:"encoders"`
+	Modes      []ModeModeInfo              `json:"modes"`
+	Properties map[string]SnapshotProperty `json:"properties"`
+}
+
+type SnapshotPlane struct {
+	ID            PlaneID                     `json:"id"`
+	CRTC          CRTCID                      `json:"crtc"`
+	FB            FBID                        `json:"fb"`
+	PossibleCRTCs uint32                      `json:"possible_crtcs"`
+	GammaSize     uint32                      `json:"gamma_size"`
+	Formats       []Format                    `json:"formats"`
+	Properties    map[string]SnapshotProperty `json:"properties"`
+}
+
+// SnapshotProperty contains a property's specification and its current
+// value. Depending on the property type, the value is decoded into one of
+// the Enum, Bitmask or Blob fields.
+type SnapshotProperty struct {
+	ID        PropertyID `json:"id"`
+	Type      string     `json:"type"`
+	Immutable bool       `json:"immutable"`
+	Atomic    bool       `json:"atomic"`
+
+	Min        *int64             `json:"min,omitempty"`
+	Max        *int64             `json:"max,omitempty"`
+	Enums      []ModePropertyEnum `json:"enums,omitempty"`
+	ObjectType ObjectType         `json:"object_type,omitempty"`
+
+	RawValue uint64        `json:"raw_value"`
+	Enum     string        `json:"enum,omitempty"`
+	Bitmask  []string      `json:"bitmask,omitempty"`
+	Blob     *SnapshotBlob `json:"blob,omitempty"`
+}
+
+type SnapshotBlob struct {
+	ID   BlobID `json:"id"`
+	Data []byte `json:"data"`
+
+	EDID      *EDID                     `json:"edid,omitempty"`
+	Mode      *ModeModeInfo             `json:"mode,omitempty"`
+	InFormats []SnapshotFormatModifiers `json:"in_formats,omitempty"`
+	Formats   []Format                  `json:"formats,omitempty"`
+	Path      string                    `json:"path,omitempty"`
+	LUT       ColorLUT                  `json:"lut,omitempty"`
+	CTM       *ColorMatrix              `json:"ctm,omitempty"`
+	HDR       *HDROutputMetadata        `json:"hdr,omitempty"`
+}
+
+type SnapshotFormatModifiers struct {
+	Modifier Modifier `json:"modifier"`
+	Formats  []Format `json:"formats"`
+}
+
+// Snapshot walks all KMS objects of the device and gathers their state.
+//
+// The universal planes client cap is enabled, so that all planes are exposed,
+// and recorded in ClientCaps. Other client caps aren't touched, since some of
+// them change the behaviour of the node (e.g. atomic also exposes aspect ratio
+// mode flags): callers interested in the objects and properties they expose
+// must enable them beforehand.
+//
+// Device information is best-effort: it's left nil if the node isn't backed by
+// a device file. The bus ID isn't filled, since querying it changes the
+// interface version of the node.
+func (n *Node) Snapshot() (*Snapshot, error) {
+	if err := n.SetClientCap(ClientCapUniversalPlanes, 1); err != nil {
+		return nil, err
+	}
+	clientCaps := map[string]bool{
+		ClientCapUniversalPlanes.String(): true,
+	}
+
+	version, err := n.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	var device *SnapshotDevice
+	if dev, err := n.GetDevice(); err == nil {
+		device = &SnapshotDevice{BusType: dev.BusType()}
+		device.PCI, _ = dev.(*PCIDevice)
+	}
+
+	caps := make(map[string]uint64)
+	for c := CapDumbBuffer; c <= CapAtomicAsyncPageFlip; c++ {
+		if c.String() == "unknown" {
+			continue
+		}
+		if v, err := n.GetCap(c); err == nil {
+			caps[c.String()] = v
+		}
+	}
+
+	card, err := n.ModeGetResources()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Version:    version,
+		Device:     device,
+		Caps:       caps,
+		ClientCaps: clientCaps,
+		MinWidth:   card.MinWidth,
+		MaxWidth:   card.MaxWidth,
+		MinHeight:  card.MinHeight,
+		MaxHeight:  card.MaxHeight,
+		FBs:        card.FBs,
+	}
+
+	for _, id := range card.CRTCs {
+		crtc, err := n.ModeGetCRTC(id)
+		if err != nil {
+			return nil, err
+		}
+		props, err := n.snapshotProperties(id)
+		if err != nil {
+			return nil, err
+		}
+		s.CRTCs = append(s.CRTCs, SnapshotCRTC{
+			ID:         crtc.ID,
+			FB:         crtc.FB,
+			X:          crtc.X,
+			Y:          crtc.Y,
+			GammaSize:  crtc.GammaSize,
+			Mode:       crtc.Mode,
+			Properties: props,
+		})
+	}
+
+	for _, id := range card.Encoders {
+		enc, err := n.ModeGetEncoder(id)
+		if err != nil {
+			return nil, err
+		}
+		s.Encoders = append(s.Encoders, SnapshotEncoder{
+			ID:             enc.ID,
+			Type:           enc.Type,
+			CRTC:           enc.CRTC,
+			PossibleCRTCs:  enc.PossibleCRTCs,
+			PossibleClones: enc.PossibleClones,
+		})
+	}
+
+	for _, id := range card.Connectors {
+		conn, err := n.ModeGetConnector(id)
+		if err != nil {
+			return nil, err
+		}
+		props, err := n.snapshotPropertyValues(conn.Properties)
+		if err != nil {
+			return nil, err
+		}
+		s.Connectors = append(s.Connectors, SnapshotConnector{
+			ID:         conn.ID,
+			Name:       conn.Name(),
+			Type:       conn.Type,
+			TypeID:     conn.TypeID,
+			Status:     conn.Status,
+			PhyWidth:   conn.PhyWidth,
+			PhyHeight:  conn.PhyHeight,
+			Subpixel:   conn.Subpixel,
+			Encoder:    conn.Encoder,
+			Encoders:   conn.PossibleEncoders,
+			Modes:      conn.Modes,
+			Properties: props,
+		})
+	}
+
+	planes, err := n.ModeGetPlaneResources()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range planes {
+		plane, err := n.ModeGetPlane(id)
+		if err != nil {
+			return nil, err
+		}
+		props, err := n.snapshotProperties(id)
+		if err != nil {
+			return nil, err
+		}
+		s.Planes = append(s.Planes, SnapshotPlane{
+			ID:            plane.ID,
+			CRTC:          plane.CRTC,
+			FB:            plane.FB,
+			PossibleCRTCs: plane.PossibleCRTCs,
+			GammaSize:     plane.GammaSize,
+			Formats:       plane.Formats,
+			Properties:    props,
+		})
+	}
+
+	return s, nil
+}
+
+func (n *Node) snapshotProperties(id AnyID) (map[string]SnapshotProperty, error) {
+	values, err := n.ModeObjectGetProperties(id)
+	if err != nil {
+		return nil, err
+	}
+	return n.snapshotPropertyValues(values)
+}
+
+func (n *Node) snapshotPropertyValues(values map[PropertyID]uint64) (map[string]SnapshotProperty, error) {
+	m := make(map[string]SnapshotProperty, len(values))
+	for _, id := range sortedPropertyIDs(values) {
+		val := values[id]
+		prop, err := n.ModeGetProperty(id)
+		if err != nil {
+			return nil, err
+		}
+
+		sp := SnapshotProperty{
+			ID:        prop.ID,
+			Type:      prop.Type().String(),
+			Immutable: prop.Immutable(),
+			Atomic:    prop.Atomic(),
+			RawValue:  val,
+		}
+
+		switch prop.Type() {
+		case PropertyRange:
+			if low, high, ok := prop.Range(); ok {
+				min, max := int64(low), int64(high)
+				sp.Min, sp.Max = &min, &max
+			}
+		case PropertySignedRange:
+			if low, high, ok := prop.SignedRange(); ok {
+				sp.Min, sp.Max = &low, &high
+			}
+		case PropertyEnum:
+			sp.Enums, _ = prop.Enums()
+			for _, e := range sp.Enums {
+				if e.Value == val {
+					sp.Enum = e.Name
+				}
+			}
+		case PropertyBitmask:
+			sp.Enums, _ = prop.Enums()
+			for _, e := range sp.Enums {
+				if val&(1<<e.Value) != 0 {
+					sp.Bitmask = append(sp.Bitmask, e.Name)
+				}
+			}
+		case PropertyObject:
+			sp.ObjectType, _ = prop.ObjectType()
+		case PropertyBlob:
+			if val != 0 {
+				sp.Blob, err = n.snapshotBlob(prop.Name, BlobID(val))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		m[prop.Name] = sp
+	}
+	return m, nil
+}
+
+func (n *Node) snapshotBlob(propName string, id BlobID) (*SnapshotBlob, error) {
+	data, err := n.ModeGetBlob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Malformed blobs are common on buggy hardware: keep the raw data and
+	// leave the decoded fields empty instead of failing
+	blob := &SnapshotBlob{ID: id, Data: data}
+	switch propName {
+	case "EDID":
+		blob.EDID, _ = ParseEDID(data)
+	case "MODE_ID":
+		blob.Mode, _ = ParseModeModeInfo(data)
+	case "IN_FORMATS":
+		if set, err := ParseFormatModifierSet(data); err == nil {
+			blob.InFormats = newSnapshotFormatModifiers(set)
+		}
+	case "WRITEBACK_PIXEL_FORMATS":
+		blob.Formats, _ = ParseFormats(data)
+	case "PATH":
+		blob.Path, _ = ParsePath(data)
+	case "GAMMA_LUT", "DEGAMMA_LUT":
+		blob.LUT, _ = ParseColorLUT(data)
+	case "CTM":
+		blob.CTM, _ = ParseColorMatrix(data)
+	case "HDR_OUTPUT_METADATA":
+		blob.HDR, _ = ParseHDROutputMetadata(data)
+	}
+	return blob, nil
+}
+
+func newSnapshotFormatModifiers(set *FormatModifierSet) []SnapshotFormatModifiers {
+	var l []SnapshotFormatModifiers
+	idx := make(map[Modifier]int)
+	set.forEach(func(fmt Format, mod Modifier) {
+		i, ok := idx[mod]
+		if !ok {
+			i = len(l)
+			idx[mod] = i
+			l = append(l, SnapshotFormatModifiers{Modifier: mod})
+		}
+		l[i].Formats = append(l[i].Formats, fmt)
+	})
+	return l
+}
@@ -0,0 +1,783 @@
+package drm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+// TraceEntry is a recorded ioctl or event read.
+type TraceEntry struct {
+	// Req is the ioctl request number, or zero for event reads.
+	Req  uint32 `json:"req"`
+	Name string `json:"name,omitempty"`
+	// Arg is the decoded argument structure after the ioctl, for
+	// informational purposes only.
+	Arg map[string]interface{} `json:"arg,omitempty"`
+
+	// In and Out contain the raw argument structure before and after the
+	// ioctl. For event reads, Out contains the data read.
+	In  []byte `json:"in"`
+	Out []byte `json:"out"`
+	// Inputs and Buffers contain the user memory read and written by the
+	// ioctl, indexed by the name of the argument field pointing to it.
+	Inputs  map[string][]byte `json:"inputs,omitempty"`
+	Buffers map[string][]byte `json:"buffers,omitempty"`
+	// OutFences contains the file descriptors written to the out-fence
+	// pointers of an atomic commit.
+	OutFences []int32 `json:"out_fences,omitempty"`
+
+	Errno    syscall.Errno `json:"errno,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+}
+
+type ioctlBuffer struct {
+	name string
+	ptr  unsafe.Pointer
+	size int
+}
+
+type ioctlDesc struct {
+	name string
+	typ  reflect.Type
+	// inputs returns the user memory read by the ioctl, given the argument
+	// structure before the ioctl
+	inputs func(arg unsafe.Pointer) []ioctlBuffer
+	// buffers returns the user memory written by the ioctl, given the
+	// argument structure before and after the ioctl
+	buffers func(in, out unsafe.Pointer) []ioctlBuffer
+}
+
+func bufferSize(in, out uint32, elemSize uintptr) int {
+	if out < in {
+		in = out
+	}
+	return int(in) * int(elemSize)
+}
+
+var ptrType = reflect.TypeOf(uapi.Ptr(0))
+
+var ioctlDescs = map[uint32]ioctlDesc{
+	uapi.IoctlVersion: {
+		name: "VERSION",
+		typ:  reflect.TypeOf(uapi.VersionResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.VersionResp)(in), (*uapi.VersionResp)(out)
+			return []ioctlBuffer{
+				{"Name", unsafe.Pointer(i.Name), bufferSize(uint32(i.NameLen), uint32(o.NameLen), 1)},
+				{"Date", unsafe.Pointer(i.Date), bufferSize(uint32(i.DateLen), uint32(o.DateLen), 1)},
+				{"Desc", unsafe.Pointer(i.Desc), bufferSize(uint32(i.DescLen), uint32(o.DescLen), 1)},
+			}
+		},
+	},
+	uapi.IoctlGetUnique: {
+		name: "GET_UNIQUE",
+		typ:  reflect.TypeOf(uapi.UniqueResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.UniqueResp)(in), (*uapi.UniqueResp)(out)
+			return []ioctlBuffer{
+				{"Unique", unsafe.Pointer(i.Unique), bufferSize(uint32(i.UniqueLen), uint32(o.UniqueLen), 1)},
+			}
+		},
+	},
+	uapi.IoctlSetVersion: {
+		name: "SET_VERSION",
+		typ:  reflect.TypeOf(uapi.SetVersionArg{}),
+	},
+	uapi.IoctlGetCap: {
+		name: "GET_CAP",
+		typ:  reflect.TypeOf(uapi.GetCapArg{}),
+	},
+	uapi.IoctlSetClientCap: {
+		name: "SET_CLIENT_CAP",
+		typ:  reflect.TypeOf(uapi.SetCapArg{}),
+	},
+	uapi.IoctlWaitVBlank: {
+		name: "WAIT_VBLANK",
+		typ:  reflect.TypeOf(uapi.WaitVBlankArg{}),
+	},
+	uapi.IoctlCRTCGetSequence: {
+		name: "CRTC_GET_SEQUENCE",
+		typ:  reflect.TypeOf(uapi.CRTCGetSequenceArg{}),
+	},
+	uapi.IoctlCRTCQueueSequence: {
+		name: "CRTC_QUEUE_SEQUENCE",
+		typ:  reflect.TypeOf(uapi.CRTCQueueSequenceArg{}),
+	},
+	uapi.IoctlModeGetResources: {
+		name: "MODE_GETRESOURCES",
+		typ:  reflect.TypeOf(uapi.ModeCardResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModeCardResp)(in), (*uapi.ModeCardResp)(out)
+			return []ioctlBuffer{
+				{"FBs", i.FBs.Pointer(), bufferSize(i.FBsLen, o.FBsLen, 4)},
+				{"CRTCs", i.CRTCs.Pointer(), bufferSize(i.CRTCsLen, o.CRTCsLen, 4)},
+				{"Connectors", i.Connectors.Pointer(), bufferSize(i.ConnectorsLen, o.ConnectorsLen, 4)},
+				{"Encoders", i.Encoders.Pointer(), bufferSize(i.EncodersLen, o.EncodersLen, 4)},
+			}
+		},
+	},
+	uapi.IoctlModeGetCRTC: {
+		name: "MODE_GETCRTC",
+		typ:  reflect.TypeOf(uapi.ModeCRTCResp{}),
+	},
+	uapi.IoctlModeSetCRTC: {
+		name: "MODE_SETCRTC",
+		typ:  reflect.TypeOf(uapi.ModeCRTCResp{}),
+		inputs: func(arg unsafe.Pointer) []ioctlBuffer {
+			r := (*uapi.ModeCRTCResp)(arg)
+			return []ioctlBuffer{
+				{"SetConnectors", r.SetConnectors.Pointer(), int(r.SetConnectorsLen) * 4},
+			}
+		},
+	},
+	uapi.IoctlModeGetGamma: {
+		name: "MODE_GETGAMMA",
+		typ:  reflect.TypeOf(uapi.ModeCRTCLUT{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i := (*uapi.ModeCRTCLUT)(in)
+			size := int(i.GammaSize) * 2
+			return []ioctlBuffer{
+				{"Red", i.Red.Pointer(), size},
+				{"Green", i.Green.Pointer(), size},
+				{"Blue", i.Blue.Pointer(), size},
+			}
+		},
+	},
+	uapi.IoctlModeSetGamma: {
+		name: "MODE_SETGAMMA",
+		typ:  reflect.TypeOf(uapi.ModeCRTCLUT{}),
+		inputs: func(arg unsafe.Pointer) []ioctlBuffer {
+			r := (*uapi.ModeCRTCLUT)(arg)
+			size := int(r.GammaSize) * 2
+			return []ioctlBuffer{
+				{"Red", r.Red.Pointer(), size},
+				{"Green", r.Green.Pointer(), size},
+				{"Blue", r.Blue.Pointer(), size},
+			}
+		},
+	},
+	uapi.IoctlModeGetEncoder: {
+		name: "MODE_GETENCODER",
+		typ:  reflect.TypeOf(uapi.ModeEncoderResp{}),
+	},
+	uapi.IoctlModeGetConnector: {
+		name: "MODE_GETCONNECTOR",
+		typ:  reflect.TypeOf(uapi.ModeConnectorResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModeConnectorResp)(in), (*uapi.ModeConnectorResp)(out)
+			modesSize := 0
+			if i.ModesLen >= o.ModesLen {
+				modesSize = int(o.ModesLen) * int(unsafe.Sizeof(uapi.ModeModeInfo{}))
+			}
+			return []ioctlBuffer{
+				{"Encoders", i.Encoders.Pointer(), bufferSize(i.EncodersLen, o.EncodersLen, 4)},
+				{"Modes", i.Modes.Pointer(), modesSize},
+				{"PropIDs", i.PropIDs.Pointer(), bufferSize(i.PropsLen, o.PropsLen, 4)},
+				{"PropValues", i.PropValues.Pointer(), bufferSize(i.PropsLen, o.PropsLen, 8)},
+			}
+		},
+	},
+	uapi.IoctlModeRemoveFB: {
+		name: "MODE_RMFB",
+		typ:  reflect.TypeOf(uapi.ModeRemoveFBArg{}),
+	},
+	uapi.IoctlModePageFlip: {
+		name: "MODE_PAGE_FLIP",
+		typ:  reflect.TypeOf(uapi.ModeCRTCPageFlipArg{}),
+	},
+	uapi.IoctlModeCreateDumb: {
+		name: "MODE_CREATE_DUMB",
+		typ:  reflect.TypeOf(uapi.ModeCreateDumbArg{}),
+	},
+	uapi.IoctlModeMapDumb: {
+		name: "MODE_MAP_DUMB",
+		typ:  reflect.TypeOf(uapi.ModeMapDumbArg{}),
+	},
+	uapi.IoctlModeDestroyDumb: {
+		name: "MODE_DESTROY_DUMB",
+		typ:  reflect.TypeOf(uapi.ModeDestroyDumbArg{}),
+	},
+	uapi.IoctlModeGetPlaneResources: {
+		name: "MODE_GETPLANERESOURCES",
+		typ:  reflect.TypeOf(uapi.ModePlaneResourcesResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModePlaneResourcesResp)(in), (*uapi.ModePlaneResourcesResp)(out)
+			return []ioctlBuffer{
+				{"Planes", i.Planes.Pointer(), bufferSize(i.PlanesLen, o.PlanesLen, 4)},
+			}
+		},
+	},
+	uapi.IoctlModeGetPlane: {
+		name: "MODE_GETPLANE",
+		typ:  reflect.TypeOf(uapi.ModePlaneResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModePlaneResp)(in), (*uapi.ModePlaneResp)(out)
+			size := 0
+			if i.FormatsLen >= o.FormatsLen {
+				size = int(o.FormatsLen) * 4
+			}
+			return []ioctlBuffer{
+				{"Formats", i.Formats.Pointer(), size},
+			}
+		},
+	},
+	uapi.IoctlModeSetPlane: {
+		name: "MODE_SETPLANE",
+		typ:  reflect.TypeOf(uapi.ModeSetPlaneArg{}),
+	},
+	uapi.IoctlModeAddFB2: {
+		name: "MODE_ADDFB2",
+		typ:  reflect.TypeOf(uapi.ModeFBCmd2{}),
+	},
+	uapi.IoctlModeObjectGetProperties: {
+		name: "MODE_OBJ_GETPROPERTIES",
+		typ:  reflect.TypeOf(uapi.ModeObjectGetPropertiesResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModeObjectGetPropertiesResp)(in), (*uapi.ModeObjectGetPropertiesResp)(out)
+			return []ioctlBuffer{
+				{"PropIDs", i.PropIDs.Pointer(), bufferSize(i.PropsLen, o.PropsLen, 4)},
+				{"PropValues", i.PropValues.Pointer(), bufferSize(i.PropsLen, o.PropsLen, 8)},
+			}
+		},
+	},
+	uapi.IoctlModeGetProperty: {
+		name: "MODE_GETPROPERTY",
+		typ:  reflect.TypeOf(uapi.ModeGetPropertyResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModeGetPropertyResp)(in), (*uapi.ModeGetPropertyResp)(out)
+			values := i.Values.Pointer()
+			enumBlobs := i.EnumBlobs.Pointer()
+			// Arrays are only written if they're large enough
+			valuesSize, enumBlobsSize := 0, 0
+			switch newPropertyType(o.Flags) {
+			case PropertyBlob:
+				if i.EnumBlobsLen >= o.EnumBlobsLen {
+					valuesSize = int(o.EnumBlobsLen) * 4
+					enumBlobsSize = int(o.EnumBlobsLen) * 4
+				}
+			case PropertyEnum, PropertyBitmask:
+				if i.EnumBlobsLen >= o.EnumBlobsLen {
+					enumBlobsSize = int(o.EnumBlobsLen) * int(unsafe.Sizeof(uapi.ModePropertyEnum{}))
+				}
+				fallthrough
+			default:
+				if i.ValuesLen >= o.ValuesLen {
+					valuesSize = int(o.ValuesLen) * 8
+				}
+			}
+			return []ioctlBuffer{
+				{"Values", values, valuesSize},
+				{"EnumBlobs", enumBlobs, enumBlobsSize},
+			}
+		},
+	},
+	uapi.IoctlModeGetBlob: {
+		name: "MODE_GETPROPBLOB",
+		typ:  reflect.TypeOf(uapi.ModeGetBlobResp{}),
+		buffers: func(in, out unsafe.Pointer) []ioctlBuffer {
+			i, o := (*uapi.ModeGetBlobResp)(in), (*uapi.ModeGetBlobResp)(out)
+			size := 0
+			if i.Size == o.Size {
+				size = int(o.Size)
+			}
+			return []ioctlBuffer{
+				{"Data", i.Data.Pointer(), size},
+			}
+		},
+	},
+	uapi.IoctlModeObjectSetProperty: {
+		name: "MODE_OBJ_SETPROPERTY",
+		typ:  reflect.TypeOf(uapi.ModeObjectSetPropertyArg{}),
+	},
+	uapi.IoctlModeAtomic: {
+		name: "MODE_ATOMIC",
+		typ:  reflect.TypeOf(uapi.ModeAtomicArg{}),
+		inputs: func(arg unsafe.Pointer) []ioctlBuffer {
+			r := (*uapi.ModeAtomicArg)(arg)
+			objs, props := int(r.CountObjs), atomicPropCount(r)
+			return []ioctlBuffer{
+				{"Objs", r.Objs.Pointer(), objs * 4},
+				{"CountProps", r.CountProps.Pointer(), objs * 4},
+				{"Props", r.Props.Pointer(), props * 4},
+				{"PropValues", r.PropValues.Pointer(), props * 8},
+			}
+		},
+	},
+	uapi.IoctlModeCreateBlob: {
+		name: "MODE_CREATEPROPBLOB",
+		typ:  reflect.TypeOf(uapi.ModeCreateBlobArg{}),
+		inputs: func(arg unsafe.Pointer) []ioctlBuffer {
+			r := (*uapi.ModeCreateBlobArg)(arg)
+			return []ioctlBuffer{
+				{"Data", r.Data.Pointer(), int(r.Length)},
+			}
+		},
+	},
+	uapi.IoctlModeDestroyBlob: {
+		name: "MODE_DESTROYPROPBLOB",
+		typ:  reflect.TypeOf(uapi.ModeDestroyBlobArg{}),
+	},
+}
+
+// atomicPropCount returns the total number of properties set by an atomic
+// commit.
+func atomicPropCount(r *uapi.ModeAtomicArg) int {
+	n := int(r.CountObjs)
+	if n == 0 || r.CountProps == 0 {
+		return 0
+	}
+	total := 0
+	for _, count := range (*[1 << 28]uint32)(r.CountProps.Pointer())[:n:n] {
+		total += int(count)
+	}
+	return total
+}
+
+func ioctlName(req uint32) string {
+	if desc, ok := ioctlDescs[req]; ok {
+		return desc.name
+	}
+	return fmt.Sprintf("0x%X", req)
+}
+
+func pointerBytes(ptr unsafe.Pointer, size int) []byte {
+	if ptr == nil || size == 0 {
+		return nil
+	}
+	return (*[1 << 30]byte)(ptr)[:size:size]
+}
+
+// decodeStruct converts an argument structure to a map, skipping pointers.
+func decodeStruct(v reflect.Value) map[string]interface{} {
+	m := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name == "_" {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Type() == ptrType {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Ptr:
+			continue
+		case reflect.Struct:
+			m[field.Name] = decodeStruct(fv)
+		case reflect.Array:
+			if fv.Type().Elem().Kind() != reflect.Uint8 {
+				m[field.Name] = fv.Interface()
+				break
+			}
+			b := make([]byte, fv.Len())
+			reflect.Copy(reflect.ValueOf(b), fv)
+			m[field.Name] = newString(b)
+		default:
+			m[field.Name] = fv.Interface()
+		}
+	}
+	return m
+}
+
+// pointerMask returns a mask of the argument bytes which hold pointers.
+func pointerMask(t reflect.Type, mask []bool, offset uintptr) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		switch {
+		case field.Type == ptrType || field.Type.Kind() == reflect.Ptr:
+			for j := uintptr(0); j < field.Type.Size(); j++ {
+				mask[offset+field.Offset+j] = true
+			}
+		case field.Type.Kind() == reflect.Struct:
+			pointerMask(field.Type, mask, offset+field.Offset)
+		}
+	}
+}
+
+func newPointerMask(req uint32) []bool {
+	mask := make([]bool, uapi.IocSize(req))
+	if desc, ok := ioctlDescs[req]; ok {
+		pointerMask(desc.typ, mask, 0)
+	}
+	return mask
+}
+
+func traceErrno(err error) syscall.Errno {
+	if errno, ok := err.(syscall.Errno); ok {
+		return errno
+	} else if err != nil {
+		return syscall.EIO
+	}
+	return 0
+}
+
+// fenceProps contains the IDs of the out-fence properties, whose values are
+// pointers written by the kernel. Properties are only known by name, so IDs
+// are picked up from MODE_GETPROPERTY replies.
+type fenceProps map[uint32]bool
+
+func (fp fenceProps) update(req uint32, arg unsafe.Pointer) {
+	if req != uapi.IoctlModeGetProperty {
+		return
+	}
+	r := (*uapi.ModeGetPropertyResp)(arg)
+	switch newString(r.Name[:]) {
+	case "OUT_FENCE_PTR", "WRITEBACK_OUT_FENCE_PTR":
+		fp[r.ID] = true
+	}
+}
+
+// outFences returns the indices of the out-fence pointers in the property
+// values of an atomic commit.
+func (fp fenceProps) outFences(req uint32, arg unsafe.Pointer) []int {
+	if req != uapi.IoctlModeAtomic {
+		return nil
+	}
+	r := (*uapi.ModeAtomicArg)(arg)
+	n := atomicPropCount(r)
+	if n == 0 || r.Props == 0 {
+		return nil
+	}
+	var fences []int
+	for i, prop := range (*[1 << 28]uint32)(r.Props.Pointer())[:n:n] {
+		if fp[prop] {
+			fences = append(fences, i)
+		}
+	}
+	return fences
+}
+
+// outFencePtr returns the out-fence pointer at the specified property value
+// index of an atomic commit.
+func outFencePtr(arg unsafe.Pointer, i int) *int32 {
+	r := (*uapi.ModeAtomicArg)(arg)
+	n := atomicPropCount(r)
+	values := (*[1 << 27]uint64)(r.PropValues.Pointer())[:n:n]
+	return (*int32)(uapi.Ptr(values[i]).Pointer())
+}
+
+// readInputs copies the user memory read by an ioctl. Out-fence pointers
+// change from one run to another, they're zeroed.
+func (fp fenceProps) readInputs(req uint32, arg unsafe.Pointer) map[string][]byte {
+	desc, ok := ioctlDescs[req]
+	if !ok || desc.inputs == nil || uintptr(uapi.IocSize(req)) != desc.typ.Size() {
+		return nil
+	}
+	m := make(map[string][]byte)
+	for _, buf := range desc.inputs(arg) {
+		if b := pointerBytes(buf.ptr, buf.size); b != nil {
+			m[buf.name] = append([]byte(nil), b...)
+		}
+	}
+	for _, i := range fp.outFences(req, arg) {
+		v := m["PropValues"][i*8:][:8]
+		for j := range v {
+			v[j] = 0
+		}
+	}
+	return m
+}
+
+// Recorder is a backend recording all ioctls to a trace, which can later be
+// replayed with a Replayer.
+type Recorder struct {
+	b Backend
+
+	mu         sync.Mutex
+	enc        *json.Encoder
+	err        error
+	fenceProps fenceProps
+}
+
+var _ Backend = (*Recorder)(nil)
+
+// NewRecorder creates a backend forwarding ioctls to b, and writing them as
+// JSON lines to w.
+func NewRecorder(b Backend, w io.Writer) *Recorder {
+	return &Recorder{b: b, enc: json.NewEncoder(w), fenceProps: make(fenceProps)}
+}
+
+func (rec *Recorder) Ioctl(req uint32, arg unsafe.Pointer) error {
+	size := uapi.IocSize(req)
+	argBytes := pointerBytes(arg, size)
+	in := append([]byte(nil), argBytes...)
+
+	rec.mu.Lock()
+	var inputs map[string][]byte
+	var fences []int
+	if len(in) > 0 {
+		inputs = rec.fenceProps.readInputs(req, arg)
+		fences = rec.fenceProps.outFences(req, arg)
+	}
+	rec.mu.Unlock()
+
+	start := time.Now()
+	err := rec.b.Ioctl(req, arg)
+	entry := TraceEntry{
+		Req:      req,
+		In:       in,
+		Out:      append([]byte(nil), argBytes...),
+		Inputs:   inputs,
+		Errno:    traceErrno(err),
+		Time:     start,
+		Duration: time.Since(start),
+	}
+	for _, i := range fences {
+		fence := int32(-1)
+		if ptr := outFencePtr(arg, i); ptr != nil {
+			fence = *ptr
+		}
+		entry.OutFences = append(entry.OutFences, fence)
+	}
+
+	if desc, ok := ioctlDescs[req]; ok {
+		entry.Name = desc.name
+		if uintptr(size) == desc.typ.Size() {
+			entry.Arg = decodeStruct(reflect.NewAt(desc.typ, arg).Elem())
+		}
+		if desc.buffers != nil && len(in) > 0 {
+			entry.Buffers = make(map[string][]byte)
+			for _, buf := range desc.buffers(unsafe.Pointer(&in[0]), arg) {
+				if b := pointerBytes(buf.ptr, buf.size); b != nil {
+					entry.Buffers[buf.name] = append([]byte(nil), b...)
+				}
+			}
+		}
+	}
+
+	rec.mu.Lock()
+	if err == nil && len(in) > 0 {
+		rec.fenceProps.update(req, arg)
+	}
+	rec.write(&entry)
+	rec.mu.Unlock()
+
+	return err
+}
+
+func (rec *Recorder) write(entry *TraceEntry) {
+	if rec.err == nil {
+		rec.err = rec.enc.Encode(entry)
+	}
+}
+
+// Read forwards event reads to the underlying backend, if it delivers events.
+// Reads are recorded with a zero request number.
+func (rec *Recorder) Read(b []byte) (int, error) {
+	r, ok := rec.b.(io.Reader)
+	if !ok {
+		return 0, fmt.Errorf("drm: backend doesn't deliver events")
+	}
+
+	start := time.Now()
+	n, err := r.Read(b)
+	entry := TraceEntry{
+		Name:     "READ",
+		Out:      append([]byte(nil), b[:n]...),
+		Errno:    traceErrno(err),
+		Time:     start,
+		Duration: time.Since(start),
+	}
+
+	rec.mu.Lock()
+	rec.write(&entry)
+	rec.mu.Unlock()
+
+	return n, err
+}
+
+// Mmap forwards memory mappings to the underlying backend, if it supports
+// them. Mapped memory isn't recorded.
+func (rec *Recorder) Mmap(offset int64, length int) ([]byte, error) {
+	m, ok := rec.b.(Mapper)
+	if !ok {
+		return nil, fmt.Errorf("drm: backend doesn't support memory mappings")
+	}
+	return m.Mmap(offset, length)
+}
+
+func (rec *Recorder) Munmap(b []byte) error {
+	m, ok := rec.b.(Mapper)
+	if !ok {
+		return fmt.Errorf("drm: backend doesn't support memory mappings")
+	}
+	return m.Munmap(b)
+}
+
+// Err returns the first error which occurred while writing the trace.
+func (rec *Recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// Replayer is a backend replaying a trace recorded with a Recorder. The
+// sequence of ioctls and event reads must match the trace, and so must the
+// user memory read by the ioctls.
+//
+// Out-fences are replaced with already signalled fences. Mapped memory isn't
+// recorded, the replayer maps zeroed memory.
+type Replayer struct {
+	mu         sync.Mutex
+	entries    []TraceEntry
+	next       int
+	fenceProps fenceProps
+}
+
+var _ Backend = (*Replayer)(nil)
+
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	dec := json.NewDecoder(r)
+	var entries []TraceEntry
+	for {
+		var entry TraceEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("drm: failed to decode trace: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return &Replayer{entries: entries, fenceProps: make(fenceProps)}, nil
+}
+
+// Done returns true if all ioctls of the trace have been replayed.
+func (rep *Replayer) Done() bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	return rep.next == len(rep.entries)
+}
+
+func (rep *Replayer) Ioctl(req uint32, arg unsafe.Pointer) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if rep.next >= len(rep.entries) {
+		return fmt.Errorf("drm: replay: unexpected ioctl %v after end of trace", ioctlName(req))
+	}
+	i := rep.next
+	entry := &rep.entries[i]
+	if entry.Req == 0 {
+		return fmt.Errorf("drm: replay: entry #%v is an event read, want ioctl %v", i, ioctlName(req))
+	}
+	if entry.Req != req {
+		return fmt.Errorf("drm: replay: ioctl #%v is %v, want %v", i, ioctlName(req), ioctlName(entry.Req))
+	}
+
+	size := uapi.IocSize(req)
+	if len(entry.In) != size || len(entry.Out) != size {
+		return fmt.Errorf("drm: replay: ioctl #%v (%v) has an invalid argument size", i, ioctlName(req))
+	}
+
+	// Pointers change from one run to another, ignore them
+	argBytes := pointerBytes(arg, size)
+	mask := newPointerMask(req)
+	in := append([]byte(nil), argBytes...)
+	for j := range in {
+		if !mask[j] && in[j] != entry.In[j] {
+			return fmt.Errorf("drm: replay: ioctl #%v (%v) argument differs from trace", i, ioctlName(req))
+		}
+	}
+
+	var inputs map[string][]byte
+	var fences []int
+	if size > 0 {
+		inputs = rep.fenceProps.readInputs(req, arg)
+		fences = rep.fenceProps.outFences(req, arg)
+	}
+	if len(inputs) != len(entry.Inputs) {
+		return fmt.Errorf("drm: replay: ioctl #%v (%v) buffers differ from trace", i, ioctlName(req))
+	}
+	for name, b := range inputs {
+		if recorded, ok := entry.Inputs[name]; !ok || !bytes.Equal(b, recorded) {
+			return fmt.Errorf("drm: replay: ioctl #%v (%v) buffer %v differs from trace", i, ioctlName(req), name)
+		}
+	}
+	if len(fences) != len(entry.OutFences) {
+		return fmt.Errorf("drm: replay: ioctl #%v (%v) out-fences differ from trace", i, ioctlName(req))
+	}
+
+	rep.next++
+
+	for j := range argBytes {
+		if !mask[j] {
+			argBytes[j] = entry.Out[j]
+		}
+	}
+
+	if desc, ok := ioctlDescs[req]; ok && desc.buffers != nil && size > 0 {
+		for _, buf := range desc.buffers(unsafe.Pointer(&in[0]), arg) {
+			recorded := entry.Buffers[buf.name]
+			if len(recorded) > 0 && len(recorded) != buf.size {
+				return fmt.Errorf("drm: replay: ioctl #%v (%v) buffer %v size differs from trace", i, ioctlName(req), buf.name)
+			}
+			copy(pointerBytes(buf.ptr, buf.size), recorded)
+		}
+	}
+
+	for j, fence := range entry.OutFences {
+		ptr := outFencePtr(arg, fences[j])
+		if ptr == nil {
+			continue
+		}
+		if fence >= 0 {
+			var err error
+			if fence, err = newSignalledFence(); err != nil {
+				return err
+			}
+		}
+		*ptr = fence
+	}
+
+	if entry.Errno != 0 {
+		return entry.Errno
+	}
+	rep.fenceProps.update(req, arg)
+	return nil
+}
+
+// Read replays an event read.
+func (rep *Replayer) Read(b []byte) (int, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if rep.next >= len(rep.entries) {
+		return 0, fmt.Errorf("drm: replay: unexpected event read after end of trace")
+	}
+	i := rep.next
+	entry := &rep.entries[i]
+	if entry.Req != 0 {
+		return 0, fmt.Errorf("drm: replay: entry #%v is ioctl %v, want an event read", i, ioctlName(entry.Req))
+	}
+	if len(entry.Out) > len(b) {
+		return 0, fmt.Errorf("drm: replay: event read #%v buffer is too small", i)
+	}
+
+	rep.next++
+
+	n := copy(b, entry.Out)
+	if entry.Errno != 0 {
+		return n, entry.Errno
+	}
+	return n, nil
+}
+
+// Mmap returns zeroed memory, since mapped memory isn't recorded.
+func (rep *Replayer) Mmap(offset int64, length int) ([]byte, error) {
+	return make([]byte, length), nil
+}
+
+func (rep *Replayer) Munmap(b []byte) error {
+	return nil
+}
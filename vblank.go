@@ -0,0 +1,125 @@
+package drm
+
+import (
+	"fmt"
+	"time"
+
+	"git.sr.ht/~emersion/go-drm/internal/uapi"
+)
+
+const (
+	vblankAbsolute      = 0x00000000
+	vblankRelative      = 0x00000001
+	vblankHighCRTCShift = 1
+	vblankHighCRTCMask  = 0x0000003e
+	vblankEvent         = 0x04000000
+	vblankNextOnMiss    = 0x10000000
+	vblankSecondary     = 0x20000000
+)
+
+// WaitVBlankRequest describes a vblank wait.
+type WaitVBlankRequest struct {
+	// Index of the CRTC in ModeCard.CRTCs
+	CRTCIndex int
+	// Sequence to wait for, relative to the current one if Relative is set
+	Sequence   uint32
+	Relative   bool
+	NextOnMiss bool
+	// If set, WaitVBlank returns immediately and a VBlankEvent carrying
+	// UserData is delivered when the sequence is reached. UserData is
+	// truncated to 32 bits on 32-bit platforms.
+	Event    bool
+	UserData uint64
+}
+
+type WaitVBlankReply struct {
+	Sequence uint32
+	Time     time.Duration
+}
+
+// WaitVBlank waits for a vblank. CRTCs with an index greater than 1 require
+// CapVblankHighCRTC.
+func (n *Node) WaitVBlank(req *WaitVBlankRequest) (*WaitVBlankReply, error) {
+	var t uint32 = vblankAbsolute
+	if req.Relative {
+		t = vblankRelative
+	}
+	if req.NextOnMiss {
+		t |= vblankNextOnMiss
+	}
+	if req.Event {
+		t |= vblankEvent
+	}
+
+	switch {
+	case req.CRTCIndex < 0 || req.CRTCIndex > vblankHighCRTCMask>>vblankHighCRTCShift:
+		return nil, fmt.Errorf("drm: invalid CRTC index %v", req.CRTCIndex)
+	case req.CRTCIndex == 1:
+		t |= vblankSecondary
+	case req.CRTCIndex > 1:
+		highCRTC, err := n.getCapOptional(CapVblankHighCRTC)
+		if err != nil {
+			return nil, err
+		} else if highCRTC == 0 {
+			return nil, fmt.Errorf("drm: vblank on CRTC index %v requires %v", req.CRTCIndex, CapVblankHighCRTC)
+		}
+		t |= uint32(req.CRTCIndex) << vblankHighCRTCShift
+	}
+
+	r := uapi.WaitVBlankArg{
+		Type:     t,
+		Sequence: req.Sequence,
+		Signal:   uint(req.UserData),
+	}
+	if err := waitVBlank(n.backend, &r); err != nil {
+		return nil, err
+	}
+
+	return &WaitVBlankReply{
+		Sequence: r.Sequence,
+		Time:     time.Duration(r.Signal)*time.Second + time.Duration(r.TvalUsec)*time.Microsecond,
+	}, nil
+}
+
+type CRTCSequence struct {
+	Active   bool
+	Sequence uint64
+	Time     time.Duration
+}
+
+// CRTCGetSequence returns the CRTC's current vblank sequence and the time of
+// the last vblank.
+func (n *Node) CRTCGetSequence(id CRTCID) (*CRTCSequence, error) {
+	r := uapi.CRTCGetSequenceArg{CRTCID: uint32(id)}
+	if err := crtcGetSequence(n.backend, &r); err != nil {
+		return nil, err
+	}
+	return &CRTCSequence{
+		Active:   r.Active != 0,
+		Sequence: r.Sequence,
+		Time:     time.Duration(r.SequenceNs),
+	}, nil
+}
+
+type CRTCSequenceFlags uint32
+
+const (
+	CRTCSequenceRelative   CRTCSequenceFlags = 1 << 0
+	CRTCSequenceNextOnMiss CRTCSequenceFlags = 1 << 1
+)
+
+// CRTCQueueSequence requests a CRTCSequenceEvent carrying userData to be
+// delivered when the CRTC reaches the sequence. It returns the sequence the
+// event has been queued for.
+func (n *Node) CRTCQueueSequence(id CRTCID, seq uint64, flags CRTCSequenceFlags, userData uint64) (uint64, error) {
+	r := uapi.CRTCQueueSequenceArg{
+		CRTCID:   uint32(id),
+		Flags:    uint32(flags),
+		Sequence: seq,
+		UserData: userData,
+	}
+	if err := crtcQueueSequence(n.backend, &r); err != nil {
+		return 0, err
+	}
+	return r.Sequence, nil
+}
@@ -0,0 +1,161 @@
+package drm
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// writebackFormats lists the formats WritebackCapture can convert, by order of
+// preference.
+var writebackFormats = []Format{
+	FormatXRGB8888,
+	FormatARGB8888,
+	FormatXBGR8888,
+	FormatABGR8888,
+}
+
+// WritebackCapture captures the output of a CRTC through a writeback
+// connector, and returns it as an image. The CRTC must be active. The capture
+// fails if it doesn't complete before the timeout, a zero timeout waits
+// forever.
+//
+// ClientCapAtomic and ClientCapWritebackConnectors are enabled. The writeback
+// connector is attached to the CRTC with an atomic modeset, and its previous
+// CRTC is restored afterwards.
+func (n *Node) WritebackCapture(conn ConnectorID, crtc CRTCID, timeout time.Duration) (image.Image, error) {
+	if err := n.SetClientCap(ClientCapAtomic, 1); err != nil {
+		return nil, err
+	}
+	if err := n.SetClientCap(ClientCapWritebackConnectors, 1); err != nil {
+		return nil, err
+	}
+
+	props, err := n.modeObjectGetPropertiesByName(conn)
+	if err != nil {
+		return nil, err
+	}
+	var crtcProp, fbProp, fenceProp, formatsProp modeObjectProperty
+	for _, p := range []struct {
+		name string
+		dst  *modeObjectProperty
+	}{
+		{"CRTC_ID", &crtcProp},
+		{"WRITEBACK_FB_ID", &fbProp},
+		{"WRITEBACK_OUT_FENCE_PTR", &fenceProp},
+		{"WRITEBACK_PIXEL_FORMATS", &formatsProp},
+	} {
+		prop, ok := props[p.name]
+		if !ok {
+			return nil, fmt.Errorf("drm: connector %v isn't a writeback connector: missing %v property", conn, p.name)
+		}
+		*p.dst = prop
+	}
+
+	b, err := n.ModeGetBlob(BlobID(formatsProp.Value))
+	if err != nil {
+		return nil, err
+	}
+	supported, err := ParseFormats(b)
+	if err != nil {
+		return nil, err
+	}
+	format, ok := pickWritebackFormat(supported)
+	if !ok {
+		return nil, fmt.Errorf("drm: writeback connector %v doesn't support any 32-bit RGB format", conn)
+	}
+
+	c, err := n.ModeGetCRTC(crtc)
+	if err != nil {
+		return nil, err
+	}
+	if c.Mode == nil {
+		return nil, fmt.Errorf("drm: CRTC %v is disabled", crtc)
+	}
+	width, height := uint32(c.Mode.HDisplay), uint32(c.Mode.VDisplay)
+
+	buf, err := n.ModeCreateDumb(width, height, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer n.ModeDestroyDumb(buf.Handle)
+
+	fb, err := n.ModeAddFB2(&ModeFB2{
+		Width:   width,
+		Height:  height,
+		Format:  format,
+		Handles: [4]uint32{buf.Handle},
+		Pitches: [4]uint32{buf.Pitch},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer n.ModeRemoveFB(fb)
+
+	var req AtomicRequest
+	req.Add(conn, crtcProp.ID, uint64(crtc))
+	req.Add(conn, fbProp.ID, uint64(fb))
+	fenceFD := req.AddOutFence(conn, fenceProp.ID)
+	if err := n.ModeAtomicCommit(&req, AtomicAllowModeset, 0); err != nil {
+		return nil, err
+	}
+
+	// Restore the previous connector routing once the capture is done
+	defer func() {
+		var req AtomicRequest
+		req.Add(conn, crtcProp.ID, crtcProp.Value)
+		n.ModeAtomicCommit(&req, AtomicAllowModeset, 0)
+	}()
+
+	if *fenceFD < 0 {
+		return nil, fmt.Errorf("drm: writeback connector %v didn't return a fence", conn)
+	}
+	if err := waitFence(int(*fenceFD), timeout); err != nil {
+		return nil, err
+	}
+
+	data, err := n.MapDumb(buf)
+	if err != nil {
+		return nil, err
+	}
+	defer n.Munmap(data)
+
+	return newRGBAFrom32(data, int(width), int(height), int(buf.Pitch), format), nil
+}
+
+func pickWritebackFormat(supported []Format) (Format, bool) {
+	for _, f := range writebackFormats {
+		for _, s := range supported {
+			if f == s {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// newRGBAFrom32 converts a buffer in a 32-bit RGB format to an image. DRM
+// formats are little-endian.
+func newRGBAFrom32(b []byte, width, height, pitch int, format Format) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	opaque := format == FormatXRGB8888 || format == FormatXBGR8888
+	swap := format == FormatXRGB8888 || format == FormatARGB8888
+	for y := 0; y < height; y++ {
+		src := b[y*pitch : y*pitch+4*width]
+		dst := img.Pix[y*img.Stride : y*img.Stride+4*width]
+		for x := 0; x < width; x++ {
+			s, d := src[4*x:4*x+4], dst[4*x:4*x+4]
+			if swap {
+				d[0], d[1], d[2] = s[2], s[1], s[0]
+			} else {
+				d[0], d[1], d[2] = s[0], s[1], s[2]
+			}
+			if opaque {
+				d[3] = 0xFF
+			} else {
+				d[3] = s[3]
+			}
+		}
+	}
+	return img
+}